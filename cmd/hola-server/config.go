@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io/ioutil"
+	"time"
+
+	"github.com/georgemac/hola/lib/auth"
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/georgemac/hola/lib/secrets"
+	"github.com/georgemac/hola/lib/storage/file"
+	"github.com/pkg/errors"
+	yamlv2 "gopkg.in/yaml.v2"
+)
+
+// ErrUnknownStore is returned when the configured store scheme is not supported.
+var ErrUnknownStore = file.ErrUnknownScheme
+
+// Config is the configuration file format for hola-server.
+type Config struct {
+	// Listen is the address the server listens on
+	Listen string `yaml:"listen"`
+	// Path is the path the forward authentication endpoint is served on
+	Path string `yaml:"path"`
+
+	// Store is the identity store location in the form [scheme:]path, see file.NewLocation
+	Store         string `yaml:"store"`
+	MasterKeyEnv  string `yaml:"master_key_env"`
+	MasterKeyFile string `yaml:"master_key_file"`
+	// ReloadInterval is how often the store is reloaded, in addition to on SIGHUP.
+	// The store is only reloaded on SIGHUP when it is zero.
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+
+	// validation policy
+	Audiences        []string      `yaml:"audiences"`
+	Issuers          []string      `yaml:"issuers"`
+	Subject          string        `yaml:"subject"`
+	RequiredClaims   []string      `yaml:"required_claims"`
+	RequiredScopes   []string      `yaml:"required_scopes"`
+	ExpirationLeeway time.Duration `yaml:"expiration_leeway"`
+	NotBeforeLeeway  time.Duration `yaml:"not_before_leeway"`
+}
+
+// ReadConfig reads the configuration file at path, applying defaults for missing values.
+func ReadConfig(path string) (Config, error) {
+	config := Config{Listen: ":8080", Path: "/auth"}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+
+	if err := yamlv2.UnmarshalStrict(data, &config); err != nil {
+		return config, errors.Wrapf(err, "reading %q", path)
+	}
+
+	if config.Store == "" {
+		return config, errors.Errorf("reading %q: store is required", path)
+	}
+
+	return config, nil
+}
+
+// OpenStore opens the configured store, returning a Store which reopens it on each Reload.
+func (c Config) OpenStore() (*Store, error) {
+	var (
+		keys secrets.KeyProvider
+		err  error
+	)
+
+	switch {
+	case c.MasterKeyEnv != "":
+		keys, err = secrets.FromEnv(c.MasterKeyEnv)
+	case c.MasterKeyFile != "":
+		keys, err = secrets.FromFile(c.MasterKeyFile)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var storeOpts []file.Option
+	if keys != nil {
+		storeOpts = append(storeOpts, file.WithKeyProvider(keys))
+	}
+
+	return NewStore(func() (identity.Fetcher, error) {
+		return file.OpenLocation(c.Store, storeOpts...)
+	})
+}
+
+// Authenticator returns an Authenticator which validates tokens against the
+// identities of storage according to the configured policy.
+func (c Config) Authenticator(storage identity.Fetcher) *auth.Authenticator {
+	var opts []auth.Option
+	if len(c.Audiences) > 0 {
+		opts = append(opts, auth.WithAudiences(c.Audiences...))
+	}
+
+	if len(c.Issuers) > 0 {
+		opts = append(opts, auth.WithIssuers(c.Issuers...))
+	}
+
+	if c.Subject != "" {
+		opts = append(opts, auth.WithSubject(c.Subject))
+	}
+
+	if len(c.RequiredClaims) > 0 {
+		opts = append(opts, auth.WithPolicy(auth.RequireClaims(c.RequiredClaims...)))
+	}
+
+	if c.ExpirationLeeway > 0 {
+		opts = append(opts, auth.WithExpirationLeeway(c.ExpirationLeeway))
+	}
+
+	if c.NotBeforeLeeway > 0 {
+		opts = append(opts, auth.WithNotBeforeLeeway(c.NotBeforeLeeway))
+	}
+
+	return auth.New(storage, opts...)
+}
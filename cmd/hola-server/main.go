@@ -0,0 +1,113 @@
+// Command hola-server exposes token validation over HTTP as a forward
+// authentication endpoint, for use by reverse proxies in front of services
+// which cannot use the hola middleware directly.
+//
+// Usage:
+//
+//	hola-server -config hola-server.yaml
+//
+// The identity store is read on start up and read again on SIGHUP and, when
+// reload_interval is configured, at that interval. Send the server a SIGHUP
+// after changing the store, for example revoking an identity with
+// `hola identity revoke`, for the change to take effect.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/georgemac/hola/lib/middleware"
+	"github.com/pkg/errors"
+)
+
+func main() {
+	configPath := flag.String("config", "hola-server.yaml", "path to the configuration file")
+	flag.Parse()
+
+	config, err := ReadConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	store, err := config.OpenStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	go reload(store, config.ReloadInterval)
+
+	server := &http.Server{
+		Addr:         config.Listen,
+		Handler:      NewHandler(config.Path, middleware.NewForwardAuth(config.Authenticator(store), config.RequiredScopes...)),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+
+		ctxt, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(ctxt); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	log.Printf("listening on %s", config.Listen)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+// reload reloads the store on SIGHUP and, when interval is non-zero, every interval.
+// Failed reloads are logged and the previously loaded identities continue to be served.
+func reload(store *Store, interval time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-signals:
+		case <-tick:
+		}
+
+		if err := store.Reload(); err != nil {
+			log.Println(errors.Wrap(err, "reloading store"))
+		}
+	}
+}
+
+// NewHandler returns a handler which serves forward authentication on path,
+// and every path beneath it, and a health check on /healthz. Proxies which
+// append the original request URI to the path are served by the same handler.
+func NewHandler(path string, forwardAuth http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(path, forwardAuth)
+	if !strings.HasSuffix(path, "/") {
+		mux.Handle(path+"/", forwardAuth)
+	}
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+
+	return mux
+}
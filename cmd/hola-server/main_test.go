@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/georgemac/hola/lib/middleware"
+	"github.com/georgemac/hola/lib/signer"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/jose.v1/crypto"
+)
+
+const identities = `
+- key: some-issuer-key
+  secret: this is super secret
+  scopes: [resource.action, other.action]
+  signing_method: HS256
+`
+
+func writeFiles(t *testing.T, config string) (string, func()) {
+	dir, err := ioutil.TempDir("", "hola-server")
+	require.Nil(t, err)
+
+	store := filepath.Join(dir, "identities.yaml")
+	require.Nil(t, ioutil.WriteFile(store, []byte(identities), 0600))
+
+	path := filepath.Join(dir, "hola-server.yaml")
+	require.Nil(t, ioutil.WriteFile(path, []byte(fmt.Sprintf(config, store)), 0600))
+
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func Test_ReadConfig(t *testing.T) {
+	path, cleanup := writeFiles(t, "store: yaml:%s\naudiences: [test.audience.com]\n")
+	defer cleanup()
+
+	config, err := ReadConfig(path)
+	require.Nil(t, err)
+	assert.Equal(t, ":8080", config.Listen)
+	assert.Equal(t, "/auth", config.Path)
+	assert.Equal(t, []string{"test.audience.com"}, config.Audiences)
+
+	path, cleanup = writeFiles(t, "store: %s\nunknown: field\n")
+	defer cleanup()
+
+	_, err = ReadConfig(path)
+	assert.Error(t, err)
+
+	path, cleanup = writeFiles(t, "store: other:%s\n")
+	defer cleanup()
+
+	config, err = ReadConfig(path)
+	require.Nil(t, err)
+
+	_, err = config.OpenStore()
+	assert.Equal(t, ErrUnknownStore, errors.Cause(err))
+}
+
+func Test_Config_StorePathWithColon(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hola-server")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	store := filepath.Join(dir, "hola:v2", "identities.yaml")
+	require.Nil(t, os.Mkdir(filepath.Dir(store), 0700))
+	require.Nil(t, ioutil.WriteFile(store, []byte(identities), 0600))
+
+	// text before a colon is only a scheme when it is a valid scheme
+	_, err = Config{Store: store}.OpenStore()
+	assert.Nil(t, err)
+}
+
+func Test_Handler(t *testing.T) {
+	path, cleanup := writeFiles(t, "store: %s\naudiences: [test.audience.com]\nrequired_scopes: [resource.action]\n")
+	defer cleanup()
+
+	config, err := ReadConfig(path)
+	require.Nil(t, err)
+
+	store, err := config.OpenStore()
+	require.Nil(t, err)
+
+	server := httptest.NewServer(NewHandler(config.Path, middleware.NewForwardAuth(config.Authenticator(store), config.RequiredScopes...)))
+	defer server.Close()
+
+	for _, test := range []struct {
+		path   string
+		aud    string
+		scopes []string
+		code   int
+	}{
+		{path: "/auth", aud: "test.audience.com", scopes: []string{"resource.action"}, code: http.StatusOK},
+		{path: "/auth", aud: "test.audience.com", scopes: []string{"other.action"}, code: http.StatusForbidden},
+		{path: "/auth", aud: "other.audience.com", scopes: []string{"resource.action"}, code: http.StatusUnauthorized},
+		// proxies may append the original request URI to the path
+		{path: "/auth/original/path", aud: "test.audience.com", scopes: []string{"resource.action"}, code: http.StatusOK},
+		{path: "/other", aud: "test.audience.com", scopes: []string{"resource.action"}, code: http.StatusNotFound},
+	} {
+		token := signer.New(crypto.SigningMethodHS256,
+			signer.WithIssuer("some-issuer-key"),
+			signer.WithAudience(test.aud),
+			signer.WithScopes(test.scopes...)).Sign(nil)
+
+		serialized, err := token.Serialize([]byte("this is super secret"))
+		require.Nil(t, err)
+
+		req, err := http.NewRequest("GET", server.URL+test.path, nil)
+		require.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer "+string(serialized))
+
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, test.code, resp.StatusCode, test.path, test.aud)
+		if test.code == http.StatusOK {
+			assert.Equal(t, "some-issuer-key", resp.Header.Get(middleware.HeaderIssuer))
+			assert.Equal(t, "resource.action", resp.Header.Get(middleware.HeaderScopes))
+		}
+	}
+
+	resp, err := http.Get(server.URL + "/healthz")
+	require.Nil(t, err)
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.True(t, bytes.Equal([]byte("ok\n"), body))
+}
+
+func Test_Store_Reload(t *testing.T) {
+	path, cleanup := writeFiles(t, "store: %s\n")
+	defer cleanup()
+
+	config, err := ReadConfig(path)
+	require.Nil(t, err)
+
+	store, err := config.OpenStore()
+	require.Nil(t, err)
+
+	_, ok, err := store.Fetch("some-issuer-key")
+	require.Nil(t, err)
+	assert.True(t, ok)
+
+	// revoke the identity in the store, as `hola identity revoke` would
+	require.Nil(t, ioutil.WriteFile(config.Store, []byte("[]\n"), 0600))
+
+	// served until the store is reloaded
+	_, ok, _ = store.Fetch("some-issuer-key")
+	assert.True(t, ok)
+
+	require.Nil(t, store.Reload())
+
+	_, ok, err = store.Fetch("some-issuer-key")
+	require.Nil(t, err)
+	assert.False(t, ok)
+
+	// the previous identities are served when the store cannot be read
+	require.Nil(t, ioutil.WriteFile(config.Store, []byte(identities), 0600))
+	require.Nil(t, store.Reload())
+	require.Nil(t, ioutil.WriteFile(config.Store, []byte("not: [valid"), 0600))
+	assert.NotNil(t, store.Reload())
+
+	_, ok, err = store.Fetch("some-issuer-key")
+	require.Nil(t, err)
+	assert.True(t, ok)
+}
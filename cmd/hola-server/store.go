@@ -0,0 +1,55 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/georgemac/hola/lib/identity"
+)
+
+// validate at compile time that Store implements identity.Fetcher.
+var _ identity.Fetcher = (*Store)(nil)
+
+// Store is an identity.Fetcher over the configured store which can be reloaded
+// while the server is running, so that changes made to the store by other
+// processes, such as revocations with `hola identity revoke`, take effect.
+type Store struct {
+	open func() (identity.Fetcher, error)
+
+	mu      sync.RWMutex
+	fetcher identity.Fetcher
+}
+
+// NewStore returns a Store containing the identities returned by open,
+// which is called again on each Reload.
+func NewStore(open func() (identity.Fetcher, error)) (*Store, error) {
+	s := &Store{open: open}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Fetch returns the identity for the key from the most recently loaded store.
+func (s *Store) Fetch(key string) (identity.Identity, bool, error) {
+	s.mu.RLock()
+	fetcher := s.fetcher
+	s.mu.RUnlock()
+
+	return fetcher.Fetch(key)
+}
+
+// Reload opens the store again and replaces the identities being served.
+// When the store cannot be opened the previous identities continue to be served.
+func (s *Store) Reload() error {
+	fetcher, err := s.open()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.fetcher = fetcher
+	s.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/georgemac/hola/lib/admin"
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/pkg/errors"
+)
+
+// ErrIdentityNotFound is returned when an identity does not exist within the store.
+var ErrIdentityNotFound = errors.New("identity not found")
+
+var now = time.Now
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	return fs
+}
+
+// parse parses the flags and checks the expected number of positional arguments remain.
+func parse(fs *flag.FlagSet, args []string, nargs int) error {
+	if err := fs.Parse(args); err != nil {
+		return errors.Wrapf(ErrUsage, "%s: %s", fs.Name(), err.Error())
+	}
+
+	if fs.NArg() != nargs {
+		return errors.Wrapf(ErrUsage, "%s: expected %d arguments found %d", fs.Name(), nargs, fs.NArg())
+	}
+
+	return nil
+}
+
+func issueIdentity(args []string, out io.Writer) (err error) {
+	var (
+		fs           = newFlagSet("identity issue")
+		stores       storeFlags
+		format       formatFlag
+		scopes       stringsFlag
+		key          = fs.String("key", "", "key for the new identity, generated when empty")
+		keyPrefix    = fs.String("key-prefix", "", "prefix for the generated key")
+		method       = fs.String("method", "HS256", "signing method for the new identity")
+		secretLength = fs.Int("secret-length", identity.DefaultSecretLength, "number of random bytes used to generate the secret")
+		expires      = fs.Duration("expires", 0, "duration until the identity expires, zero never expires")
+		owner        = fs.String("owner", "", "owner of the new identity")
+		description  = fs.String("description", "", "description of the new identity")
+	)
+
+	stores.register(fs)
+	format.register(fs)
+	fs.Var(&scopes, "scope", "scope granted to the new identity, can be repeated")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	req := identity.IssueRequest{
+		Scopes:       scopes,
+		Method:       *method,
+		Key:          *key,
+		KeyPrefix:    *keyPrefix,
+		SecretLength: *secretLength,
+		Owner:        *owner,
+		Description:  *description,
+	}
+
+	if *expires > 0 {
+		req.ExpiresAt = now().UTC().Truncate(time.Second).Add(*expires)
+	}
+
+	s, err := stores.open()
+	if err != nil {
+		return err
+	}
+
+	defer commitStore(s, &err)
+
+	// identities are issued by the store, subject to its issue policy
+	i, err := issuer(s)
+	if err != nil {
+		return err
+	}
+
+	id, err := i.Issue(req)
+	if err != nil {
+		return err
+	}
+
+	// the secret is only ever rendered on issue
+	return writeIdentity(out, format, admin.IdentityView{Redacted: identity.Redacted(id), Secret: id.Secret})
+}
+
+func revokeIdentity(args []string, out io.Writer) (err error) {
+	var (
+		fs     = newFlagSet("identity revoke")
+		stores storeFlags
+	)
+
+	stores.register(fs)
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	s, err := stores.open()
+	if err != nil {
+		return err
+	}
+
+	defer commitStore(s, &err)
+
+	r, err := revoker(s)
+	if err != nil {
+		return err
+	}
+
+	key := fs.Arg(0)
+	if _, ok, err := s.Fetch(key); err != nil {
+		return err
+	} else if !ok {
+		return errors.Wrapf(ErrIdentityNotFound, "key %q", key)
+	}
+
+	return r.Revoke(key)
+}
+
+func listIdentities(args []string, out io.Writer) error {
+	var (
+		fs     = newFlagSet("identity list")
+		stores storeFlags
+		format formatFlag
+		scope  = fs.String("scope", "", "only list identities with the scope")
+		method = fs.String("method", "", "only list identities with the signing method")
+	)
+
+	stores.register(fs)
+	format.register(fs)
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	s, err := stores.open()
+	if err != nil {
+		return err
+	}
+
+	defer closeStore(s)
+
+	l, err := lister(s)
+	if err != nil {
+		return err
+	}
+
+	identities, err := identity.ListAll(l, identity.ListOptions{Scope: *scope, Method: *method})
+	if err != nil {
+		return err
+	}
+
+	views := make([]admin.IdentityView, 0, len(identities))
+	for _, id := range identities {
+		views = append(views, admin.IdentityView{Redacted: identity.Redacted(id)})
+	}
+
+	return writeIdentities(out, format, views)
+}
+
+func inspectIdentity(args []string, out io.Writer) error {
+	var (
+		fs     = newFlagSet("identity inspect")
+		stores storeFlags
+		format formatFlag
+	)
+
+	stores.register(fs)
+	format.register(fs)
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	s, err := stores.open()
+	if err != nil {
+		return err
+	}
+
+	defer closeStore(s)
+
+	id, ok, err := s.Fetch(fs.Arg(0))
+	if err != nil {
+		return err
+	} else if !ok {
+		return errors.Wrapf(ErrIdentityNotFound, "key %q", fs.Arg(0))
+	}
+
+	return writeIdentity(out, format, admin.IdentityView{Redacted: identity.Redacted(id)})
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/georgemac/hola/lib/admin"
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/georgemac/hola/lib/secrets"
+	"github.com/georgemac/hola/lib/storage/file"
+	"github.com/georgemac/hola/lib/storage/memory"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/jose.v1/crypto"
+)
+
+func init() {
+	now = func() time.Time { return time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC) }
+}
+
+func tempStore(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "hola")
+	require.Nil(t, err)
+
+	return filepath.Join(dir, "identities.yaml"), func() { os.RemoveAll(dir) }
+}
+
+func runJSON(t *testing.T, v interface{}, args ...string) {
+	var out bytes.Buffer
+	require.Nil(t, run(args, &out))
+	require.Nil(t, json.Unmarshal(out.Bytes(), v))
+}
+
+func Test_Identity_Lifecycle(t *testing.T) {
+	path, cleanup := tempStore(t)
+	defer cleanup()
+
+	var issued admin.IdentityView
+	runJSON(t, &issued, "identity", "issue", "-store", path, "-key", "some-issuer-key",
+		"-scope", "resource.action", "-scope", "other.action", "-owner", "platform",
+		"-expires", "24h", "-format", "json")
+
+	assert.Equal(t, "some-issuer-key", issued.Key)
+	assert.Equal(t, crypto.SigningMethodHS256, issued.Method)
+	assert.Equal(t, []string{"resource.action", "other.action"}, issued.Scopes)
+	assert.Equal(t, "platform", issued.Owner)
+	assert.Equal(t, "2017-07-15T02:40:00Z", formatTime(issued.ExpiresAt))
+	assert.Len(t, issued.Secret, 43)
+
+	// issuing the same key twice fails
+	err := run([]string{"identity", "issue", "-store", path, "-key", "some-issuer-key"}, ioutil.Discard)
+	assert.Equal(t, identity.ErrKeyInUse, errors.Cause(err))
+
+	var inspected admin.IdentityView
+	runJSON(t, &inspected, "identity", "inspect", "-store", path, "-format", "json", "some-issuer-key")
+	assert.Empty(t, inspected.Secret)
+	issued.Secret = nil
+	assert.Equal(t, issued, inspected)
+
+	var listed []admin.IdentityView
+	runJSON(t, &listed, "identity", "list", "-store", path, "-format", "json")
+	assert.Equal(t, []admin.IdentityView{issued}, listed)
+
+	require.Nil(t, run([]string{"identity", "revoke", "-store", path, "some-issuer-key"}, ioutil.Discard))
+
+	err = run([]string{"identity", "inspect", "-store", path, "some-issuer-key"}, ioutil.Discard)
+	assert.Equal(t, ErrIdentityNotFound, errors.Cause(err))
+
+	err = run([]string{"identity", "revoke", "-store", path, "some-issuer-key"}, ioutil.Discard)
+	assert.Equal(t, ErrIdentityNotFound, errors.Cause(err))
+}
+
+func Test_Identity_List_Table(t *testing.T) {
+	path, cleanup := tempStore(t)
+	defer cleanup()
+
+	// identities are created at the time the store issues them
+	var b, a admin.IdentityView
+	runJSON(t, &b, "identity", "issue", "-store", path, "-key", "b-key", "-method", "HS512", "-format", "json")
+	runJSON(t, &a, "identity", "issue", "-store", path, "-key", "a-key", "-scope", "resource.action", "-format", "json")
+
+	var out bytes.Buffer
+	require.Nil(t, run([]string{"identity", "list", "-store", path}, &out))
+	assert.Equal(t, `KEY    METHOD  SCOPES           OWNER  CREATED               EXPIRES  DISABLED
+a-key  HS256   resource.action         `+formatTime(a.CreatedAt)+`  -        false
+b-key  HS512                           `+formatTime(b.CreatedAt)+`  -        false
+`, out.String())
+}
+
+func Test_Identity_List_Filtered(t *testing.T) {
+	path, cleanup := tempStore(t)
+	defer cleanup()
+
+	require.Nil(t, run([]string{"identity", "issue", "-store", path, "-key", "b-key", "-method", "HS512", "-scope", "resource.action"}, ioutil.Discard))
+	require.Nil(t, run([]string{"identity", "issue", "-store", path, "-key", "a-key", "-scope", "resource.action"}, ioutil.Discard))
+	require.Nil(t, run([]string{"identity", "issue", "-store", path, "-key", "c-key"}, ioutil.Discard))
+
+	for expected, args := range map[string][]string{
+		"a-key,b-key": {"-scope", "resource.action"},
+		"b-key":       {"-method", "HS512"},
+		"a-key":       {"-scope", "resource.action", "-method", "HS256"},
+	} {
+		var listed []admin.IdentityView
+		runJSON(t, &listed, append([]string{"identity", "list", "-store", path, "-format", "json"}, args...)...)
+
+		var keys []string
+		for _, view := range listed {
+			keys = append(keys, view.Key)
+		}
+
+		assert.Equal(t, expected, strings.Join(keys, ","))
+	}
+}
+
+func Test_Identity_Issue_Errors(t *testing.T) {
+	path, cleanup := tempStore(t)
+	defer cleanup()
+
+	err := run([]string{"identity", "issue", "-store", path, "-method", "RS256"}, ioutil.Discard)
+	assert.Equal(t, identity.ErrUnsupportedMethod, errors.Cause(err))
+
+	err = run([]string{"identity", "issue", "-unknown"}, ioutil.Discard)
+	assert.Equal(t, ErrUsage, errors.Cause(err))
+
+	err = run([]string{"identity", "unknown"}, ioutil.Discard)
+	assert.Equal(t, ErrUsage, errors.Cause(err))
+}
+
+func Test_Identity_FileStore(t *testing.T) {
+	path, cleanup := tempStore(t)
+	defer cleanup()
+
+	path = strings.TrimSuffix(path, ".yaml") + ".json"
+
+	var issued admin.IdentityView
+	runJSON(t, &issued, "identity", "issue", "-store", "file:"+path, "-key", "some-issuer-key", "-format", "json")
+
+	data, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+
+	var stored []map[string]interface{}
+	require.Nil(t, json.Unmarshal(data, &stored))
+	require.Len(t, stored, 1)
+	assert.Equal(t, "some-issuer-key", stored[0]["key"])
+	assert.Equal(t, string(issued.Secret), stored[0]["secret"])
+
+	var inspected admin.IdentityView
+	runJSON(t, &inspected, "identity", "inspect", "-store", "file:"+path, "-format", "json", "some-issuer-key")
+	assert.Equal(t, crypto.SigningMethodHS256, inspected.Method)
+
+	err = run([]string{"identity", "list", "-store", "file:" + strings.TrimSuffix(path, ".json") + ".ini"}, ioutil.Discard)
+	assert.Equal(t, file.ErrUnknownFormat, errors.Cause(err))
+}
+
+func Test_Identity_FileStore_Changes(t *testing.T) {
+	path, cleanup := tempStore(t)
+	defer cleanup()
+
+	s, err := openFileStore(path, nil)
+	require.Nil(t, err)
+	store := s.(*fileStore)
+
+	// operations which fail do not change the store
+	_, err = store.Issue(identity.IssueRequest{Method: "RS256"})
+	assert.Equal(t, identity.ErrUnsupportedMethod, errors.Cause(err))
+	assert.False(t, store.dirty)
+
+	_, err = store.Issue(identity.IssueRequest{Key: "some-issuer-key"})
+	require.Nil(t, err)
+	assert.True(t, store.dirty)
+
+	// changes are discarded when the command fails
+	failed := errors.New("command failed")
+	commitStore(store, &failed)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	var succeeded error
+	commitStore(store, &succeeded)
+	require.Nil(t, succeeded)
+
+	_, err = os.Stat(path)
+	assert.Nil(t, err)
+}
+
+func Test_Identity_Backends(t *testing.T) {
+	stored := memory.NewStorage(
+		memory.WithIssuePolicy(identity.IssuePolicy{Methods: []string{"HS512"}}),
+		memory.WithIdentities(identity.Identity{Key: "some-issuer-key", Secret: []byte("this is super secret"), Method: crypto.SigningMethodHS256}),
+	)
+
+	openStore = func(location string, _ secrets.KeyProvider) (identity.Fetcher, error) {
+		if location == "readonly:" {
+			return identity.FetcherFunc(stored.Fetch), nil
+		}
+
+		return stored, nil
+	}
+
+	defer func() { openStore = openFileStore }()
+
+	// identities are issued by the backend, subject to its issue policy
+	err := run([]string{"identity", "issue", "-store", "memory:", "-method", "HS256"}, ioutil.Discard)
+	assert.Equal(t, identity.ErrMethodNotAllowed, errors.Cause(err))
+
+	var issued admin.IdentityView
+	runJSON(t, &issued, "identity", "issue", "-store", "memory:", "-method", "HS512", "-format", "json")
+
+	var listed []admin.IdentityView
+	runJSON(t, &listed, "identity", "list", "-store", "memory:", "-format", "json")
+	assert.Len(t, listed, 2)
+
+	require.Nil(t, run([]string{"identity", "revoke", "-store", "memory:", issued.Key}, ioutil.Discard))
+
+	// backends only need to fetch identities, other commands require the optional interfaces
+	var inspected admin.IdentityView
+	runJSON(t, &inspected, "identity", "inspect", "-store", "readonly:", "-format", "json", "some-issuer-key")
+	assert.Equal(t, "some-issuer-key", inspected.Key)
+
+	for _, args := range [][]string{
+		{"identity", "issue", "-store", "readonly:"},
+		{"identity", "revoke", "-store", "readonly:", "some-issuer-key"},
+		{"identity", "list", "-store", "readonly:"},
+	} {
+		err := run(args, ioutil.Discard)
+		assert.Equal(t, ErrUnsupportedOperation, errors.Cause(err), strings.Join(args, " "))
+	}
+}
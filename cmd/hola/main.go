@@ -0,0 +1,89 @@
+// Command hola manages the identities used within hola authentication flows.
+//
+// Usage:
+//
+//	hola <group> <command> [flags] [args]
+//
+// Run hola without arguments to list the available commands.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrUsage is returned when the command line cannot be parsed.
+var ErrUsage = errors.New("usage")
+
+// command is a function which runs a subcommand with its arguments,
+// writing its output to out.
+type command func(args []string, out io.Writer) error
+
+// commands maps each group and command name to its implementation.
+var commands = map[string]map[string]command{
+	"identity": {
+		"issue":   issueIdentity,
+		"revoke":  revokeIdentity,
+		"list":    listIdentities,
+		"inspect": inspectIdentity,
+		"export":  exportIdentities,
+		"import":  importIdentities,
+	},
+	"token": {
+		"sign":   signToken,
+		"decode": decodeToken,
+		"verify": verifyToken,
+	},
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		if errors.Cause(err) == ErrUsage {
+			if err != ErrUsage {
+				fmt.Fprintln(os.Stderr, "hola:", err)
+			}
+
+			fmt.Fprintln(os.Stderr, usage())
+			os.Exit(2)
+		}
+
+		fmt.Fprintln(os.Stderr, "hola:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	if len(args) < 2 {
+		return ErrUsage
+	}
+
+	group, ok := commands[args[0]]
+	if !ok {
+		return errors.Wrapf(ErrUsage, "unknown group %q", args[0])
+	}
+
+	cmd, ok := group[args[1]]
+	if !ok {
+		return errors.Wrapf(ErrUsage, "unknown command %q", strings.Join(args[:2], " "))
+	}
+
+	return cmd(args[2:], out)
+}
+
+func usage() string {
+	var lines []string
+	for group, cmds := range commands {
+		for name := range cmds {
+			lines = append(lines, fmt.Sprintf("  hola %s %s", group, name))
+		}
+	}
+
+	sort.Strings(lines)
+
+	return "usage: hola <group> <command> [flags] [args]\n\ncommands:\n" + strings.Join(lines, "\n")
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/georgemac/hola/lib/admin"
+	"github.com/pkg/errors"
+	"gopkg.in/jose.v1/crypto"
+)
+
+// formatFlag is a flag which selects how output is rendered.
+type formatFlag string
+
+func (f *formatFlag) register(fs *flag.FlagSet) {
+	*f = "table"
+	fs.Var(f, "format", "output format, one of table or json")
+}
+
+func (f *formatFlag) String() string { return string(*f) }
+
+func (f *formatFlag) Set(value string) error {
+	switch value {
+	case "table", "json":
+		*f = formatFlag(value)
+		return nil
+	}
+
+	return errors.Errorf("unknown format %q", value)
+}
+
+// stringsFlag is a flag which can be repeated to build a slice of strings.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string { return strings.Join(*s, ",") }
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// formatTime returns the time in RFC 3339 format, or a dash when it is not set
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+// formatMethod returns the algorithm of the method, or a dash when it is not set
+func formatMethod(method crypto.SigningMethod) string {
+	if method == nil {
+		return "-"
+	}
+
+	return method.Alg()
+}
+
+// writeIdentities renders a list of identities in the requested format.
+// Views are rendered as JSON in the format of identity.Redacted.
+func writeIdentities(out io.Writer, format formatFlag, views []admin.IdentityView) error {
+	if format == "json" {
+		return writeJSON(out, views)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tMETHOD\tSCOPES\tOWNER\tCREATED\tEXPIRES\tDISABLED")
+	for _, view := range views {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%t\n",
+			view.Key,
+			formatMethod(view.Method),
+			strings.Join(view.Scopes, ","),
+			view.Owner,
+			formatTime(view.CreatedAt),
+			formatTime(view.ExpiresAt),
+			view.Disabled)
+	}
+
+	return w.Flush()
+}
+
+// writeIdentity renders a single identity in the requested format.
+// The secret is only rendered when it is set, as it is when an identity is first issued.
+func writeIdentity(out io.Writer, format formatFlag, view admin.IdentityView) error {
+	if format == "json" {
+		return writeJSON(out, view)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "key:\t%s\n", view.Key)
+	if view.Secret != nil {
+		fmt.Fprintf(w, "secret:\t%s\n", view.Secret)
+	}
+	fmt.Fprintf(w, "signing method:\t%s\n", formatMethod(view.Method))
+	fmt.Fprintf(w, "scopes:\t%s\n", strings.Join(view.Scopes, ","))
+	fmt.Fprintf(w, "owner:\t%s\n", view.Owner)
+	fmt.Fprintf(w, "description:\t%s\n", view.Description)
+	fmt.Fprintf(w, "created at:\t%s\n", formatTime(view.CreatedAt))
+	fmt.Fprintf(w, "expires at:\t%s\n", formatTime(view.ExpiresAt))
+	fmt.Fprintf(w, "disabled:\t%t\n", view.Disabled)
+
+	return w.Flush()
+}
+
+func writeJSON(out io.Writer, v interface{}) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/georgemac/hola/lib/secrets"
+	"github.com/georgemac/hola/lib/storage/file"
+	"github.com/pkg/errors"
+)
+
+// ErrUnsupportedOperation is returned when a command requires an operation the store does not implement.
+var ErrUnsupportedOperation = errors.New("operation not supported by store")
+
+// openStore opens the store at a location. Stores implement identity.Fetcher along
+// with any of the optional identity interfaces, such as identity.Issuer,
+// identity.Revoker and identity.Lister, and io.Closer when changes must be persisted.
+// Locations are files, see file.NewLocation.
+var openStore = openFileStore
+
+// storeFlags are the flags shared by every command which operates on a store.
+type storeFlags struct {
+	location      string
+	masterKeyEnv  string
+	masterKeyFile string
+}
+
+func (s *storeFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&s.location, "store", "identities.yaml", "identity store location in the form [scheme:]location")
+	fs.StringVar(&s.masterKeyEnv, "master-key-env", "", "environment variable containing the base64 master key for encrypted secrets")
+	fs.StringVar(&s.masterKeyFile, "master-key-file", "", "file containing the base64 master key for encrypted secrets")
+}
+
+func (s *storeFlags) open() (identity.Fetcher, error) {
+	keys, err := keyProvider(s.masterKeyEnv, s.masterKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return openStore(s.location, keys)
+}
+
+// closeStore persists any changes made to the store, if it is an io.Closer.
+func closeStore(s identity.Fetcher) error {
+	if closer, ok := s.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// commitStore closes the store once a command which changes it has returned,
+// setting *err when the changes cannot be persisted. The store is not closed when
+// the command returned an error, so the changes of a failed command are discarded.
+func commitStore(s identity.Fetcher, err *error) {
+	if *err != nil {
+		return
+	}
+
+	*err = closeStore(s)
+}
+
+// issuer returns the store as an identity.Issuer, or an error if it is not one.
+func issuer(s identity.Fetcher) (identity.Issuer, error) {
+	issuer, ok := s.(identity.Issuer)
+	if !ok {
+		return nil, errors.Wrap(ErrUnsupportedOperation, "issue")
+	}
+
+	return issuer, nil
+}
+
+// revoker returns the store as an identity.Revoker, or an error if it is not one.
+func revoker(s identity.Fetcher) (identity.Revoker, error) {
+	revoker, ok := s.(identity.Revoker)
+	if !ok {
+		return nil, errors.Wrap(ErrUnsupportedOperation, "revoke")
+	}
+
+	return revoker, nil
+}
+
+// lister returns the store as an identity.Lister, or an error if it is not one.
+func lister(s identity.Fetcher) (identity.Lister, error) {
+	lister, ok := s.(identity.Lister)
+	if !ok {
+		return nil, errors.Wrap(ErrUnsupportedOperation, "list")
+	}
+
+	return lister, nil
+}
+
+// keyProvider returns the master key read from the environment variable or file,
+// or nil when neither is set.
+func keyProvider(env, file string) (secrets.KeyProvider, error) {
+	switch {
+	case env != "":
+		return secrets.FromEnv(env)
+	case file != "":
+		return secrets.FromFile(file)
+	}
+
+	return nil, nil
+}
+
+// fileStore is a file.Storage which is written back to its file
+// when closed if it has changed.
+type fileStore struct {
+	*file.Storage
+	dirty bool
+}
+
+func openFileStore(location string, keys secrets.KeyProvider) (identity.Fetcher, error) {
+	var opts []file.Option
+	if keys != nil {
+		opts = append(opts, file.WithKeyProvider(keys))
+	}
+
+	storage, err := file.NewLocation(location, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// a missing file is an empty store, created on first write
+	if err := storage.ReadFile(); err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return nil, err
+	}
+
+	return &fileStore{Storage: storage}, nil
+}
+
+func (f *fileStore) Issue(req identity.IssueRequest) (identity.Identity, error) {
+	id, err := f.Storage.Issue(req)
+	if err != nil {
+		return identity.Identity{}, err
+	}
+
+	f.dirty = true
+	return id, nil
+}
+
+func (f *fileStore) Put(id identity.Identity) error {
+	if err := f.Storage.Put(id); err != nil {
+		return err
+	}
+
+	f.dirty = true
+	return nil
+}
+
+func (f *fileStore) Revoke(key string) error {
+	if err := f.Storage.Revoke(key); err != nil {
+		return err
+	}
+
+	f.dirty = true
+	return nil
+}
+
+// Close writes the store to its file, if it has changed.
+func (f *fileStore) Close() error {
+	if !f.dirty {
+		return nil
+	}
+
+	return f.WriteFile()
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/georgemac/hola/lib/auth"
+	"github.com/georgemac/hola/lib/secrets"
+	"github.com/georgemac/hola/lib/signer"
+	"github.com/pkg/errors"
+	"gopkg.in/jose.v1/crypto"
+	"gopkg.in/jose.v1/jws"
+)
+
+var (
+	// ErrMalformedToken is returned when a token is not a compact serialized JWT.
+	ErrMalformedToken = errors.New("token is malformed")
+
+	// ErrMalformedClaim is returned when a custom claim is not in the form key=value.
+	ErrMalformedClaim = errors.New("claim must be in the form key=value")
+)
+
+// stdin is the reader tokens are read from when not provided as an argument
+var stdin io.Reader = os.Stdin
+
+// timeClaims are the registered claims which hold NumericDate values
+var timeClaims = map[string]struct{}{"exp": {}, "nbf": {}, "iat": {}}
+
+func signToken(args []string, out io.Writer) error {
+	var (
+		fs       = newFlagSet("token sign")
+		stores   storeFlags
+		audience stringsFlag
+		scopes   stringsFlag
+		claims   stringsFlag
+		key      = fs.String("identity", "", "key of the identity in the store to sign with, also used as the default issuer")
+		secret   = fs.String("secret", "", "secret to sign with when no identity is provided, may be a secret reference")
+		method   = fs.String("method", "HS256", "signing method to use when no identity is provided")
+		sub      = fs.String("sub", "", "subject claim")
+		iss      = fs.String("iss", "", "issuer claim")
+		exp      = fs.Duration("exp", 5*time.Minute, "duration until the token expires")
+	)
+
+	stores.register(fs)
+	fs.Var(&audience, "aud", "audience claim, can be repeated")
+	fs.Var(&scopes, "scope", "scope claim, can be repeated")
+	fs.Var(&claims, "claim", "custom claim in the form key=value, values are parsed as JSON where possible, can be repeated")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	var (
+		signingKey    []byte
+		signingMethod crypto.SigningMethod
+		opts          = []signer.Option{signer.WithFlatClaims(), signer.WithExpiration(*exp)}
+	)
+
+	switch {
+	case *key != "":
+		s, err := stores.open()
+		if err != nil {
+			return err
+		}
+
+		defer closeStore(s)
+
+		id, ok, err := s.Fetch(*key)
+		if err != nil {
+			return err
+		} else if !ok {
+			return errors.Wrapf(ErrIdentityNotFound, "key %q", *key)
+		}
+
+		signingKey, signingMethod = id.Secret, id.Method
+		if *iss == "" {
+			*iss = id.Key
+		}
+	case *secret != "":
+		resolved, err := secrets.Resolve(*secret)
+		if err != nil {
+			return err
+		}
+
+		signingKey, signingMethod = resolved, jws.GetSigningMethod(*method)
+		if signingMethod == nil {
+			return errors.Errorf("unknown signing method %q", *method)
+		}
+	default:
+		return errors.Wrap(ErrUsage, "token sign: one of -identity or -secret is required")
+	}
+
+	if *sub != "" {
+		opts = append(opts, signer.WithSubject(*sub))
+	}
+
+	if *iss != "" {
+		opts = append(opts, signer.WithIssuer(*iss))
+	}
+
+	if len(audience) > 0 {
+		opts = append(opts, signer.WithAudience(audience...))
+	}
+
+	if len(scopes) > 0 {
+		opts = append(opts, signer.WithScopes(scopes...))
+	}
+
+	custom := map[string]interface{}{}
+	for _, claim := range claims {
+		parts := strings.SplitN(claim, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return errors.Wrapf(ErrMalformedClaim, "found %q", claim)
+		}
+
+		var value interface{}
+		if err := json.Unmarshal([]byte(parts[1]), &value); err != nil {
+			value = parts[1]
+		}
+
+		custom[parts[0]] = value
+	}
+
+	token, err := signer.New(signingMethod, opts...).SignClaims(custom)
+	if err != nil {
+		return err
+	}
+
+	serialized, err := token.Serialize(signingKey)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(out, "%s\n", serialized)
+	return err
+}
+
+// decodedToken is the representation of an unverified token rendered by the CLI.
+type decodedToken struct {
+	Header map[string]interface{} `json:"header"`
+	Claims map[string]interface{} `json:"claims"`
+	// Times contains the time based claims in RFC3339 format
+	Times map[string]string `json:"times,omitempty"`
+}
+
+func decodeToken(args []string, out io.Writer) error {
+	var (
+		fs     = newFlagSet("token decode")
+		format formatFlag
+	)
+
+	format.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return errors.Wrapf(ErrUsage, "%s: %s", fs.Name(), err.Error())
+	}
+
+	raw, err := readToken(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	parts := strings.Split(string(raw), ".")
+	if len(parts) != 3 {
+		return errors.Wrapf(ErrMalformedToken, "expected 3 parts found %d", len(parts))
+	}
+
+	decoded := decodedToken{Times: map[string]string{}}
+	if err := decodeSegment(parts[0], &decoded.Header); err != nil {
+		return errors.Wrap(err, "header")
+	}
+
+	if err := decodeSegment(parts[1], &decoded.Claims); err != nil {
+		return errors.Wrap(err, "claims")
+	}
+
+	for key := range timeClaims {
+		if number, ok := decoded.Claims[key].(json.Number); ok {
+			if seconds, err := number.Int64(); err == nil {
+				decoded.Times[key] = time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+			}
+		}
+	}
+
+	if format == "json" {
+		return writeJSON(out, decoded)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "header:")
+	writeFields(w, decoded.Header, nil)
+	fmt.Fprintln(w, "claims:")
+	writeFields(w, decoded.Claims, decoded.Times)
+
+	return w.Flush()
+}
+
+// writeFields writes each field ordered by key, annotating values with their entry in times
+func writeFields(w io.Writer, fields map[string]interface{}, times map[string]string) {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := fields[key]
+		rendered, ok := value.(string)
+		if !ok {
+			data, _ := json.Marshal(value)
+			rendered = string(data)
+		}
+
+		if t, ok := times[key]; ok {
+			rendered = fmt.Sprintf("%s (%s)", rendered, t)
+		}
+
+		fmt.Fprintf(w, "  %s\t%s\n", key, rendered)
+	}
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return errors.Wrap(ErrMalformedToken, err.Error())
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return errors.Wrap(ErrMalformedToken, err.Error())
+	}
+
+	return nil
+}
+
+// verification is the representation of a verified token rendered by the CLI.
+type verification struct {
+	Valid  bool     `json:"valid"`
+	Issuer string   `json:"issuer"`
+	Scopes []string `json:"scopes"`
+}
+
+func verifyToken(args []string, out io.Writer) error {
+	var (
+		fs        = newFlagSet("token verify")
+		stores    storeFlags
+		format    formatFlag
+		audiences stringsFlag
+		issuers   stringsFlag
+		required  stringsFlag
+		subject   = fs.String("subject", "", "require the subject claim to match")
+	)
+
+	stores.register(fs)
+	format.register(fs)
+	fs.Var(&audiences, "audience", "accepted audience, can be repeated")
+	fs.Var(&issuers, "issuer", "accepted issuer, can be repeated")
+	fs.Var(&required, "require-claim", "claim which must be present, can be repeated")
+	if err := fs.Parse(args); err != nil {
+		return errors.Wrapf(ErrUsage, "%s: %s", fs.Name(), err.Error())
+	}
+
+	raw, err := readToken(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	token, err := jws.ParseJWT(raw)
+	if err != nil {
+		return errors.Wrap(ErrMalformedToken, err.Error())
+	}
+
+	var opts []auth.Option
+	if len(audiences) > 0 {
+		opts = append(opts, auth.WithAudiences(audiences...))
+	}
+
+	if len(issuers) > 0 {
+		opts = append(opts, auth.WithIssuers(issuers...))
+	}
+
+	if len(required) > 0 {
+		opts = append(opts, auth.WithPolicy(auth.RequireClaims(required...)))
+	}
+
+	if *subject != "" {
+		opts = append(opts, auth.WithSubject(*subject))
+	}
+
+	s, err := stores.open()
+	if err != nil {
+		return err
+	}
+
+	defer closeStore(s)
+
+	scopes, err := auth.New(s, opts...).Validate(token)
+	if err != nil {
+		return err
+	}
+
+	result := verification{Valid: true, Scopes: scopes}
+	result.Issuer, _ = token.Claims().Issuer()
+	if result.Scopes == nil {
+		result.Scopes = []string{}
+	}
+
+	if format == "json" {
+		return writeJSON(out, result)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "valid:\t%t\n", result.Valid)
+	fmt.Fprintf(w, "issuer:\t%s\n", result.Issuer)
+	fmt.Fprintf(w, "scopes:\t%s\n", strings.Join(result.Scopes, ","))
+
+	return w.Flush()
+}
+
+// readToken returns the token from the single argument, or from stdin when
+// no argument or "-" is provided.
+func readToken(args []string) ([]byte, error) {
+	switch {
+	case len(args) > 1:
+		return nil, errors.Wrapf(ErrUsage, "expected a single token found %d arguments", len(args))
+	case len(args) == 1 && args[0] != "-":
+		return []byte(strings.TrimSpace(args[0])), nil
+	}
+
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if line = strings.TrimSpace(line); line == "" {
+		return nil, errors.Wrap(ErrMalformedToken, "no token provided")
+	}
+
+	return []byte(line), nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/georgemac/hola/lib/auth"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sign(t *testing.T, args ...string) string {
+	var out bytes.Buffer
+	require.Nil(t, run(append([]string{"token", "sign"}, args...), &out))
+	return strings.TrimSpace(out.String())
+}
+
+func Test_Token_Sign_Verify(t *testing.T) {
+	path, cleanup := tempStore(t)
+	defer cleanup()
+
+	require.Nil(t, run([]string{"identity", "issue", "-store", path, "-key", "some-issuer-key",
+		"-scope", "resource.action", "-scope", "other.action"}, ioutil.Discard))
+
+	token := sign(t, "-store", path, "-identity", "some-issuer-key",
+		"-aud", "test.audience.com", "-scope", "resource.action", "-claim", "team=platform")
+
+	var result verification
+	runJSON(t, &result, "token", "verify", "-store", path, "-format", "json",
+		"-audience", "test.audience.com", "-require-claim", "team", token)
+	assert.Equal(t, verification{
+		Valid:  true,
+		Issuer: "some-issuer-key",
+		Scopes: []string{"resource.action"},
+	}, result)
+
+	// token read from stdin
+	stdin = strings.NewReader(token + "\n")
+	var out bytes.Buffer
+	require.Nil(t, run([]string{"token", "verify", "-store", path}, &out))
+	assert.Contains(t, out.String(), "valid:   true")
+
+	// exact failure reasons are returned
+	err := run([]string{"token", "verify", "-store", path, "-audience", "other.audience.com", token}, ioutil.Discard)
+	assert.Equal(t, auth.ErrAudienceNotAllowed, errors.Cause(err))
+	assert.EqualError(t, err, "authentication: found [test.audience.com]: audience not allowed")
+
+	unauthorized := sign(t, "-store", path, "-identity", "some-issuer-key", "-scope", "admin")
+	err = run([]string{"token", "verify", "-store", path, unauthorized}, ioutil.Discard)
+	assert.Equal(t, auth.ErrScopesUnauthorized, errors.Cause(err))
+
+	forged := sign(t, "-secret", "not the secret", "-iss", "some-issuer-key")
+	err = run([]string{"token", "verify", "-store", path, forged}, ioutil.Discard)
+	assert.EqualError(t, err, "authentication: token is invalid: signature is invalid")
+}
+
+func Test_Token_Decode(t *testing.T) {
+	// {"alg":"HS256","typ":"JWT"}.{"exp":1500000300,"iat":1500000000,"iss":"some-issuer-key","scopes":["resource.action"]}
+	token := "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9." +
+		"eyJleHAiOjE1MDAwMDAzMDAsImlhdCI6MTUwMDAwMDAwMCwiaXNzIjoic29tZS1pc3N1ZXIta2V5Iiwic2NvcGVzIjpbInJlc291cmNlLmFjdGlvbiJdfQ." +
+		"c2lnbmF0dXJl"
+
+	var out bytes.Buffer
+	require.Nil(t, run([]string{"token", "decode", token}, &out))
+	assert.Equal(t, `header:
+  alg  HS256
+  typ  JWT
+claims:
+  exp     1500000300 (2017-07-14T02:45:00Z)
+  iat     1500000000 (2017-07-14T02:40:00Z)
+  iss     some-issuer-key
+  scopes  ["resource.action"]
+`, out.String())
+
+	var decoded decodedToken
+	runJSON(t, &decoded, "token", "decode", "-format", "json", token)
+	assert.Equal(t, "HS256", decoded.Header["alg"])
+	assert.Equal(t, "some-issuer-key", decoded.Claims["iss"])
+	assert.Equal(t, map[string]string{
+		"exp": "2017-07-14T02:45:00Z",
+		"iat": "2017-07-14T02:40:00Z",
+	}, decoded.Times)
+
+	err := run([]string{"token", "decode", "not.a-token"}, ioutil.Discard)
+	assert.Equal(t, ErrMalformedToken, errors.Cause(err))
+}
+
+func Test_Token_Sign_Errors(t *testing.T) {
+	err := run([]string{"token", "sign"}, ioutil.Discard)
+	assert.Equal(t, ErrUsage, errors.Cause(err))
+
+	err = run([]string{"token", "sign", "-secret", "some secret", "-claim", "novalue"}, ioutil.Discard)
+	assert.Equal(t, ErrMalformedClaim, errors.Cause(err))
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/georgemac/hola/lib/storage/transfer"
+	"github.com/pkg/errors"
+)
+
+// archiveFlags are the flags shared by commands which write or read archives.
+type archiveFlags struct {
+	keyEnv  string
+	keyFile string
+}
+
+func (a *archiveFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&a.keyEnv, "archive-key-env", "", "environment variable containing the base64 key used to encrypt secrets within the archive")
+	fs.StringVar(&a.keyFile, "archive-key-file", "", "file containing the base64 key used to encrypt secrets within the archive")
+}
+
+// options returns the transfer options for the archive format and key
+func (a *archiveFlags) options(format transfer.Format) ([]transfer.Option, error) {
+	opts := []transfer.Option{transfer.WithFormat(format)}
+
+	keys, err := keyProvider(a.keyEnv, a.keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if keys != nil {
+		opts = append(opts, transfer.WithKeyProvider(keys))
+	}
+
+	return opts, nil
+}
+
+func exportIdentities(args []string, out io.Writer) error {
+	var (
+		fs       = newFlagSet("identity export")
+		stores   storeFlags
+		archives archiveFlags
+		format   = fs.String("format", "yaml", "archive format, one of yaml or json")
+	)
+
+	stores.register(fs)
+	archives.register(fs)
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	archiveFormat, err := transfer.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	opts, err := archives.options(archiveFormat)
+	if err != nil {
+		return err
+	}
+
+	s, err := stores.open()
+	if err != nil {
+		return err
+	}
+
+	defer closeStore(s)
+
+	l, err := lister(s)
+	if err != nil {
+		return err
+	}
+
+	archive, err := transfer.Export(l)
+	if err != nil {
+		return err
+	}
+
+	return transfer.Write(out, archive, opts...)
+}
+
+func importIdentities(args []string, out io.Writer) (err error) {
+	var (
+		fs         = newFlagSet("identity import")
+		stores     storeFlags
+		archives   archiveFlags
+		format     formatFlag
+		onConflict = fs.String("on-conflict", "fail", "how to treat existing identities which differ, one of skip, overwrite or fail")
+		dryRun     = fs.Bool("dry-run", false, "report the changes without making them")
+	)
+
+	stores.register(fs)
+	archives.register(fs)
+	format.register(fs)
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	policy, err := transfer.ParseConflictPolicy(*onConflict)
+	if err != nil {
+		return err
+	}
+
+	// archives are json when named as such and yaml otherwise
+	archiveFormat := transfer.YAML
+	if strings.EqualFold(filepath.Ext(fs.Arg(0)), ".json") {
+		archiveFormat = transfer.JSON
+	}
+
+	opts, err := archives.options(archiveFormat)
+	if err != nil {
+		return err
+	}
+
+	var in io.Reader = stdin
+	if fs.Arg(0) != "-" {
+		fi, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+
+		defer fi.Close()
+		in = fi
+	}
+
+	archive, err := transfer.Read(in, opts...)
+	if err != nil {
+		return err
+	}
+
+	s, err := stores.open()
+	if err != nil {
+		return err
+	}
+
+	defer commitStore(s, &err)
+
+	target, ok := s.(transfer.Store)
+	if !ok {
+		return errors.Wrap(ErrUnsupportedOperation, "import")
+	}
+
+	opts = append(opts, transfer.WithConflictPolicy(policy))
+	if *dryRun {
+		opts = append(opts, transfer.WithDryRun())
+	}
+
+	report, err := transfer.Import(target, archive, opts...)
+	if werr := writeReport(out, format, report); err == nil {
+		err = werr
+	}
+
+	return err
+}
+
+// writeReport renders an import report in the requested format.
+func writeReport(out io.Writer, format formatFlag, report transfer.Report) error {
+	if format == "json" {
+		return writeJSON(out, report)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tACTION\tFIELDS")
+	for _, change := range report.Changes {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", change.Key, change.Action, strings.Join(change.Fields, ","))
+	}
+
+	if report.DryRun {
+		fmt.Fprintln(w, "dry run, no changes made")
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/georgemac/hola/lib/admin"
+	"github.com/georgemac/hola/lib/storage/transfer"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Identity_Export_Import(t *testing.T) {
+	source, cleanup := tempStore(t)
+	defer cleanup()
+
+	target := filepath.Join(filepath.Dir(source), "target.yaml")
+	archive := filepath.Join(filepath.Dir(source), "archive.json")
+	keyFile := filepath.Join(filepath.Dir(source), "archive.key")
+	require.Nil(t, ioutil.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))), 0600))
+
+	var issued admin.IdentityView
+	runJSON(t, &issued, "identity", "issue", "-store", source, "-key", "first", "-scope", "resource.action", "-format", "json")
+	runJSON(t, &issued, "identity", "issue", "-store", source, "-key", "second", "-format", "json")
+
+	// export with encrypted secrets
+	var out bytes.Buffer
+	require.Nil(t, run([]string{"identity", "export", "-store", source, "-format", "json", "-archive-key-file", keyFile}, &out))
+	assert.NotContains(t, out.String(), string(issued.Secret))
+	require.Nil(t, ioutil.WriteFile(archive, out.Bytes(), 0600))
+
+	// the archive cannot be read without its key
+	err := run([]string{"identity", "import", "-store", target, archive}, ioutil.Discard)
+	assert.Equal(t, transfer.ErrKeyProviderMissing, errors.Cause(err))
+
+	// dry run
+	var report transfer.Report
+	runJSON(t, &report, "identity", "import", "-store", target, "-archive-key-file", keyFile, "-dry-run", "-format", "json", archive)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 2, report.Count(transfer.Create))
+
+	_, err = os.Stat(target)
+	assert.True(t, os.IsNotExist(err))
+
+	// import
+	runJSON(t, &report, "identity", "import", "-store", target, "-archive-key-file", keyFile, "-format", "json", archive)
+	assert.False(t, report.DryRun)
+	assert.Equal(t, 2, report.Count(transfer.Create))
+
+	var views []admin.IdentityView
+	runJSON(t, &views, "identity", "list", "-store", target, "-format", "json")
+	require.Len(t, views, 2)
+	assert.Equal(t, []string{"resource.action"}, views[0].Scopes)
+
+	// conflicting identities fail the import by default
+	require.Nil(t, run([]string{"identity", "revoke", "-store", target, "second"}, ioutil.Discard))
+	runJSON(t, &issued, "identity", "issue", "-store", target, "-key", "second", "-format", "json")
+
+	out.Reset()
+	err = run([]string{"identity", "import", "-store", target, "-archive-key-file", keyFile, archive}, &out)
+	assert.Equal(t, transfer.ErrConflict, errors.Cause(err))
+	assert.Equal(t, `KEY     ACTION     FIELDS
+first   unchanged  
+second  conflict   secret
+`, out.String())
+
+	runJSON(t, &report, "identity", "import", "-store", target, "-archive-key-file", keyFile,
+		"-on-conflict", "overwrite", "-format", "json", archive)
+	assert.Equal(t, []transfer.Change{
+		{Key: "first", Action: transfer.Unchanged},
+		{Key: "second", Action: transfer.Update, Fields: []string{"secret"}},
+	}, report.Changes)
+}
@@ -0,0 +1,399 @@
+// Package admin implements an HTTP API for managing identities, as an
+// alternative to editing identity storage by hand.
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/georgemac/hola/lib/auth"
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/georgemac/hola/lib/middleware"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrIdentityNotFound is returned when an identity does not exist within the store.
+	ErrIdentityNotFound = errors.New("identity not found")
+
+	// ErrInvalidRequest is returned when a request body cannot be used.
+	ErrInvalidRequest = errors.New("invalid request")
+
+	// ErrMethodNotAllowed is returned when a resource does not support the request method.
+	ErrMethodNotAllowed = errors.New("method not allowed")
+
+	// ErrScopeRequired is returned when the token of a request does not contain the admin scope.
+	ErrScopeRequired = middleware.ErrScopesMissing
+)
+
+// defaultLimit is the page size of list requests without a limit
+const defaultLimit = 100
+
+// Store is the set of storage operations the API is built upon.
+type Store interface {
+	identity.Fetcher
+	identity.Issuer
+	identity.Revoker
+	identity.Lister
+	identity.Updater
+	identity.Rotator
+}
+
+// Handler is an implementation of net/http.Handler which serves the identity API.
+// It does not authenticate requests itself, see New.
+//
+//	GET    /identities             list identities, see ListResponse
+//	POST   /identities             issue an identity
+//	GET    /identities/{key}        get an identity
+//	PATCH  /identities/{key}        update the scopes or method of an identity
+//	DELETE /identities/{key}        revoke an identity
+//	POST   /identities/{key}/rotate rotate the secret of an identity
+//
+// Rotate requests may retain the previous secret for verification with
+// the grace query parameter, a duration such as 24h.
+//
+// Secrets are only ever included in responses to issue and rotate requests.
+type Handler struct {
+	store Store
+}
+
+// NewHandler returns a Handler which manages identities within the store.
+func NewHandler(store Store) *Handler {
+	return &Handler{store: store}
+}
+
+// New returns the identity API for the store, protected by middleware.HTTP using
+// the provided Authenticator. Requests must present a token containing scope.
+func New(store Store, authenticator *auth.Authenticator, scope string) *middleware.HTTP {
+	return middleware.New(middleware.RequireScope(scope, NewHandler(store), middleware.WithErrorWriter(writeStatusError)), authenticator)
+}
+
+// IdentityView is the representation of an identity within responses, which is
+// that of identity.Redacted along with the secret in responses to issue and rotate requests.
+type IdentityView struct {
+	identity.Redacted
+	// Secret is only set when an identity is issued or its secret rotated
+	Secret []byte
+}
+
+// MarshalJSON marshals the view as identity.Redacted, with the secret when it is set.
+// Retired secrets are never included.
+func (v IdentityView) MarshalJSON() ([]byte, error) {
+	if v.Secret == nil {
+		return json.Marshal(v.Redacted)
+	}
+
+	id := identity.Identity(v.Redacted)
+	id.Secret = v.Secret
+	if id.Retired != nil {
+		id.Retired = &identity.RetiredSecret{ExpiresAt: id.Retired.ExpiresAt}
+	}
+
+	return json.Marshal(id)
+}
+
+// UnmarshalJSON parses views in the format produced by MarshalJSON.
+func (v *IdentityView) UnmarshalJSON(data []byte) error {
+	var id identity.Portable
+	if err := json.Unmarshal(data, &id); err != nil {
+		return err
+	}
+
+	*v = IdentityView{Redacted: identity.Redacted(id)}
+	if len(id.Secret) > 0 {
+		v.Secret = id.Secret
+	}
+
+	v.Redacted.Secret = nil
+	if v.Retired != nil {
+		v.Retired = &identity.RetiredSecret{ExpiresAt: v.Retired.ExpiresAt}
+	}
+
+	return nil
+}
+
+// IssueRequest is the body of a request to issue an identity.
+type IssueRequest struct {
+	Scopes       []string   `json:"scopes"`
+	Method       string     `json:"signing_method"`
+	KeyPrefix    string     `json:"key_prefix"`
+	SecretLength int        `json:"secret_length"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	Owner        string     `json:"owner"`
+	Description  string     `json:"description"`
+}
+
+// ListResponse is the body of a response to a list request. Requests may filter
+// identities with the scope and method query parameters, and page through them
+// with the limit and cursor parameters, where cursor is the next_cursor of the previous page.
+type ListResponse struct {
+	Identities []IdentityView `json:"identities"`
+	Next       string         `json:"next_cursor,omitempty"`
+}
+
+// UpdateRequest is the body of a request to update an identity.
+// Scopes replaces the scopes of the identity, before AddScopes and
+// RemoveScopes are applied. At least one change must be requested.
+type UpdateRequest struct {
+	Scopes       []string `json:"scopes,omitempty"`
+	AddScopes    []string `json:"add_scopes,omitempty"`
+	RemoveScopes []string `json:"remove_scopes,omitempty"`
+	Method       string   `json:"signing_method,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// ServeHTTP routes requests to the identity resources.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var (
+		parts  = strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		status = http.StatusOK
+		resp   interface{}
+		err    error
+	)
+
+	switch {
+	case len(parts) == 1 && parts[0] == "identities":
+		switch r.Method {
+		case http.MethodGet:
+			resp, err = h.list(r)
+		case http.MethodPost:
+			status = http.StatusCreated
+			resp, err = h.issue(r)
+		default:
+			err = methodNotAllowed(w, "GET, POST")
+		}
+	case len(parts) == 2 && parts[0] == "identities":
+		switch r.Method {
+		case http.MethodGet:
+			resp, err = h.get(parts[1])
+		case http.MethodPatch:
+			resp, err = h.update(parts[1], r)
+		case http.MethodDelete:
+			status, err = http.StatusNoContent, h.revoke(parts[1])
+		default:
+			err = methodNotAllowed(w, "GET, PATCH, DELETE")
+		}
+	case len(parts) == 3 && parts[0] == "identities" && parts[2] == "rotate":
+		if r.Method != http.MethodPost {
+			err = methodNotAllowed(w, "POST")
+			break
+		}
+
+		resp, err = h.rotate(parts[1], r)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if status == http.StatusCreated {
+		w.Header().Set("Location", "identities/"+resp.(IdentityView).Key)
+	}
+
+	writeJSON(w, status, resp)
+}
+
+func (h *Handler) list(r *http.Request) (ListResponse, error) {
+	query := r.URL.Query()
+	opts := identity.ListOptions{
+		Cursor: query.Get("cursor"),
+		Limit:  defaultLimit,
+		Scope:  query.Get("scope"),
+		Method: query.Get("method"),
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		var err error
+		if opts.Limit, err = strconv.Atoi(limit); err != nil || opts.Limit < 1 {
+			return ListResponse{}, errors.Wrapf(ErrInvalidRequest, "limit %q", limit)
+		}
+	}
+
+	page, err := h.store.List(opts)
+	if err != nil {
+		return ListResponse{}, err
+	}
+
+	resp := ListResponse{Identities: make([]IdentityView, 0, len(page.Identities)), Next: page.Next}
+	for _, id := range page.Identities {
+		resp.Identities = append(resp.Identities, IdentityView{Redacted: identity.Redacted(id)})
+	}
+
+	return resp, nil
+}
+
+func (h *Handler) get(key string) (IdentityView, error) {
+	id, ok, err := h.store.Fetch(key)
+	if err != nil {
+		return IdentityView{}, err
+	} else if !ok {
+		return IdentityView{}, errors.Wrapf(ErrIdentityNotFound, "key %q", key)
+	}
+
+	return IdentityView{Redacted: identity.Redacted(id)}, nil
+}
+
+func (h *Handler) issue(r *http.Request) (IdentityView, error) {
+	var req IssueRequest
+	if err := decode(r, &req); err != nil {
+		return IdentityView{}, err
+	}
+
+	issue := identity.IssueRequest{
+		Scopes:       req.Scopes,
+		Method:       req.Method,
+		KeyPrefix:    req.KeyPrefix,
+		SecretLength: req.SecretLength,
+		Owner:        req.Owner,
+		Description:  req.Description,
+	}
+
+	if req.ExpiresAt != nil {
+		issue.ExpiresAt = *req.ExpiresAt
+	}
+
+	id, err := h.store.Issue(issue)
+	if err != nil {
+		return IdentityView{}, err
+	}
+
+	// the secret is only ever rendered on issue and rotate
+	return IdentityView{Redacted: identity.Redacted(id), Secret: id.Secret}, nil
+}
+
+func (h *Handler) update(key string, r *http.Request) (IdentityView, error) {
+	var req UpdateRequest
+	if err := decode(r, &req); err != nil {
+		return IdentityView{}, err
+	}
+
+	var updates []func(*identity.Identity) error
+	if req.Scopes != nil {
+		updates = append(updates, identity.SetScopes(req.Scopes...))
+	}
+
+	if len(req.AddScopes) > 0 {
+		updates = append(updates, identity.AddScopes(req.AddScopes...))
+	}
+
+	if len(req.RemoveScopes) > 0 {
+		updates = append(updates, identity.RemoveScopes(req.RemoveScopes...))
+	}
+
+	if req.Method != "" {
+		method, err := identity.ParseMethod(req.Method)
+		if err != nil {
+			return IdentityView{}, err
+		}
+
+		updates = append(updates, identity.SetMethod(method))
+	}
+
+	if len(updates) == 0 {
+		return IdentityView{}, errors.Wrap(ErrInvalidRequest, "no changes requested")
+	}
+
+	id, ok, err := h.store.Update(key, identity.Updates(updates...))
+	if err != nil {
+		return IdentityView{}, err
+	} else if !ok {
+		return IdentityView{}, errors.Wrapf(ErrIdentityNotFound, "key %q", key)
+	}
+
+	return IdentityView{Redacted: identity.Redacted(id)}, nil
+}
+
+func (h *Handler) revoke(key string) error {
+	if _, ok, err := h.store.Fetch(key); err != nil {
+		return err
+	} else if !ok {
+		return errors.Wrapf(ErrIdentityNotFound, "key %q", key)
+	}
+
+	return h.store.Revoke(key)
+}
+
+func (h *Handler) rotate(key string, r *http.Request) (IdentityView, error) {
+	var grace time.Duration
+	if value := r.URL.Query().Get("grace"); value != "" {
+		var err error
+		if grace, err = time.ParseDuration(value); err != nil || grace < 0 {
+			return IdentityView{}, errors.Wrapf(ErrInvalidRequest, "grace %q", value)
+		}
+	}
+
+	id, ok, err := h.store.Rotate(key, grace)
+	if err != nil {
+		return IdentityView{}, err
+	} else if !ok {
+		return IdentityView{}, errors.Wrapf(ErrIdentityNotFound, "key %q", key)
+	}
+
+	return IdentityView{Redacted: identity.Redacted(id), Secret: id.Secret}, nil
+}
+
+// decode decodes the JSON body of the request into v
+func decode(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(v); err != nil {
+		return errors.Wrap(ErrInvalidRequest, err.Error())
+	}
+
+	return nil
+}
+
+func methodNotAllowed(w http.ResponseWriter, allow string) error {
+	w.Header().Set("Allow", allow)
+	return ErrMethodNotAllowed
+}
+
+// writeError renders err with a status code derived from its cause.
+// Internal errors are not described to clients.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch errors.Cause(err) {
+	case ErrIdentityNotFound:
+		status = http.StatusNotFound
+	case ErrInvalidRequest, identity.ErrInvalidCursor, identity.ErrUnsupportedMethod,
+		identity.ErrMethodNotAllowed, identity.ErrScopeNotAllowed, identity.ErrSecretTooShort,
+		identity.ErrSecretTooLong, identity.ErrLifetimeNotAllowed:
+		status = http.StatusBadRequest
+	case ErrMethodNotAllowed:
+		status = http.StatusMethodNotAllowed
+	case ErrScopeRequired:
+		status = http.StatusForbidden
+	default:
+		err = errors.New(http.StatusText(status))
+	}
+
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+// writeStatusError is a middleware.ErrorWriter which renders errors with writeError
+func writeStatusError(w http.ResponseWriter, err error, _ int) {
+	writeError(w, err)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Cache-Control", "no-store")
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,250 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/georgemac/hola/lib/auth"
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/georgemac/hola/lib/signer"
+	"github.com/georgemac/hola/lib/storage/yaml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/jose.v1/crypto"
+)
+
+var admin = identity.Identity{
+	Key:    "admin-key",
+	Secret: []byte("this is super secret"),
+	Method: crypto.SigningMethodHS256,
+	Scopes: []string{"hola.admin", "resource.action"},
+}
+
+type client struct {
+	t       *testing.T
+	handler http.Handler
+	token   string
+}
+
+func newClient(t *testing.T, scopes ...string) (*client, *yaml.Storage) {
+	store := yaml.NewStorage()
+	require.Nil(t, store.Put(admin))
+
+	token := signer.New(admin.Method, signer.WithIssuer(admin.Key), signer.WithScopes(scopes...)).Sign(nil)
+
+	serialized, err := token.Serialize(admin.Secret)
+	require.Nil(t, err)
+
+	return &client{t: t, handler: New(store, auth.New(store), "hola.admin"), token: string(serialized)}, store
+}
+
+func (c *client) do(method, path string, body interface{}, v interface{}) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		require.Nil(c.t, err)
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	recorder := httptest.NewRecorder()
+	c.handler.ServeHTTP(recorder, req)
+
+	if v != nil {
+		require.Nil(c.t, json.NewDecoder(recorder.Body).Decode(v))
+	}
+
+	return recorder
+}
+
+func Test_Admin(t *testing.T) {
+	client, store := newClient(t, "hola.admin")
+
+	// issue
+	var issued IdentityView
+	resp := client.do("POST", "/identities", IssueRequest{
+		Scopes:    []string{"resource.action"},
+		Method:    "HS512",
+		KeyPrefix: "svc-",
+		Owner:     "platform",
+	}, &issued)
+	require.Equal(t, http.StatusCreated, resp.Code)
+	assert.Equal(t, "identities/"+issued.Key, resp.Header().Get("Location"))
+	assert.True(t, strings.HasPrefix(issued.Key, "svc-"))
+	assert.NotEmpty(t, issued.Secret)
+	assert.Equal(t, []string{"resource.action"}, issued.Scopes)
+	assert.Equal(t, crypto.SigningMethodHS512, issued.Method)
+	assert.Equal(t, "platform", issued.Owner)
+	assert.False(t, issued.CreatedAt.IsZero())
+
+	stored, ok, err := store.Fetch(issued.Key)
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.Equal(t, issued.Secret, stored.Secret)
+
+	// get never includes the secret
+	var got IdentityView
+	require.Equal(t, http.StatusOK, client.do("GET", "/identities/"+issued.Key, nil, &got).Code)
+	assert.Empty(t, got.Secret)
+	issued.Secret = nil
+	assert.Equal(t, issued, got)
+
+	// list
+	var list ListResponse
+	require.Equal(t, http.StatusOK, client.do("GET", "/identities", nil, &list).Code)
+	require.Len(t, list.Identities, 2)
+	assert.Empty(t, list.Next)
+	for _, view := range list.Identities {
+		assert.Empty(t, view.Secret)
+	}
+
+	// list is filtered and paged
+	require.Equal(t, http.StatusOK, client.do("GET", "/identities?method=HS512", nil, &list).Code)
+	assert.Equal(t, []IdentityView{got}, list.Identities)
+
+	require.Equal(t, http.StatusOK, client.do("GET", "/identities?scope=resource.action&limit=1", nil, &list).Code)
+	require.Len(t, list.Identities, 1)
+	require.NotEmpty(t, list.Next)
+	first := list.Identities[0]
+
+	var next ListResponse
+	require.Equal(t, http.StatusOK, client.do("GET", "/identities?scope=resource.action&limit=1&cursor="+list.Next, nil, &next).Code)
+	require.Len(t, next.Identities, 1)
+	assert.Empty(t, next.Next)
+	assert.NotEqual(t, first.Key, next.Identities[0].Key)
+
+	// update
+	var updated IdentityView
+	require.Equal(t, http.StatusOK, client.do("PATCH", "/identities/"+issued.Key, UpdateRequest{Scopes: []string{"other.action"}}, &updated).Code)
+	assert.Equal(t, []string{"other.action"}, updated.Scopes)
+
+	updated = IdentityView{}
+	require.Equal(t, http.StatusOK, client.do("PATCH", "/identities/"+issued.Key, UpdateRequest{
+		AddScopes:    []string{"resource.action", "other.action"},
+		RemoveScopes: []string{"other.action"},
+		Method:       "HS384",
+	}, &updated).Code)
+	assert.Equal(t, []string{"resource.action"}, updated.Scopes)
+	assert.Equal(t, crypto.SigningMethodHS384, updated.Method)
+
+	// rotate
+	var rotated IdentityView
+	require.Equal(t, http.StatusOK, client.do("POST", "/identities/"+issued.Key+"/rotate", nil, &rotated).Code)
+	assert.NotEmpty(t, rotated.Secret)
+	assert.Nil(t, rotated.Retired)
+
+	stored, _, err = store.Fetch(issued.Key)
+	require.Nil(t, err)
+	assert.Equal(t, rotated.Secret, stored.Secret)
+	assert.Equal(t, []string{"resource.action"}, stored.Scopes)
+	assert.Nil(t, stored.Retired)
+
+	// rotate retaining the previous secret
+	var graced IdentityView
+	require.Equal(t, http.StatusOK, client.do("POST", "/identities/"+issued.Key+"/rotate?grace=1h", nil, &graced).Code)
+	assert.NotEqual(t, rotated.Secret, graced.Secret)
+	require.NotNil(t, graced.Retired)
+	assert.Empty(t, graced.Retired.Secret)
+
+	stored, _, err = store.Fetch(issued.Key)
+	require.Nil(t, err)
+	require.NotNil(t, stored.Retired)
+	assert.Equal(t, rotated.Secret, stored.Retired.Secret)
+	assert.Equal(t, stored.Retired.ExpiresAt, graced.Retired.ExpiresAt)
+
+	// revoke
+	require.Equal(t, http.StatusNoContent, client.do("DELETE", "/identities/"+issued.Key, nil, nil).Code)
+
+	_, ok, err = store.Fetch(issued.Key)
+	require.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func Test_Admin_Errors(t *testing.T) {
+	client, _ := newClient(t, "hola.admin")
+
+	for name, testCase := range map[string]struct {
+		method, path string
+		body         interface{}
+		code         int
+		err          string
+	}{
+		"unknown identity":   {method: "GET", path: "/identities/missing", code: http.StatusNotFound, err: `key "missing": identity not found`},
+		"update unknown":     {method: "PATCH", path: "/identities/missing", body: UpdateRequest{Scopes: []string{"resource.action"}}, code: http.StatusNotFound, err: `key "missing": identity not found`},
+		"rotate unknown":     {method: "POST", path: "/identities/missing/rotate", code: http.StatusNotFound, err: `key "missing": identity not found`},
+		"revoke unknown":     {method: "DELETE", path: "/identities/missing", code: http.StatusNotFound, err: `key "missing": identity not found`},
+		"unsupported method": {method: "POST", path: "/identities", body: IssueRequest{Method: "RS256"}, code: http.StatusBadRequest, err: `found "RS256": signing method must be one of HS256, HS384 or HS512`},
+		"secret too long":    {method: "POST", path: "/identities", body: IssueRequest{SecretLength: 1 << 30}, code: http.StatusBadRequest, err: "found 1073741824, maximum 1024: secret length above maximum"},
+		"no changes":         {method: "PATCH", path: "/identities/admin-key", body: map[string]string{}, code: http.StatusBadRequest, err: "no changes requested: invalid request"},
+		"update method":      {method: "PATCH", path: "/identities/admin-key", body: UpdateRequest{Method: "none"}, code: http.StatusBadRequest, err: `found "none": signing method must be one of HS256, HS384 or HS512`},
+		"invalid grace":      {method: "POST", path: "/identities/admin-key/rotate?grace=-1h", code: http.StatusBadRequest, err: `grace "-1h": invalid request`},
+		"unknown field":      {method: "PATCH", path: "/identities/admin-key", body: map[string]string{"secret": "mine"}, code: http.StatusBadRequest, err: `json: unknown field "secret": invalid request`},
+		"invalid limit":      {method: "GET", path: "/identities?limit=none", code: http.StatusBadRequest, err: `limit "none": invalid request`},
+		"invalid cursor":     {method: "GET", path: "/identities?cursor=!", code: http.StatusBadRequest, err: `cursor "!": invalid cursor`},
+		"method not allowed": {method: "PUT", path: "/identities", code: http.StatusMethodNotAllowed, err: "method not allowed"},
+	} {
+		var response errorResponse
+		resp := client.do(testCase.method, testCase.path, testCase.body, &response)
+		assert.Equal(t, testCase.code, resp.Code, name)
+		assert.Equal(t, testCase.err, response.Error, name)
+	}
+
+	assert.Equal(t, http.StatusNotFound, client.do("GET", "/unknown", nil, nil).Code)
+}
+
+func Test_Admin_UpdatePolicy(t *testing.T) {
+	client, _ := newClient(t, "hola.admin")
+
+	// updates are subject to the issue policy of the store
+	store := yaml.NewStorage(yaml.WithIssuePolicy(identity.IssuePolicy{
+		Methods: []string{"HS256"},
+		Scopes:  []string{"resource.action", "other.action"},
+	}))
+	require.Nil(t, store.Put(admin))
+	client.handler = New(store, auth.New(store), "hola.admin")
+
+	for name, testCase := range map[string]struct {
+		body UpdateRequest
+		err  string
+	}{
+		"forbidden scope":  {body: UpdateRequest{AddScopes: []string{"forbidden.action"}}, err: `identity "admin-key": found "forbidden.action": scope not allowed`},
+		"forbidden scopes": {body: UpdateRequest{Scopes: []string{"hola.admin", "forbidden.action"}}, err: `identity "admin-key": found "forbidden.action": scope not allowed`},
+		"forbidden method": {body: UpdateRequest{Method: "HS512"}, err: `identity "admin-key": found "HS512": signing method not allowed`},
+	} {
+		var response errorResponse
+		assert.Equal(t, http.StatusBadRequest, client.do("PATCH", "/identities/admin-key", testCase.body, &response).Code, name)
+		assert.Equal(t, testCase.err, response.Error, name)
+	}
+
+	id, ok, err := store.Fetch(admin.Key)
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.Equal(t, admin.Scopes, id.Scopes)
+	assert.Equal(t, "HS256", id.Method.Alg())
+
+	// scopes granted before the policy, such as hola.admin, are retained by updates
+	var updated IdentityView
+	resp := client.do("PATCH", "/identities/admin-key", UpdateRequest{AddScopes: []string{"other.action"}}, &updated)
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, []string{"hola.admin", "resource.action", "other.action"}, updated.Scopes)
+}
+
+func Test_Admin_Unauthorized(t *testing.T) {
+	// tokens without the admin scope are forbidden
+	client, _ := newClient(t, "resource.action")
+
+	var response errorResponse
+	assert.Equal(t, http.StatusForbidden, client.do("GET", "/identities", nil, &response).Code)
+	assert.Equal(t, `scope "hola.admin": required scopes missing from token`, response.Error)
+
+	// requests without a valid token are rejected by the middleware
+	client.token = "not a token"
+	assert.Equal(t, http.StatusBadRequest, client.do("GET", "/identities", nil, nil).Code)
+}
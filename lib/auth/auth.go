@@ -6,6 +6,7 @@ import (
 
 	"github.com/georgemac/hola/lib/identity"
 	"github.com/pkg/errors"
+	"gopkg.in/jose.v1/crypto"
 	"gopkg.in/jose.v1/jws"
 	"gopkg.in/jose.v1/jwt"
 )
@@ -17,6 +18,12 @@ var (
 	// ErrCannotFindIdentity is returned when an identity cannot be located for an ISS key.
 	ErrCannotFindIdentity = errors.New("identity cannot be located for ISS claim")
 
+	// ErrIdentityDisabled is returned when the identity for an ISS key has been disabled.
+	ErrIdentityDisabled = errors.New("identity is disabled")
+
+	// ErrIdentityExpired is returned when the identity for an ISS key has passed its expiry.
+	ErrIdentityExpired = errors.New("identity has expired")
+
 	// ErrScopesInvalid is returned when an error occurs parsing scopes from JWT claims
 	ErrScopesInvalid = errors.New("invalid scopes in JWT claims")
 
@@ -24,12 +31,19 @@ var (
 	ErrScopesUnauthorized = errors.New("scopes not authorized for ISS")
 )
 
+var now = time.Now
+
 // Authenticator performs a simple authentication flow for a given jwt token.
 // It decorates a Fetcher implementation to fetch secrets for given keys issued
-// within a JWT token ISS issuer claim.
+// within a JWT token ISS issuer claim. Tokens with a ClientIDKey claim naming
+// another identity are also rejected once that client identity has been revoked,
+// disabled or has expired, and must satisfy the policy of the client.
 type Authenticator struct {
 	storage   identity.Fetcher
 	validator *jwt.Validator
+	issuers   map[string]struct{}
+	policies  []ClaimPolicy
+	revoked   RevocationList
 }
 
 // New create a new(Authenticator) around an identity fetcher implementation
@@ -56,6 +70,13 @@ func (a *Authenticator) Validate(token jwt.JWT) (scopes []string, err error) {
 		return scopes, errors.Wrap(ErrISSClaimMissing, "authentication")
 	}
 
+	// reject issuers outside of the allowed set before reaching storage
+	if a.issuers != nil {
+		if _, ok := a.issuers[iss]; !ok {
+			return scopes, errors.Wrapf(ErrIssuerNotAllowed, "authentication: found %q", iss)
+		}
+	}
+
 	// fetch identity for issuer
 	id, ok, err := a.storage.Fetch(iss)
 	// something went wrong while fetching issuers identity
@@ -68,11 +89,49 @@ func (a *Authenticator) Validate(token jwt.JWT) (scopes []string, err error) {
 		return scopes, errors.Wrap(ErrCannotFindIdentity, "authentication")
 	}
 
-	// validate JWT token
-	if err := id.Validate(token); err != nil {
+	// validate JWT token, before revealing anything about the identity
+	if err := id.Validate(token, a.validator); err != nil {
 		return scopes, errors.Wrap(err, "authentication: token is invalid")
 	}
 
+	// identity is no longer permitted to authenticate
+	if id.Disabled {
+		return scopes, errors.Wrap(ErrIdentityDisabled, "authentication")
+	}
+
+	if id.Expired(now()) {
+		return scopes, errors.Wrap(ErrIdentityExpired, "authentication")
+	}
+
+	// evaluate claim policies, followed by those declared by the identity
+	policy := All(All(a.policies...), IdentityPolicy(id.Policy))
+
+	// tokens issued to a client by another identity are only valid while the client is
+	if client, ok := token.Claims().Get(string(ClientIDKey)).(string); ok && client != iss {
+		clientPolicy, err := a.client(client)
+		if err != nil {
+			return scopes, err
+		}
+
+		policy = All(policy, clientPolicy)
+	}
+
+	if err := policy(token.Claims()); err != nil {
+		return scopes, errors.Wrap(err, "authentication")
+	}
+
+	// check the token has not been revoked
+	if jti, ok := token.Claims().JWTID(); ok && a.revoked != nil {
+		revoked, err := a.revoked.Revoked(iss, jti)
+		if err != nil {
+			return scopes, errors.Wrap(err, "authentication: error checking revocation list")
+		}
+
+		if revoked {
+			return scopes, errors.Wrapf(ErrTokenRevoked, "authentication: found %q", jti)
+		}
+	}
+
 	// if scopes present in claims, add scopes to request context
 	if scopesPlayload := token.Claims().Get(string(ScopesKey)); scopesPlayload != nil {
 		// only add scopes if they are present within identity
@@ -95,11 +154,66 @@ func (a *Authenticator) Validate(token jwt.JWT) (scopes []string, err error) {
 	return
 }
 
+// client fetches the client identity for the key and checks it is still permitted
+// to authenticate, returning a ClaimPolicy which enforces the policy of the client.
+func (a *Authenticator) client(key string) (ClaimPolicy, error) {
+	id, ok, err := a.storage.Fetch(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "authentication: error fetching client identity from storage")
+	}
+
+	if !ok {
+		return nil, errors.Wrapf(ErrCannotFindIdentity, "authentication: client %q", key)
+	}
+
+	if id.Disabled {
+		return nil, errors.Wrapf(ErrIdentityDisabled, "authentication: client %q", key)
+	}
+
+	if id.Expired(now()) {
+		return nil, errors.Wrapf(ErrIdentityExpired, "authentication: client %q", key)
+	}
+
+	return IdentityPolicy(id.Policy), nil
+}
+
+// IsRejection returns true if the error returned by Validate is the result of the
+// token being rejected, as opposed to a failure to complete validation,
+// such as an error fetching from storage.
+func IsRejection(err error) bool {
+	switch errors.Cause(err) {
+	case ErrISSClaimMissing,
+		ErrCannotFindIdentity,
+		ErrIdentityDisabled,
+		ErrIdentityExpired,
+		ErrScopesInvalid,
+		ErrScopesUnauthorized,
+		ErrIssuerNotAllowed,
+		ErrAudienceNotAllowed,
+		ErrSubjectNotAllowed,
+		ErrLifetimeExceeded,
+		ErrClaimMissing,
+		ErrClaimMismatch,
+		ErrTokenRevoked,
+		crypto.ErrSignatureInvalid,
+		jwt.ErrTokenIsExpired,
+		jwt.ErrTokenNotYetValid,
+		jwt.ErrInvalidISSClaim,
+		jwt.ErrInvalidSUBClaim,
+		jwt.ErrInvalidAUDClaim:
+		return true
+	}
+
+	return false
+}
+
 // checkScopes returns two slices, valid and invalid
 // valid contains scopes in a, that are present in b
 // invalid contains the scopes in a, that are not present in b
 // err is not nil, if a scope in a is not a string
 func checkScopes(a []interface{}, b []string) (valid, invalid []string, err error) {
+	// sort a copy, as b is owned by the identity
+	b = append([]string(nil), b...)
 	sort.Strings(b)
 	for _, v := range a {
 		value, ok := v.(string)
@@ -108,10 +222,10 @@ func checkScopes(a []interface{}, b []string) (valid, invalid []string, err erro
 			return
 		}
 
-		if i := sort.SearchStrings(b, value); i >= len(b) {
-			invalid = append(invalid, value)
-		} else {
+		if i := sort.SearchStrings(b, value); i < len(b) && b[i] == value {
 			valid = append(valid, value)
+		} else {
+			invalid = append(invalid, value)
 		}
 	}
 
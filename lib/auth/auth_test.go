@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/jose.v1/crypto"
+	"gopkg.in/jose.v1/jws"
+	"gopkg.in/jose.v1/jwt"
+)
+
+// Test_Authenticator_ScopeBypass verifies tokens cannot claim scopes their identity
+// does not hold. The check previously only rejected scopes sorting after every scope
+// of the identity, so a token claiming "admin" was authorized by "resource.action".
+func Test_Authenticator_ScopeBypass(t *testing.T) {
+	id := identity.Identity{
+		Key:    "some-issuer-key",
+		Secret: []byte("this is super secret"),
+		Method: crypto.SigningMethodHS256,
+		Scopes: []string{"resource.action", "other.action"},
+	}
+
+	authenticator := New(identity.FetcherFunc(func(string) (identity.Identity, bool, error) {
+		return id, true, nil
+	}))
+
+	token := func(scopes ...interface{}) jwt.JWT {
+		claims := jws.Claims{}
+		claims.SetIssuer(id.Key)
+		claims.Set(string(ScopesKey), scopes)
+
+		serialized, err := jws.NewJWT(claims, id.Method).Serialize(id.Secret)
+		require.Nil(t, err)
+
+		token, err := jws.ParseJWT(serialized)
+		require.Nil(t, err)
+		return token
+	}
+
+	for _, scopes := range [][]interface{}{
+		{"admin"},
+		{"resource.action", "admin"},
+		{"other.actio"},
+		{"zzz"},
+	} {
+		_, err := authenticator.Validate(token(scopes...))
+		assert.Equal(t, ErrScopesUnauthorized, errors.Cause(err), "%v", scopes)
+	}
+
+	scopes, err := authenticator.Validate(token("resource.action"))
+	require.Nil(t, err)
+	assert.Equal(t, []string{"resource.action"}, scopes)
+
+	// the scopes of the identity are not reordered
+	assert.Equal(t, []string{"resource.action", "other.action"}, id.Scopes)
+}
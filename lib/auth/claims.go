@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"gopkg.in/jose.v1/jwt"
+)
+
+// DecodeClaims decodes the full set of claims from a JWT token in to the value
+// pointed to by v. The claims are decoded using encoding/json, so v can be any
+// struct with the appropriate json tags.
+func DecodeClaims(token jwt.JWT, v interface{}) error {
+	return decode(map[string]interface{}(token.Claims()), v)
+}
+
+// DecodeClaim decodes a single claim for the provided key in to the value pointed to by v.
+// This is useful for decoding claims nested under a data key by a signer.Signer.
+// If the claim is not present then the ok boolean is false.
+func DecodeClaim(token jwt.JWT, key string, v interface{}) (ok bool, err error) {
+	claim := token.Claims().Get(key)
+	if claim == nil {
+		return
+	}
+
+	return true, decode(claim, v)
+}
+
+func decode(claims interface{}, v interface{}) error {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return errors.Wrap(err, "authentication: encoding claims")
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.Wrap(err, "authentication: decoding claims")
+	}
+
+	return nil
+}
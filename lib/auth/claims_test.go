@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/jose.v1/crypto"
+	"gopkg.in/jose.v1/jws"
+)
+
+type testClaims struct {
+	Issuer string   `json:"iss"`
+	Scopes []string `json:"scopes"`
+	Team   string   `json:"team"`
+}
+
+func Test_DecodeClaims_OK(t *testing.T) {
+	token := jws.NewJWT(jws.Claims{
+		"iss":    "some-issuer-key",
+		"scopes": []string{"resource.action"},
+		"team":   "platform",
+	}, crypto.SigningMethodHS256)
+
+	var claims testClaims
+	require.Nil(t, DecodeClaims(token, &claims))
+	assert.Equal(t, testClaims{
+		Issuer: "some-issuer-key",
+		Scopes: []string{"resource.action"},
+		Team:   "platform",
+	}, claims)
+}
+
+func Test_DecodeClaims_Error(t *testing.T) {
+	token := jws.NewJWT(jws.Claims{"team": 12345}, crypto.SigningMethodHS256)
+
+	var claims testClaims
+	assert.Error(t, DecodeClaims(token, &claims))
+}
+
+func Test_DecodeClaim_OK(t *testing.T) {
+	token := jws.NewJWT(jws.Claims{
+		"claims": map[string]interface{}{"team": "platform"},
+	}, crypto.SigningMethodHS256)
+
+	var claims testClaims
+	ok, err := DecodeClaim(token, "claims", &claims)
+	require.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "platform", claims.Team)
+}
+
+func Test_DecodeClaim_NotFound(t *testing.T) {
+	token := jws.NewJWT(jws.Claims{}, crypto.SigningMethodHS256)
+
+	var claims testClaims
+	ok, err := DecodeClaim(token, "claims", &claims)
+	require.Nil(t, err)
+	assert.False(t, ok)
+}
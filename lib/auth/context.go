@@ -21,6 +21,10 @@ func (c ContextKey) String() string { return string(c) }
 const (
 	// ScopesKey is the string scopes, used with a context and a jwt.JWT claim
 	ScopesKey ContextKey = "scopes"
+
+	// ClientIDKey is the string client_id, the jwt.JWT claim containing the key of the
+	// client identity a token was issued to, when it is issued by another identity
+	ClientIDKey ContextKey = "client_id"
 )
 
 // ScopesFromContext retrieves the string slices for the ScopesKey within a context.Context
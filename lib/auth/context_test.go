@@ -4,6 +4,7 @@ import (
 	"context"
 	"testing"
 
+	"github.com/georgemac/hola/lib/signer"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -36,3 +37,8 @@ func Test_ScopesFromContext_Error(t *testing.T) {
 	assert.False(t, ok)
 	assert.Nil(t, found)
 }
+
+func Test_ScopesKey_SignerScopesClaim(t *testing.T) {
+	// tokens signed with scopes must carry them under the claim read by the Authenticator
+	assert.Equal(t, signer.ScopesClaim, ScopesKey.String())
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// validate at compile time that Denylist implements TokenRevoker.
+var _ TokenRevoker = (*Denylist)(nil)
+
+// TokenRevoker is an interface which describes a RevocationList
+// which tokens can be added to.
+type TokenRevoker interface {
+	RevocationList
+	RevokeToken(issuer, jti string, exp time.Time) error
+}
+
+// DefaultRetention is how long a Denylist retains entries after the token they
+// revoke has expired, unless configured otherwise with WithRetention.
+const DefaultRetention = 5 * time.Minute
+
+// pruneInterval is the minimum interval between prunes of a Denylist,
+// so the cost of pruning is shared by the revocations made in between.
+const pruneInterval = time.Minute
+
+// Denylist is an in-memory TokenRevoker which is safe for concurrent use.
+// Tokens are identified by their issuer and JTI claim, as a JTI is only
+// unique amongst the tokens of its issuer. Entries are only retained until the token they revoke has expired and the
+// retention period has passed, after which the token is rejected on expiry alone.
+// The retention must be at least the expiration leeway of every Authenticator
+// using the Denylist, otherwise revoked tokens are accepted again within the leeway.
+type Denylist struct {
+	mu        sync.RWMutex
+	entries   map[revokedToken]time.Time
+	retention time.Duration
+	prunedAt  time.Time
+}
+
+// revokedToken identifies a token within a Denylist
+type revokedToken struct {
+	issuer string
+	jti    string
+}
+
+// NewDenylist returns a new empty Denylist, which retains entries for
+// DefaultRetention after their token expires unless configured WithRetention.
+func NewDenylist(opts ...DenylistOption) *Denylist {
+	d := &Denylist{entries: map[revokedToken]time.Time{}, retention: DefaultRetention}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+// RevokeToken adds the token of the issuer identified by jti, which expires at exp,
+// to the denylist. A zero exp retains the entry indefinitely. Expired entries are
+// pruned at most once a minute, as tokens are revoked.
+func (d *Denylist) RevokeToken(issuer, jti string, exp time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if t := now(); t.Sub(d.prunedAt) >= pruneInterval {
+		d.prune(t)
+	}
+
+	d.entries[revokedToken{issuer: issuer, jti: jti}] = exp
+
+	return nil
+}
+
+// Revoked returns true if the token of the issuer identified by jti is in the denylist.
+func (d *Denylist) Revoked(issuer, jti string) (bool, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	_, ok := d.entries[revokedToken{issuer: issuer, jti: jti}]
+	return ok, nil
+}
+
+// prune removes entries for tokens which expired more than the retention before now
+func (d *Denylist) prune(now time.Time) {
+	for token, exp := range d.entries {
+		if !exp.IsZero() && exp.Add(d.retention).Before(now) {
+			delete(d.entries, token)
+		}
+	}
+
+	d.prunedAt = now
+}
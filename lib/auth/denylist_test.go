@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/jose.v1/crypto"
+	"gopkg.in/jose.v1/jws"
+)
+
+func Test_Denylist(t *testing.T) {
+	defer func() { now = time.Now }()
+
+	start := time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+	now = func() time.Time { return start }
+
+	denylist := NewDenylist()
+	require.Nil(t, denylist.RevokeToken("some-issuer", "some-jti", start.Add(time.Minute)))
+	require.Nil(t, denylist.RevokeToken("some-issuer", "forever-jti", time.Time{}))
+
+	for _, testCase := range []struct {
+		issuer, jti string
+		revoked     bool
+	}{
+		{issuer: "some-issuer", jti: "some-jti", revoked: true},
+		{issuer: "some-issuer", jti: "forever-jti", revoked: true},
+		{issuer: "some-issuer", jti: "other-jti", revoked: false},
+		// jti claims are only unique amongst the tokens of an issuer
+		{issuer: "other-issuer", jti: "some-jti", revoked: false},
+	} {
+		revoked, err := denylist.Revoked(testCase.issuer, testCase.jti)
+		require.Nil(t, err)
+		assert.Equal(t, testCase.revoked, revoked, "%s %s", testCase.issuer, testCase.jti)
+	}
+
+	// entries are retained for the retention period after their token has expired
+	now = func() time.Time { return start.Add(time.Minute + DefaultRetention) }
+	require.Nil(t, denylist.RevokeToken("some-issuer", "other-jti", start.Add(2*time.Hour)))
+
+	revoked, err := denylist.Revoked("some-issuer", "some-jti")
+	require.Nil(t, err)
+	assert.True(t, revoked)
+
+	// and pruned once it has passed, at most once per prune interval
+	now = func() time.Time { return start.Add(time.Minute + DefaultRetention + pruneInterval/2) }
+	require.Nil(t, denylist.RevokeToken("some-issuer", "other-jti", start.Add(2*time.Hour)))
+
+	revoked, err = denylist.Revoked("some-issuer", "some-jti")
+	require.Nil(t, err)
+	assert.True(t, revoked)
+
+	now = func() time.Time { return start.Add(time.Minute + DefaultRetention + pruneInterval) }
+	require.Nil(t, denylist.RevokeToken("some-issuer", "other-jti", start.Add(2*time.Hour)))
+
+	revoked, err = denylist.Revoked("some-issuer", "some-jti")
+	require.Nil(t, err)
+	assert.False(t, revoked)
+
+	revoked, err = denylist.Revoked("some-issuer", "forever-jti")
+	require.Nil(t, err)
+	assert.True(t, revoked)
+}
+
+func Test_Denylist_ExpirationLeeway(t *testing.T) {
+	id := identity.Identity{
+		Key:    "some-issuer-key",
+		Secret: []byte("this is super secret"),
+		Method: crypto.SigningMethodHS256,
+	}
+
+	// the token has expired, but is within the expiration leeway
+	exp := time.Now().Add(-time.Minute)
+	claims := jws.Claims{}
+	claims.SetIssuer(id.Key)
+	claims.SetJWTID("some-jti")
+	claims.SetExpiration(exp)
+
+	serialized, err := jws.NewJWT(claims, id.Method).Serialize(id.Secret)
+	require.Nil(t, err)
+
+	token, err := jws.ParseJWT(serialized)
+	require.Nil(t, err)
+
+	denylist := NewDenylist(WithRetention(10 * time.Minute))
+	authenticator := New(identity.FetcherFunc(func(string) (identity.Identity, bool, error) {
+		return id, true, nil
+	}), WithExpirationLeeway(10*time.Minute), WithRevocationList(denylist))
+
+	_, err = authenticator.Validate(token)
+	require.Nil(t, err)
+
+	require.Nil(t, denylist.RevokeToken(id.Key, "some-jti", exp))
+
+	// pruning the denylist retains the entry within the leeway
+	denylist.prune(time.Now())
+
+	_, err = authenticator.Validate(token)
+	assert.Equal(t, ErrTokenRevoked, errors.Cause(err))
+}
@@ -32,3 +32,41 @@ func WithAudience(aud string) Option {
 		a.validator.SetAudience(aud)
 	}
 }
+
+// WithAudiences accepts tokens with an audience claim matching any of the provided audiences
+func WithAudiences(auds ...string) Option {
+	return WithPolicy(Audiences(auds...))
+}
+
+// WithIssuers restricts the accepted ISS claims to the provided set of issuers.
+// Issuers are checked before any identity is fetched from storage.
+func WithIssuers(issuers ...string) Option {
+	return func(a *Authenticator) {
+		a.issuers = set(issuers)
+	}
+}
+
+// WithPolicy adds claim policies which are evaluated after the token signature is verified
+func WithPolicy(policies ...ClaimPolicy) Option {
+	return func(a *Authenticator) {
+		a.policies = append(a.policies, policies...)
+	}
+}
+
+// WithRevocationList rejects tokens with a JTI claim present in the revocation list
+func WithRevocationList(list RevocationList) Option {
+	return func(a *Authenticator) {
+		a.revoked = list
+	}
+}
+
+// DenylistOption is a function which manipulates the state of a Denylist
+type DenylistOption func(*Denylist)
+
+// WithRetention sets how long entries are retained after the token they revoke has expired.
+// It must be at least the expiration leeway of the Authenticators using the Denylist.
+func WithRetention(retention time.Duration) DenylistOption {
+	return func(d *Denylist) {
+		d.retention = retention
+	}
+}
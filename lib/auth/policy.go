@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/pkg/errors"
+	"gopkg.in/jose.v1/jwt"
+)
+
+var (
+	// ErrIssuerNotAllowed is returned when the ISS claim is not within the allowed set of issuers.
+	ErrIssuerNotAllowed = errors.New("issuer not allowed")
+
+	// ErrAudienceNotAllowed is returned when none of the AUD claims are within the allowed set of audiences.
+	ErrAudienceNotAllowed = errors.New("audience not allowed")
+
+	// ErrSubjectNotAllowed is returned when the SUB claim is not within the allowed set of subjects.
+	ErrSubjectNotAllowed = errors.New("subject not allowed")
+
+	// ErrLifetimeExceeded is returned when the duration between the IAT and EXP claims is too long.
+	ErrLifetimeExceeded = errors.New("token lifetime exceeds maximum")
+
+	// ErrClaimMissing is returned when a required claim is not present in the JWT claims.
+	ErrClaimMissing = errors.New("required claim missing from JWT claims")
+
+	// ErrClaimMismatch is returned when a claim does not match its required value.
+	ErrClaimMismatch = errors.New("claim does not match required value")
+)
+
+// ClaimPolicy is a function which inspects the claims of a JWT token, once its
+// signature has been verified, and returns an error if the claims are not acceptable.
+type ClaimPolicy func(jwt.Claims) error
+
+// All returns a ClaimPolicy which requires every one of the provided policies to pass.
+// The first error encountered is returned.
+func All(policies ...ClaimPolicy) ClaimPolicy {
+	return func(claims jwt.Claims) error {
+		for _, policy := range policies {
+			if err := policy(claims); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// Any returns a ClaimPolicy which requires at least one of the provided policies to pass.
+// If none of them pass, the error from the last policy is returned.
+func Any(policies ...ClaimPolicy) ClaimPolicy {
+	return func(claims jwt.Claims) (err error) {
+		for _, policy := range policies {
+			if err = policy(claims); err == nil {
+				return
+			}
+		}
+
+		return
+	}
+}
+
+// Audiences returns a ClaimPolicy which requires at least one of the tokens
+// AUD claims to be present in the provided set of audiences.
+func Audiences(audiences ...string) ClaimPolicy {
+	allowed := set(audiences)
+	return func(claims jwt.Claims) error {
+		found, _ := claims.Audience()
+		for _, aud := range found {
+			if _, ok := allowed[aud]; ok {
+				return nil
+			}
+		}
+
+		return errors.Wrapf(ErrAudienceNotAllowed, "found %v", found)
+	}
+}
+
+// Subjects returns a ClaimPolicy which requires the tokens SUB claim
+// to be present in the provided set of subjects.
+func Subjects(subjects ...string) ClaimPolicy {
+	allowed := set(subjects)
+	return func(claims jwt.Claims) error {
+		sub, _ := claims.Subject()
+		if _, ok := allowed[sub]; !ok {
+			return errors.Wrapf(ErrSubjectNotAllowed, "found %q", sub)
+		}
+
+		return nil
+	}
+}
+
+// MaxLifetime returns a ClaimPolicy which requires both the IAT and EXP claims to be present
+// and the duration between them to be no longer than max.
+func MaxLifetime(max time.Duration) ClaimPolicy {
+	return func(claims jwt.Claims) error {
+		iat, ok := claims.IssuedAt()
+		if !ok {
+			return errors.Wrap(ErrClaimMissing, `claim "iat"`)
+		}
+
+		exp, ok := claims.Expiration()
+		if !ok {
+			return errors.Wrap(ErrClaimMissing, `claim "exp"`)
+		}
+
+		if lifetime := exp.Sub(iat); lifetime > max {
+			return errors.Wrapf(ErrLifetimeExceeded, "found %v, maximum %v", lifetime, max)
+		}
+
+		return nil
+	}
+}
+
+// IdentityPolicy returns a ClaimPolicy which enforces the constraints
+// described by an identities token policy.
+func IdentityPolicy(p identity.Policy) ClaimPolicy {
+	var policies []ClaimPolicy
+	if p.MaxLifetime > 0 {
+		policies = append(policies, MaxLifetime(p.MaxLifetime))
+	}
+
+	if len(p.Audiences) > 0 {
+		policies = append(policies, Audiences(p.Audiences...))
+	}
+
+	if len(p.Subjects) > 0 {
+		policies = append(policies, Subjects(p.Subjects...))
+	}
+
+	if len(p.RequiredClaims) > 0 {
+		policies = append(policies, RequireClaims(p.RequiredClaims...))
+	}
+
+	return All(policies...)
+}
+
+// RequireClaims returns a ClaimPolicy which requires each of the provided claims to be present.
+func RequireClaims(keys ...string) ClaimPolicy {
+	return func(claims jwt.Claims) error {
+		for _, key := range keys {
+			if !claims.Has(key) {
+				return errors.Wrapf(ErrClaimMissing, "claim %q", key)
+			}
+		}
+
+		return nil
+	}
+}
+
+// RequireClaim returns a ClaimPolicy which requires the claim for key to be present and equal to value.
+// Values are compared once encoded in the same form as claims parsed from a token, meaning
+// all numbers are compared as float64 and slices as []interface{}.
+func RequireClaim(key string, value interface{}) ClaimPolicy {
+	expected := normalize(value)
+	return func(claims jwt.Claims) error {
+		found := claims.Get(key)
+		if found == nil {
+			return errors.Wrapf(ErrClaimMissing, "claim %q", key)
+		}
+
+		if !reflect.DeepEqual(normalize(found), expected) {
+			return errors.Wrapf(ErrClaimMismatch, "claim %q found %v", key, found)
+		}
+
+		return nil
+	}
+}
+
+// normalize converts numeric and slice types in to the types produced by encoding/json
+func normalize(v interface{}) interface{} {
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		return value.Float()
+	case reflect.Slice, reflect.Array:
+		normalized := make([]interface{}, value.Len())
+		for i := range normalized {
+			normalized[i] = normalize(value.Index(i).Interface())
+		}
+		return normalized
+	}
+
+	return v
+}
+
+func set(values []string) map[string]struct{} {
+	s := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		s[v] = struct{}{}
+	}
+
+	return s
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/jose.v1/jwt"
+)
+
+func Test_Audiences(t *testing.T) {
+	policy := Audiences("one.audience.com", "two.audience.com")
+
+	assert.Nil(t, policy(jwt.Claims{"aud": "two.audience.com"}))
+	assert.Nil(t, policy(jwt.Claims{"aud": []interface{}{"other.audience.com", "one.audience.com"}}))
+
+	err := policy(jwt.Claims{"aud": "other.audience.com"})
+	assert.Equal(t, ErrAudienceNotAllowed, errors.Cause(err))
+	assert.EqualError(t, err, "found [other.audience.com]: audience not allowed")
+
+	assert.Equal(t, ErrAudienceNotAllowed, errors.Cause(policy(jwt.Claims{})))
+}
+
+func Test_RequireClaims(t *testing.T) {
+	policy := RequireClaims("sub", "jti")
+
+	assert.Nil(t, policy(jwt.Claims{"sub": "someone", "jti": "some-id"}))
+
+	err := policy(jwt.Claims{"sub": "someone"})
+	assert.Equal(t, ErrClaimMissing, errors.Cause(err))
+	assert.EqualError(t, err, `claim "jti": required claim missing from JWT claims`)
+}
+
+func Test_RequireClaim(t *testing.T) {
+	assert.Nil(t, RequireClaim("team", "platform")(jwt.Claims{"team": "platform"}))
+	assert.Nil(t, RequireClaim("level", 5)(jwt.Claims{"level": float64(5)}))
+	assert.Nil(t, RequireClaim("groups", []string{"a", "b"})(jwt.Claims{"groups": []interface{}{"a", "b"}}))
+
+	err := RequireClaim("team", "platform")(jwt.Claims{"team": "billing"})
+	assert.Equal(t, ErrClaimMismatch, errors.Cause(err))
+	assert.EqualError(t, err, `claim "team" found billing: claim does not match required value`)
+
+	err = RequireClaim("team", "platform")(jwt.Claims{})
+	assert.Equal(t, ErrClaimMissing, errors.Cause(err))
+}
+
+func Test_All_Any(t *testing.T) {
+	team, sub := RequireClaim("team", "platform"), RequireClaims("sub")
+
+	assert.Nil(t, All(team, sub)(jwt.Claims{"team": "platform", "sub": "someone"}))
+	assert.Equal(t, ErrClaimMissing, errors.Cause(All(team, sub)(jwt.Claims{"team": "platform"})))
+
+	assert.Nil(t, Any(team, sub)(jwt.Claims{"sub": "someone"}))
+	assert.Equal(t, ErrClaimMissing, errors.Cause(Any(team, sub)(jwt.Claims{"team": "billing"})))
+}
+
+func Test_Subjects(t *testing.T) {
+	policy := Subjects("someone", "someone.else")
+
+	assert.Nil(t, policy(jwt.Claims{"sub": "someone.else"}))
+
+	err := policy(jwt.Claims{"sub": "other"})
+	assert.Equal(t, ErrSubjectNotAllowed, errors.Cause(err))
+	assert.EqualError(t, err, `found "other": subject not allowed`)
+}
+
+func Test_MaxLifetime(t *testing.T) {
+	policy := MaxLifetime(time.Hour)
+
+	assert.Nil(t, policy(jwt.Claims{"iat": float64(1500000000), "exp": float64(1500003600)}))
+
+	err := policy(jwt.Claims{"iat": float64(1500000000), "exp": float64(1500003601)})
+	assert.Equal(t, ErrLifetimeExceeded, errors.Cause(err))
+	assert.EqualError(t, err, "found 1h0m1s, maximum 1h0m0s: token lifetime exceeds maximum")
+
+	assert.Equal(t, ErrClaimMissing, errors.Cause(policy(jwt.Claims{"exp": float64(1500000000)})))
+	assert.Equal(t, ErrClaimMissing, errors.Cause(policy(jwt.Claims{"iat": float64(1500000000)})))
+}
+
+func Test_IdentityPolicy(t *testing.T) {
+	assert.Nil(t, IdentityPolicy(identity.Policy{})(jwt.Claims{}))
+
+	policy := IdentityPolicy(identity.Policy{
+		MaxLifetime:    time.Hour,
+		Audiences:      []string{"test.audience.com"},
+		Subjects:       []string{"someone"},
+		RequiredClaims: []string{"jti"},
+	})
+
+	claims := jwt.Claims{
+		"iat": float64(1500000000),
+		"exp": float64(1500003600),
+		"aud": "test.audience.com",
+		"sub": "someone",
+		"jti": "some-id",
+	}
+	assert.Nil(t, policy(claims))
+
+	for key, err := range map[string]error{
+		"exp": ErrClaimMissing,
+		"aud": ErrAudienceNotAllowed,
+		"sub": ErrSubjectNotAllowed,
+		"jti": ErrClaimMissing,
+	} {
+		invalid := jwt.Claims{}
+		for k, v := range claims {
+			if k != key {
+				invalid[k] = v
+			}
+		}
+
+		assert.Equal(t, err, errors.Cause(policy(invalid)), key)
+	}
+}
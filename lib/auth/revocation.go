@@ -0,0 +1,24 @@
+package auth
+
+import "github.com/pkg/errors"
+
+// ErrTokenRevoked is returned when the JTI claim of a token is within the revocation list.
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// validate at compile time that RevocationListFunc implements RevocationList.
+var _ RevocationList = RevocationListFunc(nil)
+
+// RevocationList is an interface which describes a store of
+// revoked tokens, identified by their issuer and JTI claim.
+type RevocationList interface {
+	Revoked(issuer, jti string) (revoked bool, err error)
+}
+
+// RevocationListFunc implements the RevocationList interface.
+// This allows for simple functions to be used as a RevocationList.
+type RevocationListFunc func(string, string) (bool, error)
+
+// Revoked returns true if the token of the issuer identified by jti has been revoked.
+func (r RevocationListFunc) Revoked(issuer, jti string) (bool, error) {
+	return r(issuer, jti)
+}
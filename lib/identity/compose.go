@@ -0,0 +1,123 @@
+package identity
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Errors is returned by composed fetchers when more than one of their
+// fetchers fails. Each error is wrapped with the position of its fetcher.
+type Errors []error
+
+// Error joins the messages of each error.
+func (e Errors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+
+	return fmt.Sprintf("%d fetchers failed: %s", len(e), strings.Join(messages, "; "))
+}
+
+// errorOrNil returns nil for no errors, the only error when there is one,
+// otherwise the errors
+func (e Errors) errorOrNil() error {
+	switch len(e) {
+	case 0:
+		return nil
+	case 1:
+		return e[0]
+	}
+
+	return e
+}
+
+// Chain returns a Fetcher which consults each fetcher in turn and returns
+// the first identity found. Failing fetchers are skipped, so an identity found
+// by a later fetcher is returned even when an earlier one fails.
+// When no identity is found, the errors of any failing fetchers are returned.
+func Chain(fetchers ...Fetcher) Fetcher {
+	return FetcherFunc(func(key string) (Identity, bool, error) {
+		var errs Errors
+		for i, fetcher := range fetchers {
+			id, ok, err := fetcher.Fetch(key)
+			if err != nil {
+				errs = append(errs, errors.Wrapf(err, "fetcher %d", i))
+				continue
+			}
+
+			if ok {
+				return id, true, nil
+			}
+		}
+
+		return Identity{}, false, errs.errorOrNil()
+	})
+}
+
+// Fallback returns a Fetcher which consults the secondary fetcher only when the
+// primary fetcher fails. Identities missing from the primary fetcher are not
+// looked up in the secondary. When both fail, both errors are returned.
+func Fallback(primary, secondary Fetcher) Fetcher {
+	return FetcherFunc(func(key string) (Identity, bool, error) {
+		id, ok, err := primary.Fetch(key)
+		if err == nil {
+			return id, ok, nil
+		}
+
+		id, ok, serr := secondary.Fetch(key)
+		if serr != nil {
+			return Identity{}, false, Errors{
+				errors.Wrap(err, "primary fetcher"),
+				errors.Wrap(serr, "secondary fetcher"),
+			}
+		}
+
+		return id, ok, nil
+	})
+}
+
+// PrefixRouter returns a Fetcher which sends each key to the fetcher of the
+// longest prefix in routes which the key starts with. Keys matching no prefix
+// are sent to the fallback fetcher, or are not found when fallback is nil.
+func PrefixRouter(routes map[string]Fetcher, fallback Fetcher) Fetcher {
+	prefixes := make([]string, 0, len(routes))
+	for prefix := range routes {
+		prefixes = append(prefixes, prefix)
+	}
+
+	// copied so that later changes to routes do not race with fetches
+	table := make(map[string]Fetcher, len(routes))
+	for prefix, fetcher := range routes {
+		table[prefix] = fetcher
+	}
+
+	return FetcherFunc(func(key string) (Identity, bool, error) {
+		var (
+			match   string
+			routed  bool
+			fetcher = fallback
+		)
+
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) && (!routed || len(prefix) > len(match)) {
+				match, routed, fetcher = prefix, true, table[prefix]
+			}
+		}
+
+		if fetcher == nil {
+			return Identity{}, false, nil
+		}
+
+		id, ok, err := fetcher.Fetch(key)
+		if err != nil && routed {
+			return Identity{}, false, errors.Wrapf(err, "fetcher for prefix %q", match)
+		} else if err != nil {
+			return Identity{}, false, errors.Wrap(err, "fallback fetcher")
+		}
+
+		return id, ok, nil
+	})
+}
@@ -0,0 +1,122 @@
+package identity
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errUnavailable = errors.New("storage unavailable")
+
+// fixed returns a fetcher which knows only the provided keys, recording the keys it is asked for
+func fixed(calls *[]string, name string, keys ...string) Fetcher {
+	return FetcherFunc(func(key string) (Identity, bool, error) {
+		*calls = append(*calls, name)
+		for _, k := range keys {
+			if k == key {
+				return Identity{Key: key, Owner: name}, true, nil
+			}
+		}
+
+		return Identity{}, false, nil
+	})
+}
+
+func failing(calls *[]string, name string) Fetcher {
+	return FetcherFunc(func(string) (Identity, bool, error) {
+		*calls = append(*calls, name)
+		return Identity{}, false, errUnavailable
+	})
+}
+
+func Test_Chain(t *testing.T) {
+	var calls []string
+	chain := Chain(fixed(&calls, "database", "new-key"), failing(&calls, "broken"), fixed(&calls, "yaml", "old-key", "new-key"))
+
+	// the first hit wins
+	id, ok, err := chain.Fetch("new-key")
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "database", id.Owner)
+	assert.Equal(t, []string{"database"}, calls)
+
+	// failing fetchers are skipped
+	calls = nil
+	id, ok, err = chain.Fetch("old-key")
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "yaml", id.Owner)
+	assert.Equal(t, []string{"database", "broken", "yaml"}, calls)
+
+	// misses report the failures
+	_, ok, err = chain.Fetch("missing-key")
+	assert.False(t, ok)
+	assert.Equal(t, errUnavailable, errors.Cause(err))
+	assert.Equal(t, "fetcher 1: storage unavailable", err.Error())
+
+	_, ok, err = Chain(failing(&calls, "a"), failing(&calls, "b")).Fetch("missing-key")
+	assert.False(t, ok)
+	require.IsType(t, Errors{}, err)
+	assert.Len(t, err.(Errors), 2)
+	assert.Equal(t, "2 fetchers failed: fetcher 0: storage unavailable; fetcher 1: storage unavailable", err.Error())
+
+	_, ok, err = Chain().Fetch("missing-key")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func Test_Fallback(t *testing.T) {
+	var calls []string
+
+	// the secondary is not consulted when the primary succeeds
+	_, ok, err := Fallback(fixed(&calls, "primary"), fixed(&calls, "secondary", "some-key")).Fetch("some-key")
+	require.Nil(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, []string{"primary"}, calls)
+
+	// the secondary is consulted when the primary fails
+	calls = nil
+	id, ok, err := Fallback(failing(&calls, "primary"), fixed(&calls, "secondary", "some-key")).Fetch("some-key")
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "secondary", id.Owner)
+	assert.Equal(t, []string{"primary", "secondary"}, calls)
+
+	_, _, err = Fallback(failing(&calls, "primary"), failing(&calls, "secondary")).Fetch("some-key")
+	assert.Equal(t, "2 fetchers failed: primary fetcher: storage unavailable; secondary fetcher: storage unavailable", err.Error())
+}
+
+func Test_PrefixRouter(t *testing.T) {
+	var calls []string
+	router := PrefixRouter(map[string]Fetcher{
+		"svc-":        fixed(&calls, "services", "svc-api", "svc-legacy-api"),
+		"svc-legacy-": fixed(&calls, "legacy", "svc-legacy-api"),
+		"broken-":     failing(&calls, "broken"),
+	}, fixed(&calls, "default", "other-key"))
+
+	for key, owner := range map[string]string{
+		"svc-api":        "services",
+		"svc-legacy-api": "legacy",
+		"other-key":      "default",
+	} {
+		id, ok, err := router.Fetch(key)
+		require.Nil(t, err, key)
+		require.True(t, ok, key)
+		assert.Equal(t, owner, id.Owner, key)
+	}
+
+	_, ok, err := router.Fetch("broken-key")
+	assert.False(t, ok)
+	assert.Equal(t, errUnavailable, errors.Cause(err))
+	assert.Equal(t, `fetcher for prefix "broken-": storage unavailable`, err.Error())
+
+	_, _, err = PrefixRouter(nil, failing(&calls, "default")).Fetch("other-key")
+	assert.Equal(t, "fallback fetcher: storage unavailable", err.Error())
+
+	// without a fallback unrouted keys are not found
+	_, ok, err = PrefixRouter(nil, nil).Fetch("other-key")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
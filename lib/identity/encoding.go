@@ -0,0 +1,380 @@
+package identity
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/georgemac/hola/lib/secrets"
+	"github.com/pkg/errors"
+)
+
+// ErrMalformedIdentity is returned when an encoded identity cannot be decoded.
+var ErrMalformedIdentity = errors.New("malformed identity")
+
+// IsMalformed returns true if the error returned decoding an identity is the result
+// of the identity being invalid, such as having an unsupported signing method or a
+// secret which cannot be decoded, as opposed to the encoding itself being invalid.
+func IsMalformed(err error) bool {
+	switch errors.Cause(err) {
+	case ErrMalformedIdentity,
+		secrets.ErrReferenceMissing,
+		secrets.ErrReferenceInvalid,
+		secrets.ErrReferenceNotAllowed:
+		return true
+	}
+
+	return false
+}
+
+// record is the encoded representation of an Identity, shared by every format.
+// The signing method is encoded as its algorithm name and secrets as strings,
+// which are resolved using secrets.Resolve.
+type record struct {
+	Key    string   `yaml:"key" json:"key" toml:"key"`
+	Secret string   `yaml:"secret,omitempty" json:"secret,omitempty" toml:"secret,omitempty"`
+	Scopes []string `yaml:"scopes,omitempty" json:"scopes,omitempty" toml:"scopes,omitempty"`
+	Method string   `yaml:"signing_method" json:"signing_method" toml:"signing_method"`
+	Policy *policy  `yaml:"policy,omitempty" json:"policy,omitempty" toml:"policy,omitempty"`
+
+	CreatedAt   *time.Time `yaml:"created_at,omitempty" json:"created_at,omitempty" toml:"created_at,omitempty"`
+	ExpiresAt   *time.Time `yaml:"expires_at,omitempty" json:"expires_at,omitempty" toml:"expires_at,omitempty"`
+	Disabled    bool       `yaml:"disabled,omitempty" json:"disabled,omitempty" toml:"disabled,omitempty"`
+	Owner       string     `yaml:"owner,omitempty" json:"owner,omitempty" toml:"owner,omitempty"`
+	Description string     `yaml:"description,omitempty" json:"description,omitempty" toml:"description,omitempty"`
+
+	Retired *retiredSecret `yaml:"retired_secret,omitempty" json:"retired_secret,omitempty" toml:"retired_secret,omitempty"`
+}
+
+type retiredSecret struct {
+	Secret    string    `yaml:"secret,omitempty" json:"secret,omitempty" toml:"secret,omitempty"`
+	ExpiresAt time.Time `yaml:"expires_at" json:"expires_at" toml:"expires_at"`
+}
+
+// newRecord returns the record for the identity, with its secrets encoded using secrets.Encode.
+func newRecord(i Identity) record {
+	r := record{
+		Key:         i.Key,
+		Secret:      secrets.Encode(i.Secret),
+		Scopes:      i.Scopes,
+		CreatedAt:   optionalTime(i.CreatedAt),
+		ExpiresAt:   optionalTime(i.ExpiresAt),
+		Disabled:    i.Disabled,
+		Owner:       i.Owner,
+		Description: i.Description,
+	}
+
+	if i.Method != nil {
+		r.Method = i.Method.Alg()
+	}
+
+	if !i.Policy.isZero() {
+		policy := newPolicy(i.Policy)
+		r.Policy = &policy
+	}
+
+	if i.Retired != nil {
+		r.Retired = &retiredSecret{Secret: secrets.Encode(i.Retired.Secret), ExpiresAt: i.Retired.ExpiresAt}
+	}
+
+	return r
+}
+
+// rejectEncrypted returns decodeSecret for identities which are never decrypted, rejecting
+// encrypted secrets rather than returning them as is, so they are not used as secrets.
+func rejectEncrypted(decodeSecret func(string) ([]byte, error)) func(string) ([]byte, error) {
+	return func(value string) ([]byte, error) {
+		if secrets.IsEncrypted([]byte(value)) {
+			return nil, errors.Wrap(ErrMalformedIdentity, "encrypted secret without a key provider")
+		}
+
+		return decodeSecret(value)
+	}
+}
+
+// decode sets the identity from the record, decoding its secrets with decodeSecret,
+// such as secrets.Resolve.
+func (r record) decode(i *Identity, decodeSecret func(string) ([]byte, error)) error {
+	secret, err := decodeSecret(r.Secret)
+	if err != nil {
+		return errors.Wrapf(err, "identity %q", r.Key)
+	}
+
+	method, err := ParseMethod(r.Method)
+	if err != nil {
+		return errors.Wrapf(ErrMalformedIdentity, "identity %q: %v", r.Key, err)
+	}
+
+	*i = Identity{
+		Key:         r.Key,
+		Secret:      secret,
+		Scopes:      r.Scopes,
+		Method:      method,
+		Disabled:    r.Disabled,
+		Owner:       r.Owner,
+		Description: r.Description,
+	}
+
+	if r.Policy != nil {
+		if i.Policy, err = r.Policy.decode(); err != nil {
+			return errors.Wrapf(err, "identity %q", r.Key)
+		}
+	}
+
+	if r.CreatedAt != nil {
+		i.CreatedAt = *r.CreatedAt
+	}
+
+	if r.ExpiresAt != nil {
+		i.ExpiresAt = *r.ExpiresAt
+	}
+
+	if r.Retired != nil {
+		secret, err := decodeSecret(r.Retired.Secret)
+		if err != nil {
+			return errors.Wrapf(err, "identity %q retired secret", r.Key)
+		}
+
+		i.Retired = &RetiredSecret{Secret: secret, ExpiresAt: r.Retired.ExpiresAt}
+	}
+
+	return nil
+}
+
+// redacted returns the record without its secrets
+func (r record) redacted() record {
+	r.Secret = ""
+	if r.Retired != nil {
+		r.Retired = &retiredSecret{ExpiresAt: r.Retired.ExpiresAt}
+	}
+
+	return r
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+// MarshalJSON produces the same structure as MarshalYAML, encoded as JSON.
+func (i Identity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newRecord(i))
+}
+
+// UnmarshalJSON parses identities in the format produced by MarshalJSON.
+// As with UnmarshalYAML, the secret may be a reference to the secret.
+func (i *Identity) UnmarshalJSON(data []byte) error {
+	var r record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return err
+	}
+
+	return r.decode(i, rejectEncrypted(secrets.Resolve))
+}
+
+// Redacted is an Identity which is marshalled without its secrets, or references
+// to them, so identities can be logged and listed safely. Convert an identity with
+// Redacted(id). The output is otherwise that of the Identity, and only decodes to
+// an Identity without a secret.
+type Redacted Identity
+
+// MarshalYAML performs the same marshalling as Identity, omitting secrets.
+func (r Redacted) MarshalYAML() (interface{}, error) {
+	return newRecord(Identity(r)).redacted(), nil
+}
+
+// MarshalJSON performs the same marshalling as Identity, omitting secrets.
+func (r Redacted) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newRecord(Identity(r)).redacted())
+}
+
+// String returns a single line summary of the identity for logging.
+func (r Redacted) String() string {
+	method := "none"
+	if r.Method != nil {
+		method = r.Method.Alg()
+	}
+
+	summary := fmt.Sprintf("identity %q method=%s scopes=[%s]", r.Key, method, strings.Join(r.Scopes, " "))
+	if r.Disabled {
+		summary += " disabled"
+	}
+
+	if !r.ExpiresAt.IsZero() {
+		summary += " expires=" + r.ExpiresAt.Format(time.RFC3339)
+	}
+
+	return summary
+}
+
+// policy is the encoded representation of a Policy, with the max lifetime as a duration string.
+type policy struct {
+	MaxLifetime    string   `yaml:"max_lifetime,omitempty" json:"max_lifetime,omitempty" toml:"max_lifetime,omitempty"`
+	Audiences      []string `yaml:"audiences,omitempty" json:"audiences,omitempty" toml:"audiences,omitempty"`
+	Subjects       []string `yaml:"subjects,omitempty" json:"subjects,omitempty" toml:"subjects,omitempty"`
+	RequiredClaims []string `yaml:"required_claims,omitempty" json:"required_claims,omitempty" toml:"required_claims,omitempty"`
+}
+
+func newPolicy(p Policy) policy {
+	encoded := policy{Audiences: p.Audiences, Subjects: p.Subjects, RequiredClaims: p.RequiredClaims}
+	if p.MaxLifetime != 0 {
+		encoded.MaxLifetime = p.MaxLifetime.String()
+	}
+
+	return encoded
+}
+
+// decode returns the policy, parsing the max lifetime
+func (p policy) decode() (Policy, error) {
+	decoded := Policy{Audiences: p.Audiences, Subjects: p.Subjects, RequiredClaims: p.RequiredClaims}
+	if p.MaxLifetime != "" {
+		lifetime, err := time.ParseDuration(p.MaxLifetime)
+		if err != nil {
+			return Policy{}, errors.Wrapf(ErrMalformedIdentity, "max_lifetime: %v", err)
+		}
+
+		decoded.MaxLifetime = lifetime
+	}
+
+	return decoded, nil
+}
+
+func (p Policy) isZero() bool {
+	return p.MaxLifetime == 0 && len(p.Audiences) == 0 && len(p.Subjects) == 0 && len(p.RequiredClaims) == 0
+}
+
+// MarshalJSON encodes the policy with the max lifetime as a duration string, such as "1h0m0s".
+func (p Policy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newPolicy(p))
+}
+
+// UnmarshalJSON parses policies in the format produced by MarshalJSON.
+func (p *Policy) UnmarshalJSON(data []byte) error {
+	var encoded policy
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+
+	decoded, err := encoded.decode()
+	if err != nil {
+		return err
+	}
+
+	*p = decoded
+	return nil
+}
+
+// MarshalTOML encodes the identities as a TOML document, in which each identity is
+// a table of the array named identities with the structure of Identity.MarshalYAML.
+func MarshalTOML(identities []Stored) ([]byte, error) {
+	document := struct {
+		Identities []record `toml:"identities"`
+	}{Identities: make([]record, 0, len(identities))}
+
+	for _, id := range identities {
+		document.Identities = append(document.Identities, id.record())
+	}
+
+	var buf bytes.Buffer
+	enc := toml.NewEncoder(&buf)
+	enc.Indent = ""
+	if err := enc.Encode(document); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// MarshalTOML encodes the identity as a TOML inline table with the structure of
+// MarshalYAML, so identities nested in other documents are written as records.
+func (i Identity) MarshalTOML() ([]byte, error) {
+	return inlineTOML(newRecord(i))
+}
+
+// inlineTOML encodes the struct v as a TOML inline table, using the names and
+// omitempty options of its toml tags. Fields which are structs, or pointers to
+// structs, are encoded as nested inline tables and other values by the encoder.
+func inlineTOML(v interface{}) ([]byte, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for n := 0; n < rv.NumField(); n++ {
+		field := rv.Field(n)
+		tag := strings.Split(rv.Type().Field(n).Tag.Get("toml"), ",")
+		if (field.Kind() == reflect.Ptr && field.IsNil()) ||
+			(len(tag) > 1 && tag[1] == "omitempty" && (field.IsZero() || field.Kind() == reflect.Slice && field.Len() == 0)) {
+			continue
+		}
+
+		value, err := tomlValue(field.Interface())
+		if err != nil {
+			return nil, err
+		}
+
+		if buf.Len() > 1 {
+			buf.WriteString(", ")
+		}
+
+		fmt.Fprintf(&buf, "%s = %s", tag[0], value)
+	}
+
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// tomlValue encodes v as the value of a TOML key
+func tomlValue(v interface{}) ([]byte, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() == reflect.Struct && rv.Type() != reflect.TypeOf(time.Time{}) {
+		return inlineTOML(rv.Interface())
+	}
+
+	// the encoder only encodes documents, so the value is encoded as one
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(map[string]interface{}{"v": rv.Interface()}); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(bytes.TrimPrefix(buf.Bytes(), []byte("v = ")), []byte("\n")), nil
+}
+
+// UnmarshalTOML parses identities from a table in the format written by MarshalTOML,
+// as an inline table or a table of an array. Timestamps may be TOML datetimes or
+// RFC 3339 strings and durations are strings, such as "1h".
+func (i *Identity) UnmarshalTOML(data interface{}) error {
+	r, err := decodeTOML(data)
+	if err != nil {
+		return err
+	}
+
+	return r.decode(i, rejectEncrypted(secrets.Resolve))
+}
+
+// decodeTOML decodes the record from a table decoded by a TOML parser
+func decodeTOML(data interface{}) (record, error) {
+	table, ok := data.(map[string]interface{})
+	if !ok {
+		return record{}, errors.Wrapf(ErrMalformedIdentity, "expected table found %T", data)
+	}
+
+	// the decoder only decodes documents, so the table is encoded as one
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(table); err != nil {
+		return record{}, errors.Wrap(ErrMalformedIdentity, err.Error())
+	}
+
+	var r record
+	if _, err := toml.Decode(buf.String(), &r); err != nil {
+		return record{}, errors.Wrap(ErrMalformedIdentity, err.Error())
+	}
+
+	return r, nil
+}
@@ -0,0 +1,37 @@
+package identity
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// NewKey returns a random key for a new identity.
+func NewKey() (string, error) {
+	data, err := random(8)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(data), nil
+}
+
+// NewSecret returns a secret generated from n random bytes. The secret is
+// encoded as unpadded base64url, so that it can be shared as text.
+func NewSecret(n int) ([]byte, error) {
+	data, err := random(n)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(base64.RawURLEncoding.EncodeToString(data)), nil
+}
+
+func random(n int) ([]byte, error) {
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
@@ -1,11 +1,16 @@
 package identity
 
 import (
+	"time"
+
+	"github.com/georgemac/hola/lib/secrets"
+	"github.com/pkg/errors"
 	"gopkg.in/jose.v1/crypto"
-	"gopkg.in/jose.v1/jws"
 	"gopkg.in/jose.v1/jwt"
 )
 
+var now = time.Now
+
 // Identity is a struct which contains a secret used
 // to decode a token and the relevant signing mechanism
 // used to encode it in the first place.
@@ -14,32 +19,109 @@ type Identity struct {
 	Secret []byte               `yaml:"secret"`
 	Scopes []string             `yaml:"scopes"`
 	Method crypto.SigningMethod `yaml:"signing_method"`
+	Policy Policy               `yaml:"policy"`
+
+	// lifecycle metadata
+	CreatedAt   time.Time `yaml:"created_at"`
+	ExpiresAt   time.Time `yaml:"expires_at"`
+	Disabled    bool      `yaml:"disabled"`
+	Owner       string    `yaml:"owner"`
+	Description string    `yaml:"description"`
+
+	// Retired is the secret replaced by the last rotation, if it is still
+	// within its grace period. See RetiredSecret.
+	Retired *RetiredSecret `yaml:"retired_secret"`
+}
+
+// RetiredSecret is a secret which has been rotated out of use. It no longer
+// signs tokens, but continues to verify them until ExpiresAt, so that tokens
+// issued before a rotation remain valid for a grace period.
+type RetiredSecret struct {
+	Secret    []byte
+	ExpiresAt time.Time
+}
+
+// Policy describes the constraints an identity places on the tokens
+// it issues, on top of those enforced for every identity.
+// Zero values are unconstrained.
+type Policy struct {
+	// MaxLifetime is the maximum permitted duration between a tokens IAT and EXP claims
+	MaxLifetime time.Duration `yaml:"max_lifetime,omitempty"`
+	// Audiences is the set of permitted AUD claims
+	Audiences []string `yaml:"audiences,omitempty"`
+	// Subjects is the set of permitted SUB claims
+	Subjects []string `yaml:"subjects,omitempty"`
+	// RequiredClaims is the set of claims which must be present
+	RequiredClaims []string `yaml:"required_claims,omitempty"`
+}
+
+// Expired returns true if the identity has an expiry which is not after now.
+func (i Identity) Expired(now time.Time) bool {
+	return !i.ExpiresAt.IsZero() && !now.Before(i.ExpiresAt)
+}
+
+// Clone returns a copy of the identity which shares none of its slices, so that
+// storage can return and update identities without modifying those it holds.
+func (i Identity) Clone() Identity {
+	i.Secret = copyBytes(i.Secret)
+	i.Scopes = copyStrings(i.Scopes)
+	i.Policy.Audiences = copyStrings(i.Policy.Audiences)
+	i.Policy.Subjects = copyStrings(i.Policy.Subjects)
+	i.Policy.RequiredClaims = copyStrings(i.Policy.RequiredClaims)
+
+	if i.Retired != nil {
+		retired := *i.Retired
+		retired.Secret = copyBytes(retired.Secret)
+		i.Retired = &retired
+	}
+
+	return i
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+
+	return append(make([]byte, 0, len(b)), b...)
+}
+
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+
+	return append(make([]string, 0, len(s)), s...)
 }
 
 // Validate calls validate on the JWT token with
 // the data and method embedded within the struct.
-func (i Identity) Validate(token jwt.JWT) error {
-	return token.Validate(i.Secret, i.Method)
+// Any provided validators are used to validate the tokens claims.
+// Tokens signed with a retired secret are valid until it expires.
+func (i Identity) Validate(token jwt.JWT, v ...*jwt.Validator) error {
+	err := token.Validate(i.Secret, i.Method, v...)
+	if errors.Cause(err) == crypto.ErrSignatureInvalid && i.Retired != nil && now().Before(i.Retired.ExpiresAt) {
+		return token.Validate(i.Retired.Secret, i.Method, v...)
+	}
+
+	return err
 }
 
-type identity struct {
-	Key    string   `yaml:"key"`
-	Secret string   `yaml:"secret"`
-	Scopes []string `yaml:"scopes"`
-	Method string   `yaml:"signing_method"`
+// MarshalYAML performs custom yaml marshalling, producing the format parsed by UnmarshalYAML.
+// Secrets are written using secrets.Encode.
+func (i Identity) MarshalYAML() (interface{}, error) {
+	return newRecord(i), nil
 }
 
 // UnmarshalYAML performs custom yaml unmarshalling to parse Identities properly
+// The secret may be a reference to the secret, which is resolved using secrets.Resolve.
+// Encrypted secrets are rejected with ErrMalformedIdentity, as only Stored and Sealed
+// identities are decrypted, by the storage or receiver holding the key provider.
 func (i *Identity) UnmarshalYAML(unmarshal func(interface{}) error) error {
-	var identity identity
-	if err := unmarshal(&identity); err != nil {
+	var r record
+	if err := unmarshal(&r); err != nil {
 		return err
 	}
 
-	i.Key = identity.Key
-	i.Secret = []byte(identity.Secret)
-	i.Scopes = identity.Scopes
-	i.Method = jws.GetSigningMethod(identity.Method)
-
-	return nil
+	return r.decode(i, rejectEncrypted(secrets.Resolve))
 }
@@ -0,0 +1,521 @@
+package identity
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/georgemac/hola/lib/secrets"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/jose.v1/crypto"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func Test_Identity_UnmarshalYAML(t *testing.T) {
+	data := []byte(`
+key: some-issuer-key
+secret: this is super secret
+scopes: [resource.action]
+signing_method: HS256
+policy:
+  max_lifetime: 1h
+  audiences: [test.audience.com]
+  subjects: [someone]
+  required_claims: [jti]
+created_at: 2017-07-14T02:40:00Z
+expires_at: 2018-07-14T02:40:00Z
+disabled: true
+owner: platform
+description: some client
+`)
+
+	var id Identity
+	require.Nil(t, yaml.Unmarshal(data, &id))
+	assert.Equal(t, Identity{
+		Key:    "some-issuer-key",
+		Secret: []byte("this is super secret"),
+		Scopes: []string{"resource.action"},
+		Method: crypto.SigningMethodHS256,
+		Policy: Policy{
+			MaxLifetime:    time.Hour,
+			Audiences:      []string{"test.audience.com"},
+			Subjects:       []string{"someone"},
+			RequiredClaims: []string{"jti"},
+		},
+		CreatedAt:   time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC),
+		ExpiresAt:   time.Date(2018, 7, 14, 2, 40, 0, 0, time.UTC),
+		Disabled:    true,
+		Owner:       "platform",
+		Description: "some client",
+	}, id)
+}
+
+func Test_Identity_Expired(t *testing.T) {
+	expiry := time.Date(2018, 7, 14, 2, 40, 0, 0, time.UTC)
+
+	assert.False(t, Identity{}.Expired(expiry))
+	assert.False(t, Identity{ExpiresAt: expiry}.Expired(expiry.Add(-time.Second)))
+	assert.True(t, Identity{ExpiresAt: expiry}.Expired(expiry))
+}
+
+func Test_Identity_UnmarshalYAML_SecretReference(t *testing.T) {
+	os.Setenv("HOLA_TEST_SECRET", "this is super secret")
+	defer os.Unsetenv("HOLA_TEST_SECRET")
+
+	var id Identity
+	require.Nil(t, yaml.Unmarshal([]byte("key: some-issuer-key\nsecret: env:HOLA_TEST_SECRET\nsigning_method: HS256\n"), &id))
+	assert.Equal(t, []byte("this is super secret"), id.Secret)
+
+	err := yaml.Unmarshal([]byte("key: some-issuer-key\nsecret: env:HOLA_TEST_MISSING_SECRET\nsigning_method: HS256\n"), &id)
+	assert.Equal(t, secrets.ErrReferenceMissing, errors.Cause(err))
+	assert.EqualError(t, err, `identity "some-issuer-key": secrets: environment variable "HOLA_TEST_MISSING_SECRET" not set: secret reference cannot be resolved`)
+}
+
+func Test_Identity_MarshalYAML(t *testing.T) {
+	id := Identity{
+		Key:       "some-issuer-key",
+		Secret:    []byte("this is super secret"),
+		Scopes:    []string{"resource.action"},
+		Method:    crypto.SigningMethodHS256,
+		Policy:    Policy{MaxLifetime: time.Hour},
+		CreatedAt: time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC),
+	}
+
+	data, err := yaml.Marshal(id)
+	require.Nil(t, err)
+	assert.Equal(t, `key: some-issuer-key
+secret: this is super secret
+scopes:
+- resource.action
+signing_method: HS256
+policy:
+  max_lifetime: 1h0m0s
+created_at: 2017-07-14T02:40:00Z
+`, string(data))
+
+	var found Identity
+	require.Nil(t, yaml.Unmarshal(data, &found))
+	assert.Equal(t, id, found)
+}
+
+func Test_Stored_SecretReference(t *testing.T) {
+	os.Setenv("HOLA_TEST_SECRET", "this is super secret")
+	defer os.Unsetenv("HOLA_TEST_SECRET")
+
+	document := "key: some-issuer-key\nsecret: env:HOLA_TEST_SECRET\nsigning_method: HS256\n"
+
+	// identities are written with their resolved secret
+	var id Identity
+	require.Nil(t, yaml.Unmarshal([]byte(document), &id))
+
+	data, err := yaml.Marshal(id)
+	require.Nil(t, err)
+	assert.Equal(t, "key: some-issuer-key\nsecret: this is super secret\nsigning_method: HS256\n", string(data))
+
+	// stored identities retain the reference
+	var stored Stored
+	require.Nil(t, yaml.Unmarshal([]byte(document), &stored))
+	assert.Equal(t, Stored{Identity: id, EncodedSecret: "env:HOLA_TEST_SECRET"}, stored)
+
+	data, err = yaml.Marshal(stored)
+	require.Nil(t, err)
+	assert.Equal(t, document, string(data))
+
+	data, err = json.Marshal(stored)
+	require.Nil(t, err)
+	assert.JSONEq(t, `{"key": "some-issuer-key", "secret": "env:HOLA_TEST_SECRET", "signing_method": "HS256"}`, string(data))
+
+	var found Stored
+	require.Nil(t, json.Unmarshal(data, &found))
+	assert.Equal(t, stored, found)
+
+	data, err = MarshalTOML([]Stored{stored})
+	require.Nil(t, err)
+	assert.Equal(t, "[[identities]]\nkey = \"some-issuer-key\"\nsecret = \"env:HOLA_TEST_SECRET\"\nsigning_method = \"HS256\"\n", string(data))
+}
+
+func Test_Portable(t *testing.T) {
+	id := Identity{
+		Key:    "some-issuer-key",
+		Secret: []byte("env:looks like a reference"),
+		Method: crypto.SigningMethodHS256,
+		Policy: Policy{MaxLifetime: 90 * time.Minute},
+		Retired: &RetiredSecret{
+			Secret:    []byte("enc:looks encrypted"),
+			ExpiresAt: time.Date(2017, 7, 15, 2, 40, 0, 0, time.UTC),
+		},
+	}
+
+	// portable identities are written as identities
+	expected, err := json.Marshal(id)
+	require.Nil(t, err)
+
+	data, err := json.Marshal(Portable(id))
+	require.Nil(t, err)
+	assert.Equal(t, string(expected), string(data))
+
+	var found Portable
+	require.Nil(t, json.Unmarshal(data, &found))
+	assert.Equal(t, id, Identity(found))
+
+	yamlData, err := yaml.Marshal(Portable(id))
+	require.Nil(t, err)
+
+	found = Portable{}
+	require.Nil(t, yaml.Unmarshal(yamlData, &found))
+	assert.Equal(t, id, Identity(found))
+
+	// encrypted secrets are rejected rather than used as secrets
+	err = json.Unmarshal([]byte(`{"key": "k", "secret": "enc:abc:def", "signing_method": "HS256"}`), &found)
+	assert.Equal(t, ErrMalformedIdentity, errors.Cause(err))
+
+	// references to the environment or files are never resolved
+	os.Setenv("HOLA_TEST_SECRET", "this is super secret")
+	defer os.Unsetenv("HOLA_TEST_SECRET")
+
+	for _, input := range []string{
+		`{"key": "k", "secret": "env:HOLA_TEST_SECRET", "signing_method": "HS256"}`,
+		`{"key": "k", "secret": "file:/etc/passwd", "signing_method": "HS256"}`,
+		`{"key": "k", "secret": "s", "signing_method": "HS256", "retired_secret": {"secret": "env:HOLA_TEST_SECRET"}}`,
+	} {
+		err := json.Unmarshal([]byte(input), &found)
+		assert.Equal(t, secrets.ErrReferenceNotAllowed, errors.Cause(err), input)
+		assert.True(t, IsMalformed(err), input)
+	}
+
+	err = yaml.Unmarshal([]byte("key: k\nsecret: file:/etc/passwd\nsigning_method: HS256\n"), &found)
+	assert.Equal(t, secrets.ErrReferenceNotAllowed, errors.Cause(err))
+}
+
+func Test_Sealed(t *testing.T) {
+	keys := secrets.MasterKey(bytes.Repeat([]byte{1}, 32))
+
+	encrypted, err := secrets.Encrypt(keys, []byte("this is super secret"))
+	require.Nil(t, err)
+
+	data, err := json.Marshal(map[string]interface{}{
+		"key":            "some-issuer-key",
+		"secret":         string(encrypted),
+		"signing_method": "HS256",
+		"retired_secret": map[string]string{"secret": "previous secret", "expires_at": "2017-07-15T02:40:00Z"},
+	})
+	require.Nil(t, err)
+
+	// encrypted secrets are kept until the identity is opened
+	var sealed Sealed
+	require.Nil(t, json.Unmarshal(data, &sealed))
+	assert.Equal(t, encrypted, sealed.Secret)
+
+	id, err := sealed.Open(keys)
+	require.Nil(t, err)
+	assert.Equal(t, Identity{
+		Key:    "some-issuer-key",
+		Secret: []byte("this is super secret"),
+		Method: crypto.SigningMethodHS256,
+		Retired: &RetiredSecret{
+			Secret:    []byte("previous secret"),
+			ExpiresAt: time.Date(2017, 7, 15, 2, 40, 0, 0, time.UTC),
+		},
+	}, id)
+
+	// without a key provider encrypted secrets are rejected
+	_, err = sealed.Open(nil)
+	assert.Equal(t, ErrMalformedIdentity, errors.Cause(err))
+	assert.True(t, IsMalformed(err))
+
+	// as they are by identities which are never decrypted
+	var plain Identity
+	err = json.Unmarshal(data, &plain)
+	assert.Equal(t, ErrMalformedIdentity, errors.Cause(err))
+
+	err = yaml.Unmarshal([]byte("key: k\nsecret: "+string(encrypted)+"\nsigning_method: HS256\n"), &plain)
+	assert.Equal(t, ErrMalformedIdentity, errors.Cause(err))
+
+	// references to the environment or files are never resolved
+	err = json.Unmarshal([]byte(`{"key": "k", "secret": "env:HOME", "signing_method": "HS256"}`), &sealed)
+	assert.Equal(t, secrets.ErrReferenceNotAllowed, errors.Cause(err))
+}
+
+func Test_Identity_UnsupportedMethod(t *testing.T) {
+	for _, method := range []string{"", "none", "RS256"} {
+		var id Identity
+		err := yaml.Unmarshal([]byte("key: k\nsecret: s\nsigning_method: \""+method+"\"\n"), &id)
+		assert.Equal(t, ErrMalformedIdentity, errors.Cause(err), method)
+		assert.True(t, IsMalformed(err), method)
+
+		err = json.Unmarshal([]byte(`{"key": "k", "secret": "s", "signing_method": "`+method+`"}`), &id)
+		assert.Equal(t, ErrMalformedIdentity, errors.Cause(err), method)
+
+		err = id.UnmarshalTOML(map[string]interface{}{"key": "k", "secret": "s", "signing_method": method})
+		assert.Equal(t, ErrMalformedIdentity, errors.Cause(err), method)
+	}
+
+	// errors in the encoding itself are not malformed identities
+	var id Identity
+	assert.False(t, IsMalformed(json.Unmarshal([]byte(`{"key": 1}`), &id)))
+}
+
+func Test_Identity_JSON(t *testing.T) {
+	id := Identity{
+		Key:       "some-issuer-key",
+		Secret:    []byte{0, 1, 2, 3},
+		Scopes:    []string{"resource.action"},
+		Method:    crypto.SigningMethodHS512,
+		Policy:    Policy{MaxLifetime: time.Hour, Audiences: []string{"test.audience.com"}},
+		CreatedAt: time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC),
+		Owner:     "platform",
+		Retired: &RetiredSecret{
+			Secret:    []byte("previous secret"),
+			ExpiresAt: time.Date(2017, 7, 15, 2, 40, 0, 0, time.UTC),
+		},
+	}
+
+	data, err := json.Marshal(id)
+	require.Nil(t, err)
+	assert.JSONEq(t, `{
+		"key": "some-issuer-key",
+		"secret": "base64:AAECAw==",
+		"scopes": ["resource.action"],
+		"signing_method": "HS512",
+		"policy": {"max_lifetime": "1h0m0s", "audiences": ["test.audience.com"]},
+		"created_at": "2017-07-14T02:40:00Z",
+		"owner": "platform",
+		"retired_secret": {"secret": "previous secret", "expires_at": "2017-07-15T02:40:00Z"}
+	}`, string(data))
+
+	// non-printable secrets are encoded as base64 references
+	var found Identity
+	require.Nil(t, json.Unmarshal(data, &found))
+	assert.Equal(t, id, found)
+
+	// the same secret references are supported as yaml
+	os.Setenv("HOLA_TEST_SECRET", "this is super secret")
+	defer os.Unsetenv("HOLA_TEST_SECRET")
+
+	require.Nil(t, json.Unmarshal([]byte(`{"key": "some-issuer-key", "secret": "env:HOLA_TEST_SECRET", "signing_method": "HS256"}`), &found))
+	assert.Equal(t, []byte("this is super secret"), found.Secret)
+	assert.Equal(t, crypto.SigningMethodHS256, found.Method)
+
+	err = json.Unmarshal([]byte(`{"key": "some-issuer-key", "policy": {"max_lifetime": "forever"}}`), &found)
+	assert.Equal(t, ErrMalformedIdentity, errors.Cause(err))
+}
+
+func Test_Identity_TOML(t *testing.T) {
+	id := Identity{
+		Key:         "some-issuer-key",
+		Secret:      []byte("this is \"super\" secret"),
+		Scopes:      []string{"resource.action", "other.action"},
+		Method:      crypto.SigningMethodHS256,
+		Policy:      Policy{MaxLifetime: time.Hour, RequiredClaims: []string{"jti"}},
+		ExpiresAt:   time.Date(2018, 7, 14, 2, 40, 0, 0, time.UTC),
+		Disabled:    true,
+		Description: "line one\nline two",
+	}
+
+	data, err := MarshalTOML([]Stored{{Identity: id}})
+	require.Nil(t, err)
+	assert.Equal(t, `[[identities]]
+key = "some-issuer-key"
+secret = "this is \"super\" secret"
+scopes = ["resource.action", "other.action"]
+signing_method = "HS256"
+expires_at = 2018-07-14T02:40:00Z
+disabled = true
+description = "line one\nline two"
+[identities.policy]
+max_lifetime = "1h0m0s"
+required_claims = ["jti"]
+`, string(data))
+
+	var document struct {
+		Identities []Identity `toml:"identities"`
+	}
+
+	require.Nil(t, toml.Unmarshal(data, &document))
+	assert.Equal(t, []Identity{id}, document.Identities)
+
+	// inline tables
+	require.Nil(t, toml.Unmarshal([]byte(`identities = [{key = "some-issuer-key", secret = "this is \"super\" secret", `+
+		`scopes = ["resource.action", "other.action"], signing_method = "HS256", `+
+		`policy = {max_lifetime = "1h0m0s", required_claims = ["jti"]}, `+
+		`expires_at = 2018-07-14T02:40:00Z, disabled = true, description = "line one\nline two"}]`), &document))
+	assert.Equal(t, []Identity{id}, document.Identities)
+
+	// tables written by hand
+	require.Nil(t, toml.Unmarshal([]byte(`
+[[identities]]
+key = "some-issuer-key"
+secret = "base64:AAECAw=="
+signing_method = "HS512"
+created_at = 2017-07-14T02:40:00Z
+expires_at = "2018-07-14T02:40:00Z"
+
+[identities.policy]
+max_lifetime = "1h"
+
+[identities.retired_secret]
+secret = "previous secret"
+expires_at = 2017-07-15T02:40:00Z
+`), &document))
+	assert.Equal(t, []Identity{{
+		Key:       "some-issuer-key",
+		Secret:    []byte{0, 1, 2, 3},
+		Method:    crypto.SigningMethodHS512,
+		Policy:    Policy{MaxLifetime: time.Hour},
+		CreatedAt: time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC),
+		ExpiresAt: time.Date(2018, 7, 14, 2, 40, 0, 0, time.UTC),
+		Retired: &RetiredSecret{
+			Secret:    []byte("previous secret"),
+			ExpiresAt: time.Date(2017, 7, 15, 2, 40, 0, 0, time.UTC),
+		},
+	}}, document.Identities)
+
+	for _, input := range []string{
+		`identities = [{key = 1}]`,
+		`identities = [{key = "k", scopes = "resource.action"}]`,
+		`identities = [{key = "k", scopes = ["resource.action", 1]}]`,
+		`identities = [{key = "k", policy = "none"}]`,
+		`identities = [{key = "k", policy = {max_lifetime = "forever"}}]`,
+		`identities = [{key = "k", created_at = "yesterday"}]`,
+	} {
+		err := toml.Unmarshal([]byte(input), &document)
+		require.NotNil(t, err, input)
+		assert.Contains(t, err.Error(), ErrMalformedIdentity.Error(), input)
+	}
+}
+
+func Test_Identity_MarshalTOML(t *testing.T) {
+	id := Identity{
+		Key:       "some-issuer-key",
+		Secret:    []byte("this is \"super\" secret"),
+		Scopes:    []string{"resource.action"},
+		Method:    crypto.SigningMethodHS256,
+		Policy:    Policy{MaxLifetime: time.Hour},
+		CreatedAt: time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC),
+		Retired: &RetiredSecret{
+			Secret:    []byte("previous secret"),
+			ExpiresAt: time.Date(2017, 7, 15, 2, 40, 0, 0, time.UTC),
+		},
+	}
+
+	type document struct {
+		Identities []Identity `toml:"identities"`
+		Stored     []Stored   `toml:"stored"`
+	}
+
+	var buf bytes.Buffer
+	require.Nil(t, toml.NewEncoder(&buf).Encode(document{
+		Identities: []Identity{id},
+		Stored:     []Stored{{Identity: id, EncodedSecret: "env:HOLA_TEST_SECRET"}},
+	}))
+	assert.Equal(t, `identities = [{key = "some-issuer-key", secret = "this is \"super\" secret", scopes = ["resource.action"], `+
+		`signing_method = "HS256", policy = {max_lifetime = "1h0m0s"}, created_at = 2017-07-14T02:40:00Z, `+
+		`retired_secret = {secret = "previous secret", expires_at = 2017-07-15T02:40:00Z}}]
+stored = [{key = "some-issuer-key", secret = "env:HOLA_TEST_SECRET", scopes = ["resource.action"], `+
+		`signing_method = "HS256", policy = {max_lifetime = "1h0m0s"}, created_at = 2017-07-14T02:40:00Z, `+
+		`retired_secret = {secret = "previous secret", expires_at = 2017-07-15T02:40:00Z}}]
+`, buf.String())
+
+	os.Setenv("HOLA_TEST_SECRET", string(id.Secret))
+	defer os.Unsetenv("HOLA_TEST_SECRET")
+
+	var decoded document
+	require.Nil(t, toml.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, []Identity{id}, decoded.Identities)
+	assert.Equal(t, []Stored{{Identity: id, EncodedSecret: "env:HOLA_TEST_SECRET"}}, decoded.Stored)
+}
+
+func Test_Identity_RoundTrip(t *testing.T) {
+	id := Identity{
+		Key:    "some-issuer-key",
+		Secret: []byte("this is super secret"),
+		Scopes: []string{"resource.action", "other.action"},
+		Method: crypto.SigningMethodHS384,
+		Policy: Policy{
+			MaxLifetime:    90 * time.Minute,
+			Audiences:      []string{"test.audience.com"},
+			Subjects:       []string{"someone"},
+			RequiredClaims: []string{"jti"},
+		},
+		CreatedAt:   time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC),
+		ExpiresAt:   time.Date(2018, 7, 14, 2, 40, 0, 0, time.UTC),
+		Disabled:    true,
+		Owner:       "platform",
+		Description: "some client",
+		Retired: &RetiredSecret{
+			Secret:    []byte("previous secret"),
+			ExpiresAt: time.Date(2017, 7, 15, 2, 40, 0, 0, time.UTC),
+		},
+	}
+
+	for _, testCase := range []struct {
+		name      string
+		marshal   func(interface{}) ([]byte, error)
+		unmarshal func([]byte, interface{}) error
+	}{
+		{name: "yaml", marshal: yaml.Marshal, unmarshal: yaml.Unmarshal},
+		{name: "json", marshal: json.Marshal, unmarshal: json.Unmarshal},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			data, err := testCase.marshal(id)
+			require.Nil(t, err)
+
+			var found Identity
+			require.Nil(t, testCase.unmarshal(data, &found))
+			assert.Equal(t, id, found)
+
+			// writing the identity back produces the same document
+			again, err := testCase.marshal(found)
+			require.Nil(t, err)
+			assert.Equal(t, string(data), string(again))
+		})
+	}
+}
+
+func Test_Identity_Redacted(t *testing.T) {
+	id := Identity{
+		Key:       "some-issuer-key",
+		Secret:    []byte("this is super secret"),
+		Scopes:    []string{"resource.action", "other.action"},
+		Method:    crypto.SigningMethodHS256,
+		ExpiresAt: time.Date(2018, 7, 14, 2, 40, 0, 0, time.UTC),
+		Disabled:  true,
+		Retired: &RetiredSecret{
+			Secret:    []byte("previous secret"),
+			ExpiresAt: time.Date(2017, 7, 15, 2, 40, 0, 0, time.UTC),
+		},
+	}
+
+	data, err := yaml.Marshal(Redacted(id))
+	require.Nil(t, err)
+	assert.Equal(t, `key: some-issuer-key
+scopes:
+- resource.action
+- other.action
+signing_method: HS256
+expires_at: 2018-07-14T02:40:00Z
+disabled: true
+retired_secret:
+  expires_at: 2017-07-15T02:40:00Z
+`, string(data))
+
+	data, err = json.Marshal([]Redacted{Redacted(id)})
+	require.Nil(t, err)
+	assert.JSONEq(t, `[{
+		"key": "some-issuer-key",
+		"scopes": ["resource.action", "other.action"],
+		"signing_method": "HS256",
+		"expires_at": "2018-07-14T02:40:00Z",
+		"disabled": true,
+		"retired_secret": {"expires_at": "2017-07-15T02:40:00Z"}
+	}]`, string(data))
+
+	assert.Equal(t, `identity "some-issuer-key" method=HS256 scopes=[resource.action other.action] disabled expires=2018-07-14T02:40:00Z`, Redacted(id).String())
+	assert.Equal(t, `identity "" method=none scopes=[]`, fmt.Sprint(Redacted{}))
+}
@@ -1,22 +1,281 @@
 package identity
 
-// validate at compile time that IssuerFunc implements Issuer.
-var _ Issuer = IssuerFunc(nil)
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/jose.v1/crypto"
+	"gopkg.in/jose.v1/jws"
+)
+
+// validate at compile time that IssuerFunc and Generator implement Issuer.
+var (
+	_ Issuer = IssuerFunc(nil)
+	_ Issuer = (*Generator)(nil)
+)
+
+const (
+	// DefaultSecretLength is the number of random bytes used to generate a secret
+	// when an IssueRequest does not specify a length.
+	DefaultSecretLength = 32
+
+	// DefaultMaxSecretLength is the maximum number of random bytes in a secret
+	// when an IssuePolicy does not specify a maximum.
+	DefaultMaxSecretLength = 1024
+)
+
+var (
+	// ErrUnsupportedMethod is returned when a signing method cannot be used with a generated secret.
+	ErrUnsupportedMethod = errors.New("signing method must be one of HS256, HS384 or HS512")
+
+	// ErrMethodNotAllowed is returned when an issue policy does not permit a signing method.
+	ErrMethodNotAllowed = errors.New("signing method not allowed")
+
+	// ErrScopeNotAllowed is returned when an issue policy does not permit a scope.
+	ErrScopeNotAllowed = errors.New("scope not allowed")
+
+	// ErrSecretTooShort is returned when a requested secret length is below the policy minimum.
+	ErrSecretTooShort = errors.New("secret length below minimum")
+
+	// ErrSecretTooLong is returned when a requested secret length is above the policy maximum.
+	ErrSecretTooLong = errors.New("secret length above maximum")
+
+	// ErrLifetimeNotAllowed is returned when a requested expiry exceeds the policy maximum lifetime.
+	ErrLifetimeNotAllowed = errors.New("identity lifetime not allowed")
+
+	// ErrKeyInUse is returned when issuing an identity for a key which is already in use.
+	ErrKeyInUse = errors.New("key already in use")
+)
 
 // Issuer is an interface which describes the mechanism required
 // to be implemented by a storage layer, in order to issue a new
 // identity.
 type Issuer interface {
-	Issue() (identity Identity, err error)
+	Issue(req IssueRequest) (identity Identity, err error)
 }
 
 // IssuerFunc implements the Issuer interface.
 // This allows for simple functions to be used as an Issuer.
-type IssuerFunc func() (Identity, error)
+type IssuerFunc func(IssueRequest) (Identity, error)
+
+// Issue returns a new identity with the attributes of the request.
+// The returned identity is the only place its secret is made available.
+func (i IssuerFunc) Issue(req IssueRequest) (Identity, error) {
+	return i(req)
+}
+
+// IssueRequest describes an identity to be issued.
+type IssueRequest struct {
+	// Scopes granted to the identity
+	Scopes []string
+	// Method is the signing method algorithm, which defaults to HS256
+	Method string
+	// Key is the key of the identity, which is generated when empty
+	Key string
+	// KeyPrefix is prepended to the generated key
+	KeyPrefix string
+	// SecretLength is the number of random bytes in the secret, which defaults to DefaultSecretLength
+	SecretLength int
+	// ExpiresAt is the expiry of the identity, zero never expires
+	ExpiresAt time.Time
+
+	// metadata
+	Owner       string
+	Description string
+}
+
+// IssuePolicy constrains the identities which can be issued.
+// Zero values are unconstrained.
+type IssuePolicy struct {
+	// Methods is the set of permitted signing method algorithms
+	Methods []string
+	// Scopes is the set of permitted scopes
+	Scopes []string
+	// MinSecretLength is the minimum number of random bytes in a secret
+	MinSecretLength int
+	// MaxSecretLength is the maximum number of random bytes in a secret,
+	// which defaults to DefaultMaxSecretLength
+	MaxSecretLength int
+	// MaxLifetime is the maximum duration until an identity expires,
+	// when set identities must expire
+	MaxLifetime time.Duration
+}
+
+// Validate returns an error when the request is not permitted by the policy.
+func (p IssuePolicy) Validate(req IssueRequest, now time.Time) error {
+	if method := req.method(); len(p.Methods) > 0 && !contains(p.Methods, method) {
+		return errors.Wrapf(ErrMethodNotAllowed, "found %q", method)
+	}
+
+	if len(p.Scopes) > 0 {
+		for _, scope := range req.Scopes {
+			if !contains(p.Scopes, scope) {
+				return errors.Wrapf(ErrScopeNotAllowed, "found %q", scope)
+			}
+		}
+	}
+
+	length := req.secretLength()
+	if min := p.minSecretLength(); length < min {
+		return errors.Wrapf(ErrSecretTooShort, "found %d, minimum %d", length, min)
+	}
+
+	// secrets are allocated up front, so requests must not be unbounded
+	if max := p.maxSecretLength(); length > max {
+		return errors.Wrapf(ErrSecretTooLong, "found %d, maximum %d", length, max)
+	}
+
+	if p.MaxLifetime > 0 && (req.ExpiresAt.IsZero() || req.ExpiresAt.Sub(now) > p.MaxLifetime) {
+		return errors.Wrapf(ErrLifetimeNotAllowed, "maximum %v", p.MaxLifetime)
+	}
+
+	return nil
+}
+
+// ValidateUpdate returns an error when an update from previous to updated grants
+// a scope or signing method which the policy does not permit. Only the changes are
+// validated, so identities issued under an earlier policy can still be updated.
+func (p IssuePolicy) ValidateUpdate(previous, updated Identity) error {
+	if updated.Method != nil && len(p.Methods) > 0 && (previous.Method == nil || previous.Method.Alg() != updated.Method.Alg()) {
+		if method := updated.Method.Alg(); !contains(p.Methods, method) {
+			return errors.Wrapf(ErrMethodNotAllowed, "found %q", method)
+		}
+	}
+
+	if len(p.Scopes) > 0 {
+		for _, scope := range updated.Scopes {
+			if !contains(previous.Scopes, scope) && !contains(p.Scopes, scope) {
+				return errors.Wrapf(ErrScopeNotAllowed, "found %q", scope)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p IssuePolicy) minSecretLength() int {
+	if p.MinSecretLength < 1 {
+		return 1
+	}
+
+	return p.MinSecretLength
+}
+
+func (p IssuePolicy) maxSecretLength() int {
+	if p.MaxSecretLength == 0 {
+		return DefaultMaxSecretLength
+	}
+
+	return p.MaxSecretLength
+}
+
+// secretLength is the number of random bytes in a rotated secret, which is
+// DefaultSecretLength bounded by the minimum and maximum lengths of the policy.
+func (p IssuePolicy) secretLength() int {
+	length := DefaultSecretLength
+	if min := p.minSecretLength(); length < min {
+		length = min
+	}
+
+	if max := p.maxSecretLength(); length > max {
+		length = max
+	}
+
+	return length
+}
+
+func (r IssueRequest) method() string {
+	if r.Method == "" {
+		return crypto.SigningMethodHS256.Alg()
+	}
+
+	return r.Method
+}
+
+func (r IssueRequest) secretLength() int {
+	if r.SecretLength == 0 {
+		return DefaultSecretLength
+	}
+
+	return r.SecretLength
+}
+
+// ParseMethod returns the signing method for the algorithm, which must
+// be one of the HMAC methods as identity secrets are shared keys.
+func ParseMethod(alg string) (crypto.SigningMethod, error) {
+	method, ok := jws.GetSigningMethod(alg).(*crypto.SigningMethodHMAC)
+	if !ok {
+		return nil, errors.Wrapf(ErrUnsupportedMethod, "found %q", alg)
+	}
+
+	return method, nil
+}
+
+// Generator is an in-memory Issuer which generates identities with random keys
+// and secrets, read from crypto/rand, once requests are validated against its policy.
+// Generated identities are not stored, so storage layers use a Generator to
+// construct identities before storing them.
+type Generator struct {
+	policy IssuePolicy
+}
+
+// NewGenerator returns a Generator which validates requests against the policy.
+func NewGenerator(policy IssuePolicy) *Generator {
+	return &Generator{policy: policy}
+}
+
+// Issue generates a new identity with the attributes of the request.
+func (g *Generator) Issue(req IssueRequest) (Identity, error) {
+	method, err := ParseMethod(req.method())
+	if err != nil {
+		return Identity{}, err
+	}
+
+	issuedAt := now().UTC().Truncate(time.Second)
+	if err := g.policy.Validate(req, issuedAt); err != nil {
+		return Identity{}, err
+	}
+
+	key := req.Key
+	if key == "" {
+		generated, err := NewKey()
+		if err != nil {
+			return Identity{}, err
+		}
+
+		key = req.KeyPrefix + generated
+	}
+
+	secret, err := NewSecret(req.secretLength())
+	if err != nil {
+		return Identity{}, err
+	}
+
+	id := Identity{
+		Key:         key,
+		Secret:      secret,
+		Scopes:      append([]string(nil), req.Scopes...),
+		Method:      method,
+		CreatedAt:   issuedAt,
+		Owner:       req.Owner,
+		Description: req.Description,
+	}
+
+	if !req.ExpiresAt.IsZero() {
+		id.ExpiresAt = req.ExpiresAt.UTC()
+	}
+
+	return id, nil
+}
+
+// Rotation returns an update which replaces the secret of an identity with a
+// newly generated secret of a length permitted by the policy. The previous secret
+// is retained until now plus grace when grace is greater than zero.
+func (g *Generator) Rotation(grace time.Duration, now time.Time) (func(*Identity) error, error) {
+	secret, err := NewSecret(g.policy.secretLength())
+	if err != nil {
+		return nil, err
+	}
 
-// Issue takes an key string and returns the associated identity,
-// If the identity is not present the returned boolean WILL BE FALSE.
-// If something else went wrong during the fetch process err WILL NOT BE NIL.
-func (i IssuerFunc) Issue() (Identity, error) {
-	return i()
+	return RotateSecret(secret, grace, now), nil
 }
@@ -0,0 +1,151 @@
+package identity
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/jose.v1/crypto"
+)
+
+func Test_Generator_Issue(t *testing.T) {
+	defer func() { now = time.Now }()
+
+	issuedAt := time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+	now = func() time.Time { return issuedAt }
+
+	id, err := NewGenerator(IssuePolicy{}).Issue(IssueRequest{
+		Scopes:       []string{"resource.action"},
+		Method:       "HS512",
+		KeyPrefix:    "svc-",
+		SecretLength: 48,
+		ExpiresAt:    issuedAt.Add(time.Hour),
+		Owner:        "platform",
+		Description:  "some client",
+	})
+	require.Nil(t, err)
+
+	assert.True(t, strings.HasPrefix(id.Key, "svc-"))
+	assert.Len(t, id.Key, len("svc-")+16)
+	assert.Len(t, id.Secret, 64)
+	assert.Equal(t, []string{"resource.action"}, id.Scopes)
+	assert.Equal(t, crypto.SigningMethodHS512, id.Method)
+	assert.Equal(t, issuedAt, id.CreatedAt)
+	assert.Equal(t, issuedAt.Add(time.Hour), id.ExpiresAt)
+	assert.Equal(t, "platform", id.Owner)
+	assert.Equal(t, "some client", id.Description)
+
+	// defaults
+	id, err = NewGenerator(IssuePolicy{}).Issue(IssueRequest{})
+	require.Nil(t, err)
+	assert.Equal(t, crypto.SigningMethodHS256, id.Method)
+	assert.Len(t, id.Secret, 43)
+	assert.True(t, id.ExpiresAt.IsZero())
+
+	other, err := NewGenerator(IssuePolicy{}).Issue(IssueRequest{})
+	require.Nil(t, err)
+	assert.NotEqual(t, id.Key, other.Key)
+	assert.NotEqual(t, id.Secret, other.Secret)
+}
+
+func Test_Generator_Issue_Policy(t *testing.T) {
+	defer func() { now = time.Now }()
+
+	issuedAt := time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+	now = func() time.Time { return issuedAt }
+
+	generator := NewGenerator(IssuePolicy{
+		Methods:         []string{"HS256", "HS512"},
+		Scopes:          []string{"resource.action", "other.action"},
+		MinSecretLength: 32,
+		MaxSecretLength: 64,
+		MaxLifetime:     24 * time.Hour,
+	})
+
+	valid := IssueRequest{Scopes: []string{"resource.action"}, ExpiresAt: issuedAt.Add(time.Hour)}
+	_, err := generator.Issue(valid)
+	require.Nil(t, err)
+
+	for expected, update := range map[error]func(*IssueRequest){
+		ErrMethodNotAllowed:   func(r *IssueRequest) { r.Method = "HS384" },
+		ErrUnsupportedMethod:  func(r *IssueRequest) { r.Method = "RS256" },
+		ErrScopeNotAllowed:    func(r *IssueRequest) { r.Scopes = append(r.Scopes, "admin") },
+		ErrSecretTooShort:     func(r *IssueRequest) { r.SecretLength = 16 },
+		ErrSecretTooLong:      func(r *IssueRequest) { r.SecretLength = 128 },
+		ErrLifetimeNotAllowed: func(r *IssueRequest) { r.ExpiresAt = issuedAt.Add(48 * time.Hour) },
+	} {
+		req := valid
+		update(&req)
+
+		_, err := generator.Issue(req)
+		assert.Equal(t, expected, errors.Cause(err), expected.Error())
+	}
+
+	// a maximum lifetime requires identities to expire
+	_, err = generator.Issue(IssueRequest{})
+	assert.Equal(t, ErrLifetimeNotAllowed, errors.Cause(err))
+
+	// unsupported methods are rejected regardless of policy
+	_, err = NewGenerator(IssuePolicy{}).Issue(IssueRequest{Method: "none"})
+	assert.Equal(t, ErrUnsupportedMethod, errors.Cause(err))
+
+	// secret lengths are bounded regardless of policy
+	_, err = NewGenerator(IssuePolicy{}).Issue(IssueRequest{SecretLength: DefaultMaxSecretLength + 1})
+	assert.Equal(t, ErrSecretTooLong, errors.Cause(err))
+
+	_, err = NewGenerator(IssuePolicy{}).Issue(IssueRequest{SecretLength: -1})
+	assert.Equal(t, ErrSecretTooShort, errors.Cause(err))
+}
+
+func Test_IssuePolicy_ValidateUpdate(t *testing.T) {
+	policy := IssuePolicy{Methods: []string{"HS256"}, Scopes: []string{"resource.action"}}
+	previous := Identity{Key: "some-key", Scopes: []string{"legacy.action"}, Method: crypto.SigningMethodHS512}
+
+	for name, testCase := range map[string]struct {
+		update func(*Identity) error
+		err    error
+	}{
+		"permitted scope":        {update: AddScopes("resource.action")},
+		"existing scope":         {update: RemoveScopes("resource.action")},
+		"forbidden scope":        {update: AddScopes("other.action"), err: ErrScopeNotAllowed},
+		"existing method":        {update: SetMethod(crypto.SigningMethodHS512)},
+		"permitted method":       {update: SetMethod(crypto.SigningMethodHS256)},
+		"forbidden method":       {update: SetMethod(crypto.SigningMethodHS384), err: ErrMethodNotAllowed},
+		"forbidden scope change": {update: SetScopes("legacy.action", "other.action"), err: ErrScopeNotAllowed},
+	} {
+		updated := previous
+		updated.Scopes = append([]string(nil), previous.Scopes...)
+		require.Nil(t, testCase.update(&updated), name)
+
+		assert.Equal(t, testCase.err, errors.Cause(policy.ValidateUpdate(previous, updated)), name)
+	}
+}
+
+func Test_Generator_Rotation(t *testing.T) {
+	rotatedAt := time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+
+	for name, testCase := range map[string]struct {
+		policy IssuePolicy
+		length int
+	}{
+		"default length":       {length: DefaultSecretLength},
+		"minimum length":       {policy: IssuePolicy{MinSecretLength: 64}, length: 64},
+		"maximum length":       {policy: IssuePolicy{MaxSecretLength: 16}, length: 16},
+		"default within bound": {policy: IssuePolicy{MinSecretLength: 16, MaxSecretLength: 64}, length: DefaultSecretLength},
+	} {
+		rotate, err := NewGenerator(testCase.policy).Rotation(time.Hour, rotatedAt)
+		require.Nil(t, err, name)
+
+		id := Identity{Key: "some-issuer-key", Secret: []byte("old secret")}
+		require.Nil(t, rotate(&id), name)
+
+		secret, err := base64.RawURLEncoding.DecodeString(string(id.Secret))
+		require.Nil(t, err, name)
+		assert.Len(t, secret, testCase.length, name)
+		assert.Equal(t, &RetiredSecret{Secret: []byte("old secret"), ExpiresAt: rotatedAt.Add(time.Hour)}, id.Retired, name)
+	}
+}
@@ -0,0 +1,131 @@
+package identity
+
+import (
+	"encoding/base64"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// validate at compile time that ListerFunc implements Lister.
+var _ Lister = ListerFunc(nil)
+
+// ErrInvalidCursor is returned when a cursor was not produced by a previous page.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Lister is an interface which describes the mechanism required
+// by a storage layer to enumerate its identities.
+// Identities are listed in pages, ordered by key.
+type Lister interface {
+	List(opts ListOptions) (page Page, err error)
+}
+
+// ListerFunc implements the Lister interface.
+// This allows for simple functions to be used as a Lister.
+type ListerFunc func(ListOptions) (Page, error)
+
+// List returns the page of identities described by opts.
+func (l ListerFunc) List(opts ListOptions) (Page, error) {
+	return l(opts)
+}
+
+// ListOptions describes a page of identities to be listed.
+type ListOptions struct {
+	// Cursor is the Next cursor of the previous page, empty for the first page
+	Cursor string
+	// Limit is the maximum number of identities in the page, zero is unlimited
+	Limit int
+	// Scope restricts the page to identities with the scope
+	Scope string
+	// Method restricts the page to identities with the signing method algorithm
+	Method string
+}
+
+// Matches returns true if the identity satisfies the filters of the options.
+func (o ListOptions) Matches(id Identity) bool {
+	if o.Method != "" && (id.Method == nil || id.Method.Alg() != o.Method) {
+		return false
+	}
+
+	if o.Scope == "" {
+		return true
+	}
+
+	for _, scope := range id.Scopes {
+		if scope == o.Scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Page is a page of identities returned by a Lister.
+type Page struct {
+	Identities []Identity
+	// Next is the cursor of the following page, empty on the last page
+	Next string
+}
+
+// NewCursor returns an opaque cursor which resumes listing after the key.
+func NewCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+// ParseCursor returns the key encoded in a cursor produced by NewCursor.
+// The empty cursor returns the empty key.
+func ParseCursor(cursor string) (string, error) {
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", errors.Wrapf(ErrInvalidCursor, "cursor %q", cursor)
+	}
+
+	return string(key), nil
+}
+
+// Paginate returns the page of identities described by opts, from an unordered
+// slice of identities. It can be used by storage layers which hold every identity in memory.
+func Paginate(identities []Identity, opts ListOptions) (Page, error) {
+	after, err := ParseCursor(opts.Cursor)
+	if err != nil {
+		return Page{}, err
+	}
+
+	sorted := make([]Identity, 0, len(identities))
+	for _, id := range identities {
+		if (opts.Cursor == "" || id.Key > after) && opts.Matches(id) {
+			sorted = append(sorted, id)
+		}
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Key < sorted[j].Key
+	})
+
+	if opts.Limit <= 0 || len(sorted) <= opts.Limit {
+		return Page{Identities: sorted}, nil
+	}
+
+	page := sorted[:opts.Limit]
+
+	return Page{Identities: page, Next: NewCursor(page[len(page)-1].Key)}, nil
+}
+
+// ListAll returns every identity matching the filters of opts, by following
+// the cursors of each page returned by the Lister.
+func ListAll(l Lister, opts ListOptions) ([]Identity, error) {
+	var identities []Identity
+	for {
+		page, err := l.List(opts)
+		if err != nil {
+			return nil, err
+		}
+
+		identities = append(identities, page.Identities...)
+		if page.Next == "" {
+			return identities, nil
+		}
+
+		opts.Cursor = page.Next
+	}
+}
@@ -0,0 +1,64 @@
+package identity
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/jose.v1/crypto"
+)
+
+var listed = []Identity{
+	{Key: "c", Method: crypto.SigningMethodHS256, Scopes: []string{"resource.action"}},
+	{Key: "a", Method: crypto.SigningMethodHS256, Scopes: []string{"resource.action", "other.action"}},
+	{Key: "d", Method: crypto.SigningMethodHS512},
+	{Key: "b", Method: crypto.SigningMethodHS512, Scopes: []string{"resource.action"}},
+}
+
+func keys(identities []Identity) (keys []string) {
+	for _, id := range identities {
+		keys = append(keys, id.Key)
+	}
+
+	return
+}
+
+func Test_Paginate(t *testing.T) {
+	for name, testCase := range map[string]struct {
+		opts ListOptions
+		keys []string
+		next string
+	}{
+		"all":             {keys: []string{"a", "b", "c", "d"}},
+		"first page":      {opts: ListOptions{Limit: 3}, keys: []string{"a", "b", "c"}, next: NewCursor("c")},
+		"last page":       {opts: ListOptions{Limit: 3, Cursor: NewCursor("c")}, keys: []string{"d"}},
+		"exact page":      {opts: ListOptions{Limit: 4}, keys: []string{"a", "b", "c", "d"}},
+		"by scope":        {opts: ListOptions{Scope: "resource.action"}, keys: []string{"a", "b", "c"}},
+		"by method":       {opts: ListOptions{Method: "HS512"}, keys: []string{"b", "d"}},
+		"scope and paged": {opts: ListOptions{Scope: "resource.action", Method: "HS256", Limit: 1}, keys: []string{"a"}, next: NewCursor("a")},
+		"none":            {opts: ListOptions{Scope: "unknown.action"}},
+	} {
+		page, err := Paginate(listed, testCase.opts)
+		require.Nil(t, err, name)
+		assert.Equal(t, testCase.keys, keys(page.Identities), name)
+		assert.Equal(t, testCase.next, page.Next, name)
+	}
+
+	_, err := Paginate(listed, ListOptions{Cursor: "not a cursor"})
+	assert.Equal(t, ErrInvalidCursor, errors.Cause(err))
+}
+
+func Test_ListAll(t *testing.T) {
+	var calls int
+	lister := ListerFunc(func(opts ListOptions) (Page, error) {
+		calls++
+		opts.Limit = 1
+		return Paginate(listed, opts)
+	})
+
+	identities, err := ListAll(lister, ListOptions{Scope: "resource.action"})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, keys(identities))
+	assert.Equal(t, 3, calls)
+}
@@ -0,0 +1,141 @@
+package identity
+
+import (
+	"encoding/json"
+
+	"github.com/georgemac/hola/lib/secrets"
+	"github.com/pkg/errors"
+)
+
+// Portable is an Identity exchanged with another process, such as within a
+// transfer archive or a response from a remote identity server. It marshals as
+// an Identity, but as portable identities are untrusted their secrets are decoded
+// with secrets.Decode, so references to the environment or files are rejected
+// rather than resolved. Encrypted secrets are rejected with ErrMalformedIdentity,
+// use Sealed to receive identities which may be encrypted.
+type Portable Identity
+
+// MarshalYAML produces the format of Identity.MarshalYAML.
+func (p Portable) MarshalYAML() (interface{}, error) {
+	return newRecord(Identity(p)), nil
+}
+
+// UnmarshalYAML parses the format of Identity.UnmarshalYAML, decoding secrets with secrets.Decode.
+func (p *Portable) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var r record
+	if err := unmarshal(&r); err != nil {
+		return err
+	}
+
+	return r.decode((*Identity)(p), rejectEncrypted(secrets.Decode))
+}
+
+// MarshalJSON produces the format of Identity.MarshalJSON.
+func (p Portable) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newRecord(Identity(p)))
+}
+
+// UnmarshalJSON parses the format of Identity.UnmarshalJSON, decoding secrets with secrets.Decode.
+func (p *Portable) UnmarshalJSON(data []byte) error {
+	var r record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return err
+	}
+
+	return r.decode((*Identity)(p), rejectEncrypted(secrets.Decode))
+}
+
+// Sealed is a Portable identity whose secrets may be encrypted, such as within an
+// encrypted transfer archive. Encrypted secrets are kept in their encrypted form
+// until the identity is opened with Open.
+type Sealed Identity
+
+// MarshalYAML produces the format of Identity.MarshalYAML.
+func (s Sealed) MarshalYAML() (interface{}, error) {
+	return newRecord(Identity(s)), nil
+}
+
+// UnmarshalYAML parses the format of Portable.UnmarshalYAML, keeping encrypted secrets.
+func (s *Sealed) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var r record
+	if err := unmarshal(&r); err != nil {
+		return err
+	}
+
+	return r.decode((*Identity)(s), secrets.Decode)
+}
+
+// MarshalJSON produces the format of Identity.MarshalJSON.
+func (s Sealed) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newRecord(Identity(s)))
+}
+
+// UnmarshalJSON parses the format of Portable.UnmarshalJSON, keeping encrypted secrets.
+func (s *Sealed) UnmarshalJSON(data []byte) error {
+	var r record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return err
+	}
+
+	return r.decode((*Identity)(s), secrets.Decode)
+}
+
+// Open returns the identity with its encrypted secrets decrypted using keys.
+// When keys is nil, identities with encrypted secrets are rejected with ErrMalformedIdentity.
+func (s Sealed) Open(keys secrets.KeyProvider) (Identity, error) {
+	id := Identity(s)
+
+	secret, err := open(id.Secret, keys)
+	if err != nil {
+		return Identity{}, errors.Wrapf(err, "identity %q", id.Key)
+	}
+
+	id.Secret = secret
+
+	if id.Retired != nil {
+		secret, err := open(id.Retired.Secret, keys)
+		if err != nil {
+			return Identity{}, errors.Wrapf(err, "identity %q retired secret", id.Key)
+		}
+
+		id.Retired = &RetiredSecret{Secret: secret, ExpiresAt: id.Retired.ExpiresAt}
+	}
+
+	return id, nil
+}
+
+// Seal returns the identity with its secrets encrypted using keys, in the form of
+// a Stored identity which marshals the encrypted secrets in place of the secrets.
+// Sealed identities decoded from it are opened with the same keys.
+func Seal(id Identity, keys secrets.KeyProvider) (Stored, error) {
+	encrypted, err := secrets.Encrypt(keys, id.Secret)
+	if err != nil {
+		return Stored{}, errors.Wrapf(err, "identity %q", id.Key)
+	}
+
+	stored := Stored{Identity: id, EncodedSecret: string(encrypted)}
+
+	if id.Retired != nil {
+		encrypted, err := secrets.Encrypt(keys, id.Retired.Secret)
+		if err != nil {
+			return Stored{}, errors.Wrapf(err, "identity %q retired secret", id.Key)
+		}
+
+		stored.EncodedRetiredSecret = string(encrypted)
+	}
+
+	return stored, nil
+}
+
+// open decrypts the secret when it is encrypted, otherwise it is returned as is
+func open(secret []byte, keys secrets.KeyProvider) ([]byte, error) {
+	if !secrets.IsEncrypted(secret) {
+		return secret, nil
+	}
+
+	if keys == nil {
+		return nil, errors.Wrap(ErrMalformedIdentity, "encrypted secret without a key provider")
+	}
+
+	return secrets.Decrypt(keys, secret)
+}
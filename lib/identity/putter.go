@@ -0,0 +1,22 @@
+package identity
+
+// validate at compile time that PutterFunc implements Putter.
+var _ Putter = PutterFunc(nil)
+
+// Putter is an interface which describes the methods required by a storage
+// mechanism to store an identity as it is, including its key and secret,
+// inserting it or replacing any existing identity with the same key.
+// Unlike an Issuer, a Putter does not apply an issue policy, so it is intended
+// for moving identities between backends rather than creating them.
+type Putter interface {
+	Put(Identity) error
+}
+
+// PutterFunc implements the Putter interface.
+// This allows for simple functions to be used as Putter layers.
+type PutterFunc func(Identity) error
+
+// Put takes an identity and stores it.
+func (p PutterFunc) Put(id Identity) error {
+	return p(id)
+}
@@ -0,0 +1,42 @@
+package identity
+
+import "time"
+
+// validate at compile time that RotatorFunc implements Rotator.
+var _ Rotator = RotatorFunc(nil)
+
+// Rotator is an interface which describes the mechanism required
+// by a storage layer to replace the secret of an identity with a
+// newly generated one. When grace is greater than zero the previous
+// secret is retained as a RetiredSecret, which verifies tokens for
+// the grace period. Otherwise the previous secret is discarded.
+// If the identity is not present the returned boolean WILL BE FALSE.
+type Rotator interface {
+	Rotate(key string, grace time.Duration) (identity Identity, ok bool, err error)
+}
+
+// RotatorFunc implements the Rotator interface.
+// This allows for simple functions to be used as a Rotator.
+type RotatorFunc func(string, time.Duration) (Identity, bool, error)
+
+// Rotate replaces the secret of the identity for the key and returns the result.
+func (r RotatorFunc) Rotate(key string, grace time.Duration) (Identity, bool, error) {
+	return r(key, grace)
+}
+
+// RotateSecret returns an update which replaces the secret of an identity,
+// retaining the previous secret until now plus grace when grace is greater than zero.
+func RotateSecret(secret []byte, grace time.Duration, now time.Time) func(*Identity) error {
+	return func(id *Identity) error {
+		id.Retired = nil
+		if grace > 0 {
+			id.Retired = &RetiredSecret{
+				Secret:    id.Secret,
+				ExpiresAt: now.Add(grace).UTC(),
+			}
+		}
+
+		id.Secret = secret
+		return nil
+	}
+}
@@ -0,0 +1,170 @@
+package identity
+
+import (
+	"encoding/json"
+
+	"github.com/georgemac/hola/lib/secrets"
+	"github.com/pkg/errors"
+)
+
+// Stored is an identity as it is encoded by a storage backend or archive, along with the
+// form each of its secrets is written in, such as the reference it was resolved
+// from or its encrypted form. Stored identities marshal as an Identity, with the
+// encoded secrets written in place of the secrets, and record the encoded secrets
+// when unmarshalled, so that references survive a round trip.
+//
+// The encoded secrets belong to the backend, which is responsible for only
+// writing them while they still encode the secrets of the identity.
+// An empty encoded secret is written with secrets.Encode.
+type Stored struct {
+	Identity
+
+	EncodedSecret        string
+	EncodedRetiredSecret string
+}
+
+// record returns the record for the identity, with the encoded secrets in place of its secrets
+func (s Stored) record() record {
+	r := newRecord(s.Identity)
+	if s.EncodedSecret != "" {
+		r.Secret = s.EncodedSecret
+	}
+
+	if r.Retired != nil && s.EncodedRetiredSecret != "" {
+		r.Retired.Secret = s.EncodedRetiredSecret
+	}
+
+	return r
+}
+
+// decode sets the stored identity from the record, recording secrets which are references
+func (s *Stored) decode(r record) error {
+	*s = Stored{}
+	if err := r.decode(&s.Identity, secrets.Resolve); err != nil {
+		return err
+	}
+
+	if secrets.IsReference(r.Secret) {
+		s.EncodedSecret = r.Secret
+	}
+
+	if r.Retired != nil && secrets.IsReference(r.Retired.Secret) {
+		s.EncodedRetiredSecret = r.Retired.Secret
+	}
+
+	return nil
+}
+
+// MarshalYAML produces the format of Identity.MarshalYAML.
+func (s Stored) MarshalYAML() (interface{}, error) {
+	return s.record(), nil
+}
+
+// UnmarshalYAML parses the format of Identity.UnmarshalYAML.
+func (s *Stored) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var r record
+	if err := unmarshal(&r); err != nil {
+		return err
+	}
+
+	return s.decode(r)
+}
+
+// MarshalJSON produces the format of Identity.MarshalJSON.
+func (s Stored) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.record())
+}
+
+// UnmarshalJSON parses the format of Identity.UnmarshalJSON.
+func (s *Stored) UnmarshalJSON(data []byte) error {
+	var r record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return err
+	}
+
+	return s.decode(r)
+}
+
+// MarshalTOML produces the format of Identity.MarshalTOML.
+func (s Stored) MarshalTOML() ([]byte, error) {
+	return inlineTOML(s.record())
+}
+
+// UnmarshalTOML parses the format of Identity.UnmarshalTOML.
+func (s *Stored) UnmarshalTOML(data interface{}) error {
+	r, err := decodeTOML(data)
+	if err != nil {
+		return err
+	}
+
+	return s.decode(r)
+}
+
+// Entries is a list of stored identities, as it is encoded in a file. When an
+// identity in the list cannot be decoded the error names its position in the
+// list, along with its key, so the entry can be found and corrected.
+type Entries []Stored
+
+// UnmarshalYAML parses a list in the format of Stored.UnmarshalYAML.
+func (e *Entries) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var entries []yamlEntry
+	if err := unmarshal(&entries); err != nil {
+		return err
+	}
+
+	return e.decode(len(entries), func(n int, s *Stored) error {
+		return entries[n](s)
+	})
+}
+
+// UnmarshalJSON parses a list in the format of Stored.UnmarshalJSON.
+func (e *Entries) UnmarshalJSON(data []byte) error {
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+
+	return e.decode(len(entries), func(n int, s *Stored) error {
+		return json.Unmarshal(entries[n], s)
+	})
+}
+
+// UnmarshalTOML parses an array of tables in the format of Stored.UnmarshalTOML.
+func (e *Entries) UnmarshalTOML(data interface{}) error {
+	var entries []interface{}
+	switch data := data.(type) {
+	case []interface{}:
+		entries = data
+	case []map[string]interface{}:
+		for _, table := range data {
+			entries = append(entries, table)
+		}
+	default:
+		return errors.Wrapf(ErrMalformedIdentity, "expected array found %T", data)
+	}
+
+	return e.decode(len(entries), func(n int, s *Stored) error {
+		return s.UnmarshalTOML(entries[n])
+	})
+}
+
+// decode sets the list from n entries decoded by decodeEntry
+func (e *Entries) decode(n int, decodeEntry func(int, *Stored) error) error {
+	entries := make(Entries, n)
+	for i := range entries {
+		if err := decodeEntry(i, &entries[i]); err != nil {
+			return errors.Wrapf(err, "identities[%d]", i)
+		}
+	}
+
+	*e = entries
+	return nil
+}
+
+// yamlEntry defers unmarshalling an entry of a YAML list until it is called
+type yamlEntry func(interface{}) error
+
+func (y *yamlEntry) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*y = unmarshal
+	return nil
+}
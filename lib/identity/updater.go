@@ -0,0 +1,108 @@
+package identity
+
+import (
+	"github.com/pkg/errors"
+	"gopkg.in/jose.v1/crypto"
+)
+
+// validate at compile time that UpdaterFunc implements Updater.
+var _ Updater = UpdaterFunc(nil)
+
+var (
+	// ErrKeyChanged is returned when an update attempts to change the key of an identity.
+	ErrKeyChanged = errors.New("identity key cannot be updated")
+
+	// ErrMethodMissing is returned when an update attempts to remove the signing method of an identity.
+	ErrMethodMissing = errors.New("signing method missing")
+)
+
+// Updater is an interface which describes the mechanism required
+// by a storage layer to change an existing identity.
+// The update function is applied to the identity for the key and the
+// result is stored in its place. If the identity is not present the
+// returned boolean WILL BE FALSE and the update is not applied.
+// Updates for common changes are constructed with SetScopes, AddScopes,
+// RemoveScopes and SetMethod, and combined with Updates.
+type Updater interface {
+	Update(key string, update func(*Identity) error) (identity Identity, ok bool, err error)
+}
+
+// UpdaterFunc implements the Updater interface.
+// This allows for simple functions to be used as an Updater.
+type UpdaterFunc func(string, func(*Identity) error) (Identity, bool, error)
+
+// Update applies update to the identity for the key and returns the result.
+func (u UpdaterFunc) Update(key string, update func(*Identity) error) (Identity, bool, error) {
+	return u(key, update)
+}
+
+// SetScopes returns an update which replaces the scopes of an identity.
+func SetScopes(scopes ...string) func(*Identity) error {
+	return func(id *Identity) error {
+		id.Scopes = append([]string(nil), scopes...)
+		return nil
+	}
+}
+
+// AddScopes returns an update which adds any of the scopes an identity does not already have.
+func AddScopes(scopes ...string) func(*Identity) error {
+	return func(id *Identity) error {
+		for _, scope := range scopes {
+			if !contains(id.Scopes, scope) {
+				id.Scopes = append(id.Scopes, scope)
+			}
+		}
+
+		return nil
+	}
+}
+
+// RemoveScopes returns an update which removes the scopes from an identity.
+func RemoveScopes(scopes ...string) func(*Identity) error {
+	return func(id *Identity) error {
+		remaining := make([]string, 0, len(id.Scopes))
+		for _, scope := range id.Scopes {
+			if !contains(scopes, scope) {
+				remaining = append(remaining, scope)
+			}
+		}
+
+		id.Scopes = remaining
+		return nil
+	}
+}
+
+// SetMethod returns an update which changes the signing method of an identity.
+func SetMethod(method crypto.SigningMethod) func(*Identity) error {
+	return func(id *Identity) error {
+		if method == nil {
+			return ErrMethodMissing
+		}
+
+		id.Method = method
+		return nil
+	}
+}
+
+// Updates returns an update which applies each of the updates in turn.
+func Updates(updates ...func(*Identity) error) func(*Identity) error {
+	return func(id *Identity) error {
+		for _, update := range updates {
+			if err := update(id); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,71 @@
+package identity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/jose.v1/crypto"
+	"gopkg.in/jose.v1/jws"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func Test_Updates(t *testing.T) {
+	id := Identity{Key: "some-issuer-key", Scopes: []string{"resource.action"}, Method: crypto.SigningMethodHS256}
+
+	require.Nil(t, Updates(
+		AddScopes("other.action", "resource.action", "third.action"),
+		RemoveScopes("resource.action", "unknown.action"),
+		SetMethod(crypto.SigningMethodHS512),
+	)(&id))
+	assert.Equal(t, []string{"other.action", "third.action"}, id.Scopes)
+	assert.Equal(t, crypto.SigningMethodHS512, id.Method)
+
+	require.Nil(t, SetScopes("resource.action")(&id))
+	assert.Equal(t, []string{"resource.action"}, id.Scopes)
+
+	assert.Equal(t, ErrMethodMissing, SetMethod(nil)(&id))
+}
+
+func Test_RotateSecret(t *testing.T) {
+	defer func() { now = time.Now }()
+
+	rotatedAt := time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+	now = func() time.Time { return rotatedAt }
+
+	id := Identity{Key: "some-issuer-key", Secret: []byte("old secret"), Method: crypto.SigningMethodHS256}
+
+	token := jws.NewJWT(jws.Claims{"iss": "some-issuer-key"}, crypto.SigningMethodHS256)
+	serialized, err := token.Serialize(id.Secret)
+	require.Nil(t, err)
+
+	signed, err := jws.ParseJWT(serialized)
+	require.Nil(t, err)
+
+	// without a grace period the old secret is discarded
+	discarded := id
+	require.Nil(t, RotateSecret([]byte("new secret"), 0, now())(&discarded))
+	assert.Equal(t, []byte("new secret"), discarded.Secret)
+	assert.Nil(t, discarded.Retired)
+	assert.Equal(t, crypto.ErrSignatureInvalid, discarded.Validate(signed))
+
+	// with a grace period the old secret verifies tokens until it expires
+	require.Nil(t, RotateSecret([]byte("new secret"), time.Hour, now())(&id))
+	assert.Equal(t, &RetiredSecret{
+		Secret:    []byte("old secret"),
+		ExpiresAt: rotatedAt.Add(time.Hour),
+	}, id.Retired)
+	assert.Nil(t, id.Validate(signed))
+
+	now = func() time.Time { return rotatedAt.Add(time.Hour) }
+	assert.Equal(t, crypto.ErrSignatureInvalid, id.Validate(signed))
+
+	// retired secrets survive marshalling
+	data, err := yaml.Marshal(id)
+	require.Nil(t, err)
+
+	var unmarshalled Identity
+	require.Nil(t, yaml.Unmarshal(data, &unmarshalled))
+	assert.Equal(t, id.Retired, unmarshalled.Retired)
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/georgemac/hola/lib/auth"
+	"github.com/pkg/errors"
+
+	"gopkg.in/jose.v1/jws"
+)
+
+// ErrScopesMissing is returned when a token does not carry every required scope.
+var ErrScopesMissing = errors.New("required scopes missing from token")
+
+// Headers set on successful forward authentication responses, describing the principal.
+const (
+	HeaderIssuer   = "X-Auth-Issuer"
+	HeaderSubject  = "X-Auth-Subject"
+	HeaderAudience = "X-Auth-Audience"
+	HeaderScopes   = "X-Auth-Scopes"
+	HeaderTokenID  = "X-Auth-Token-Id"
+)
+
+// ForwardAuth is an implementation of net/http.Handler, which performs token validation
+// on behalf of a reverse proxy (forward authentication or ext_authz style).
+// The proxy forwards the original request headers and ForwardAuth responds with
+// 200 and a set of principal headers when the token is valid. Otherwise it responds
+// with 401, or 403 when the token is valid but lacks the required scopes.
+// Additional required scopes can be provided per request with the scope query parameter.
+type ForwardAuth struct {
+	auth   *auth.Authenticator
+	scopes []string
+}
+
+// NewForwardAuth returns a pointer to a ForwardAuth handler using the provided Authenticator,
+// which requires each of the provided scopes to be present on every token.
+func NewForwardAuth(auth *auth.Authenticator, requiredScopes ...string) *ForwardAuth {
+	return &ForwardAuth{auth: auth, scopes: requiredScopes}
+}
+
+// ServeHTTP performs token validation and responds with the principal headers
+// or an appropriate error status.
+func (f *ForwardAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, err := jws.ParseJWTFromRequest(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	scopes, err := f.auth.Validate(token)
+	if err != nil {
+		code := statusCode(err)
+		switch {
+		case errors.Cause(err) == auth.ErrScopesUnauthorized:
+			code = http.StatusForbidden
+		case code == http.StatusBadRequest || code == http.StatusUnauthorized:
+			code = http.StatusUnauthorized
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		}
+
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	required := append(append([]string(nil), f.scopes...), r.URL.Query()["scope"]...)
+	if missing := missingScopes(scopes, required); len(missing) > 0 {
+		err := errors.Wrapf(ErrScopesMissing, "authorization: missing %v", missing)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	claims := token.Claims()
+	if iss, ok := claims.Issuer(); ok {
+		w.Header().Set(HeaderIssuer, iss)
+	}
+
+	if sub, ok := claims.Subject(); ok {
+		w.Header().Set(HeaderSubject, sub)
+	}
+
+	if aud, ok := claims.Audience(); ok {
+		w.Header().Set(HeaderAudience, strings.Join(aud, ","))
+	}
+
+	if jti, ok := claims.JWTID(); ok {
+		w.Header().Set(HeaderTokenID, jti)
+	}
+
+	w.Header().Set(HeaderScopes, strings.Join(scopes, ","))
+	w.WriteHeader(http.StatusOK)
+}
+
+// missingScopes returns the scopes in required which are not present in scopes
+func missingScopes(scopes, required []string) (missing []string) {
+	present := map[string]struct{}{}
+	for _, scope := range scopes {
+		present[scope] = struct{}{}
+	}
+
+	for _, scope := range required {
+		if _, ok := present[scope]; !ok {
+			missing = append(missing, scope)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/jose.v1/crypto"
+
+	"github.com/georgemac/hola/lib/auth"
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/georgemac/legs"
+	"github.com/stretchr/testify/assert"
+)
+
+var forwardAuthStorage = identity.FetcherFunc(func(iss string) (identity.Identity, bool, error) {
+	if iss != "some-issuer-key" {
+		return identity.Identity{}, false, nil
+	}
+
+	return identity.Identity{
+		Secret: []byte("this is super secret"),
+		Method: crypto.SigningMethodHS256,
+		Scopes: []string{"resource.action", "other.action"},
+	}, true, nil
+})
+
+func TestForwardAuth(t *testing.T) {
+	legs.Table{
+		forwardAuthTestCase{
+			name:    "missing JWT token",
+			request: request(),
+			code:    http.StatusUnauthorized,
+			body:    "no token present in request\n",
+		},
+		forwardAuthTestCase{
+			name:    "unknown issuer",
+			request: tokenRequest("test.audience.com", "unknown-issuer-key"),
+			code:    http.StatusUnauthorized,
+			body:    "authentication: identity cannot be located for ISS claim\n",
+		},
+		forwardAuthTestCase{
+			name:    "unauthorized scopes",
+			request: tokenRequest("test.audience.com", "some-issuer-key", "admin"),
+			code:    http.StatusForbidden,
+			body:    "authentication: found [admin]: scopes not authorized for ISS\n",
+		},
+		forwardAuthTestCase{
+			name:     "missing required scopes",
+			request:  tokenRequest("test.audience.com", "some-issuer-key", "resource.action"),
+			required: []string{"resource.action", "other.action"},
+			code:     http.StatusForbidden,
+			body:     "authorization: missing [other.action]: required scopes missing from token\n",
+		},
+		forwardAuthTestCase{
+			name:    "missing required scopes from query",
+			request: scopeQuery(tokenRequest("test.audience.com", "some-issuer-key", "resource.action"), "other.action"),
+			code:    http.StatusForbidden,
+			body:    "authorization: missing [other.action]: required scopes missing from token\n",
+		},
+		forwardAuthTestCase{
+			name:     "valid token",
+			request:  scopeQuery(tokenRequest("test.audience.com", "some-issuer-key", "resource.action", "other.action"), "other.action"),
+			required: []string{"resource.action"},
+			code:     http.StatusOK,
+			headers: map[string]string{
+				HeaderIssuer:   "some-issuer-key",
+				HeaderAudience: "test.audience.com",
+				HeaderScopes:   "resource.action,other.action",
+			},
+		},
+	}.Run(t)
+}
+
+type forwardAuthTestCase struct {
+	// name
+	name string
+	// inputs
+	request  *http.Request
+	required []string
+	// outputs
+	code    int
+	body    string
+	headers map[string]string
+}
+
+func (f forwardAuthTestCase) Name() string { return f.name }
+
+func (f forwardAuthTestCase) Run(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder := httptest.NewRecorder()
+
+	handler := NewForwardAuth(auth.New(forwardAuthStorage), f.required...)
+	handler.ServeHTTP(recorder, f.request)
+
+	assert.Equal(f.code, recorder.Code)
+	assert.Equal(f.body, recorder.Body.String())
+
+	for key, value := range f.headers {
+		assert.Equal(value, recorder.Header().Get(key), key)
+	}
+}
+
+func scopeQuery(r *http.Request, scopes ...string) *http.Request {
+	query := r.URL.Query()
+	for _, scope := range scopes {
+		query.Add("scope", scope)
+	}
+
+	r.URL.RawQuery = query.Encode()
+	return r
+}
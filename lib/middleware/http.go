@@ -6,7 +6,6 @@ import (
 	"github.com/georgemac/hola/lib/auth"
 	"github.com/pkg/errors"
 
-	"gopkg.in/jose.v1/crypto"
 	"gopkg.in/jose.v1/jws"
 )
 
@@ -37,20 +36,7 @@ func (h *HTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if scopes, err := h.auth.Validate(token); err != nil {
-		code := http.StatusInternalServerError
-		switch errors.Cause(err) {
-		case auth.ErrISSClaimMissing,
-			auth.ErrScopesInvalid:
-			// badly formatted requests
-			code = http.StatusBadRequest
-		case auth.ErrCannotFindIdentity,
-			auth.ErrScopesUnauthorized,
-			crypto.ErrSignatureInvalid:
-			// unuathorized requests
-			code = http.StatusUnauthorized
-		}
-
-		http.Error(w, err.Error(), code)
+		http.Error(w, err.Error(), statusCode(err))
 		return
 	} else if len(scopes) > 0 {
 		// scopes added to requests context
@@ -60,3 +46,19 @@ func (h *HTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// call embedded handler
 	h.Handler.ServeHTTP(w, r)
 }
+
+// statusCode returns the http status code appropriate for an error
+// returned by an auth.Authenticator.
+func statusCode(err error) int {
+	switch cause := errors.Cause(err); {
+	case cause == auth.ErrISSClaimMissing,
+		cause == auth.ErrScopesInvalid:
+		// badly formatted requests
+		return http.StatusBadRequest
+	case auth.IsRejection(err):
+		// unuathorized requests
+		return http.StatusUnauthorized
+	}
+
+	return http.StatusInternalServerError
+}
@@ -9,6 +9,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"gopkg.in/jose.v1/crypto"
 	"gopkg.in/jose.v1/jws"
@@ -111,6 +112,19 @@ func TestHTTP(t *testing.T) {
 			}),
 			body: "authentication: found [resource.action]: scopes not authorized for ISS\n",
 		},
+		httpTestCase{
+			name:    "valid signature with scopes outside of identity scopes",
+			request: tokenRequest("test.audience.com", "some-issuer-key", "admin", "resource.action"),
+			code:    http.StatusUnauthorized,
+			storage: identity.FetcherFunc(func(iss string) (identity.Identity, bool, error) {
+				return identity.Identity{
+					Secret: []byte("this is super secret"),
+					Method: crypto.SigningMethodHS256,
+					Scopes: []string{"resource.action", "other.action"},
+				}, true, nil
+			}),
+			body: "authentication: found [admin]: scopes not authorized for ISS\n",
+		},
 		httpTestCase{
 			name:    "valid signature with unexpected scope types",
 			request: tokenRequest("test.audience.com", "some-issuer-key", 5),
@@ -140,6 +154,111 @@ func TestHTTP(t *testing.T) {
 			body:   "called\n",
 			scopes: []string{"resource.action"},
 		},
+		httpTestCase{
+			name:    "issuer not in allowed issuers",
+			request: tokenRequest("test.audience.com", "some-issuer-key"),
+			code:    http.StatusUnauthorized,
+			options: []auth.Option{auth.WithIssuers("other-issuer-key")},
+			storage: identity.FetcherFunc(func(iss string) (identity.Identity, bool, error) {
+				t.Error("storage should not be called for disallowed issuers")
+				return identity.Identity{}, false, nil
+			}),
+			body: "authentication: found \"some-issuer-key\": issuer not allowed\n",
+		},
+		httpTestCase{
+			name:    "audience not in allowed audiences",
+			request: tokenRequest("test.audience.com", "some-issuer-key"),
+			code:    http.StatusUnauthorized,
+			options: []auth.Option{auth.WithAudiences("one.audience.com", "two.audience.com")},
+			storage: identity.FetcherFunc(func(iss string) (identity.Identity, bool, error) {
+				return identity.Identity{
+					Secret: []byte("this is super secret"),
+					Method: crypto.SigningMethodHS256,
+				}, true, nil
+			}),
+			body: "authentication: found [test.audience.com]: audience not allowed\n",
+		},
+		httpTestCase{
+			name:    "allowed issuer and audience",
+			request: tokenRequest("two.audience.com", "some-issuer-key"),
+			code:    http.StatusOK,
+			options: []auth.Option{
+				auth.WithIssuers("some-issuer-key"),
+				auth.WithAudiences("one.audience.com", "two.audience.com"),
+			},
+			storage: identity.FetcherFunc(func(iss string) (identity.Identity, bool, error) {
+				return identity.Identity{
+					Secret: []byte("this is super secret"),
+					Method: crypto.SigningMethodHS256,
+				}, true, nil
+			}),
+			body: "called\n",
+		},
+		httpTestCase{
+			name:    "token outside of identity policy",
+			request: tokenRequest("test.audience.com", "some-issuer-key"),
+			code:    http.StatusUnauthorized,
+			storage: identity.FetcherFunc(func(iss string) (identity.Identity, bool, error) {
+				return identity.Identity{
+					Secret: []byte("this is super secret"),
+					Method: crypto.SigningMethodHS256,
+					Policy: identity.Policy{MaxLifetime: time.Hour},
+				}, true, nil
+			}),
+			body: "authentication: claim \"iat\": required claim missing from JWT claims\n",
+		},
+		httpTestCase{
+			name:    "identity is disabled",
+			request: tokenRequest("test.audience.com", "some-issuer-key"),
+			code:    http.StatusUnauthorized,
+			storage: identity.FetcherFunc(func(iss string) (identity.Identity, bool, error) {
+				return identity.Identity{
+					Secret:   []byte("this is super secret"),
+					Method:   crypto.SigningMethodHS256,
+					Disabled: true,
+				}, true, nil
+			}),
+			body: "authentication: identity is disabled\n",
+		},
+		httpTestCase{
+			name:    "identity has expired",
+			request: tokenRequest("test.audience.com", "some-issuer-key"),
+			code:    http.StatusUnauthorized,
+			storage: identity.FetcherFunc(func(iss string) (identity.Identity, bool, error) {
+				return identity.Identity{
+					Secret:    []byte("this is super secret"),
+					Method:    crypto.SigningMethodHS256,
+					ExpiresAt: time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC),
+				}, true, nil
+			}),
+			body: "authentication: identity has expired\n",
+		},
+		httpTestCase{
+			name:    "identity is disabled and signature is invalid",
+			request: tokenRequest("test.audience.com", "some-issuer-key"),
+			code:    http.StatusUnauthorized,
+			storage: identity.FetcherFunc(func(iss string) (identity.Identity, bool, error) {
+				return identity.Identity{
+					Secret:   []byte("some invalid secret"),
+					Method:   crypto.SigningMethodHS256,
+					Disabled: true,
+				}, true, nil
+			}),
+			body: "authentication: token is invalid: signature is invalid\n",
+		},
+		httpTestCase{
+			name:    "identity has expired and signature is invalid",
+			request: tokenRequest("test.audience.com", "some-issuer-key"),
+			code:    http.StatusUnauthorized,
+			storage: identity.FetcherFunc(func(iss string) (identity.Identity, bool, error) {
+				return identity.Identity{
+					Secret:    []byte("some invalid secret"),
+					Method:    crypto.SigningMethodHS256,
+					ExpiresAt: time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC),
+				}, true, nil
+			}),
+			body: "authentication: token is invalid: signature is invalid\n",
+		},
 	}.Run(t)
 }
 
@@ -154,6 +273,7 @@ type httpTestCase struct {
 	scopes []string
 	// state
 	storage identity.Fetcher
+	options []auth.Option
 }
 
 func (h httpTestCase) Name() string { return h.name }
@@ -168,7 +288,7 @@ func (h httpTestCase) Run(t *testing.T) {
 	wrapped := &contextRecorder{}
 
 	// construct a new handler to test
-	handler := New(wrapped, auth.New(h.storage))
+	handler := New(wrapped, auth.New(h.storage, h.options...))
 
 	// run request handler
 	handler.ServeHTTP(recorder, h.request)
@@ -189,8 +309,8 @@ func (h httpTestCase) Run(t *testing.T) {
 
 func invalidScopeTokenRequest(aud, iss string) *http.Request {
 	token := jws.NewJWT(jws.Claims{
-		"aud": aud,
-		"iss": iss,
+		"aud":                  aud,
+		"iss":                  iss,
 		string(auth.ScopesKey): 12345,
 	}, method)
 
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/georgemac/hola/lib/auth"
+	"github.com/pkg/errors"
+)
+
+// ErrorWriter renders an error, along with the status code appropriate for it,
+// in response to a request.
+type ErrorWriter func(w http.ResponseWriter, err error, code int)
+
+// ScopeOption configures a handler returned by RequireScope.
+type ScopeOption func(*scoped)
+
+// WithErrorWriter sets the ErrorWriter used to reject requests.
+// By default errors are rendered as plain text with http.Error.
+func WithErrorWriter(writer ErrorWriter) ScopeOption {
+	return func(s *scoped) {
+		s.writeError = writer
+	}
+}
+
+// scoped only calls the embedded handler for requests with the scope in their context
+type scoped struct {
+	http.Handler
+	scope      string
+	writeError ErrorWriter
+}
+
+// RequireScope returns a net/http.Handler which only calls the provided handler for
+// requests with scope in their context, as added by HTTP. It is intended to be wrapped
+// by HTTP. Other requests are rejected with ErrScopesMissing and a 403.
+func RequireScope(scope string, handler http.Handler, opts ...ScopeOption) http.Handler {
+	s := &scoped{
+		Handler: handler,
+		scope:   scope,
+		writeError: func(w http.ResponseWriter, err error, code int) {
+			http.Error(w, err.Error(), code)
+		},
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// ServeHTTP calls the embedded handler if the request has the scope in its context.
+func (s *scoped) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	scopes, _, err := auth.ScopesFromContext(r.Context())
+	if err != nil {
+		s.writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	for _, scope := range scopes {
+		if scope == s.scope {
+			s.Handler.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	s.writeError(w, errors.Wrapf(ErrScopesMissing, "scope %q", s.scope), http.StatusForbidden)
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/georgemac/hola/lib/auth"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireScope(t *testing.T) {
+	called := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "called")
+	})
+
+	for _, testCase := range []struct {
+		name    string
+		context context.Context
+		options []ScopeOption
+		code    int
+		body    string
+	}{
+		{
+			name:    "no scopes",
+			context: context.Background(),
+			code:    http.StatusForbidden,
+			body:    "scope \"hola.admin\": required scopes missing from token\n",
+		},
+		{
+			name:    "other scopes",
+			context: auth.WithScopes(context.Background(), []string{"resource.action"}),
+			code:    http.StatusForbidden,
+			body:    "scope \"hola.admin\": required scopes missing from token\n",
+		},
+		{
+			name:    "scopes in unexpected format",
+			context: context.WithValue(context.Background(), auth.ScopesKey, 12345),
+			code:    http.StatusInternalServerError,
+			body:    "unexpected type \"12345\": invalid type for scopes within context\n",
+		},
+		{
+			name:    "required scope",
+			context: auth.WithScopes(context.Background(), []string{"resource.action", "hola.admin"}),
+			code:    http.StatusOK,
+			body:    "called\n",
+		},
+		{
+			name:    "error writer",
+			context: context.Background(),
+			options: []ScopeOption{WithErrorWriter(func(w http.ResponseWriter, err error, code int) {
+				assert.Equal(t, ErrScopesMissing, errors.Cause(err))
+				w.WriteHeader(http.StatusTeapot)
+			})},
+			code: http.StatusTeapot,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil).WithContext(testCase.context)
+			w := httptest.NewRecorder()
+
+			RequireScope("hola.admin", called, testCase.options...).ServeHTTP(w, r)
+
+			assert.Equal(t, testCase.code, w.Code)
+			assert.Equal(t, testCase.body, w.Body.String())
+		})
+	}
+}
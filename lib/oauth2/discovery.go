@@ -0,0 +1,204 @@
+package oauth2
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/georgemac/hola/lib/auth"
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/pkg/errors"
+)
+
+// DiscoveryPath is the path at which the discovery document is served,
+// relative to the issuer URL.
+const DiscoveryPath = "/.well-known/openid-configuration"
+
+// ErrInvalidMetadata is returned when a discovery document cannot be used.
+var ErrInvalidMetadata = errors.New("invalid provider metadata")
+
+// Metadata is the OpenID Connect discovery document, as defined in
+// OpenID Connect Discovery 1.0 section 3 and RFC 8414.
+type Metadata struct {
+	Issuer                                    string   `json:"issuer"`
+	JWKSURI                                   string   `json:"jwks_uri"`
+	TokenEndpoint                             string   `json:"token_endpoint"`
+	IntrospectionEndpoint                     string   `json:"introspection_endpoint,omitempty"`
+	RevocationEndpoint                        string   `json:"revocation_endpoint,omitempty"`
+	ScopesSupported                           []string `json:"scopes_supported,omitempty"`
+	ResponseTypesSupported                    []string `json:"response_types_supported"`
+	GrantTypesSupported                       []string `json:"grant_types_supported"`
+	SubjectTypesSupported                     []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported          []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported         []string `json:"token_endpoint_auth_methods_supported"`
+	IntrospectionEndpointAuthMethodsSupported []string `json:"introspection_endpoint_auth_methods_supported,omitempty"`
+	RevocationEndpointAuthMethodsSupported    []string `json:"revocation_endpoint_auth_methods_supported,omitempty"`
+}
+
+// DiscoveryOption is a function which manipulates the state of a DiscoveryHandler
+type DiscoveryOption func(*DiscoveryHandler)
+
+// WithEndpoints sets the paths of the token, introspection and revocation endpoints,
+// relative to the base URL, which default to /token, /introspect and /revoke.
+// An empty path omits the endpoint from the document.
+func WithEndpoints(token, introspection, revocation string) DiscoveryOption {
+	return func(h *DiscoveryHandler) {
+		h.metadata.TokenEndpoint = endpoint(h.baseURL, token)
+		h.metadata.IntrospectionEndpoint = endpoint(h.baseURL, introspection)
+		h.metadata.RevocationEndpoint = endpoint(h.baseURL, revocation)
+	}
+}
+
+// DiscoveryHandler is an implementation of net/http.Handler which serves the
+// OpenID Connect discovery document for the endpoints within this package.
+//
+// The document is derived from the signing identity configured on the TokenHandler
+// using WithSigningIdentity: its key is the issuer of every token, its method
+// the only supported signing algorithm and its scopes those which can be granted.
+// Clients only accept a document whose issuer is the URL it was discovered from,
+// so the key of the signing identity must be the issuer URL, such as https://auth.example.com.
+// As identities are signed with symmetric keys, which must never be published,
+// the key set at the jwks_uri is always empty. See KeySetHandler.
+type DiscoveryHandler struct {
+	baseURL  string
+	metadata Metadata
+}
+
+// NewDiscoveryHandler returns a DiscoveryHandler for endpoints served under baseURL,
+// which issue tokens signed by the signing identity.
+func NewDiscoveryHandler(baseURL string, signing identity.Identity, opts ...DiscoveryOption) *DiscoveryHandler {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	h := &DiscoveryHandler{baseURL: baseURL}
+	h.metadata = Metadata{
+		Issuer:                            signing.Key,
+		JWKSURI:                           baseURL + "/.well-known/jwks.json",
+		TokenEndpoint:                     baseURL + "/token",
+		IntrospectionEndpoint:             baseURL + "/introspect",
+		RevocationEndpoint:                baseURL + "/revoke",
+		ScopesSupported:                   append([]string(nil), signing.Scopes...),
+		ResponseTypesSupported:            []string{"token"},
+		GrantTypesSupported:               []string{GrantClientCredentials},
+		SubjectTypesSupported:             []string{"public"},
+		TokenEndpointAuthMethodsSupported: authMethods(),
+		IntrospectionEndpointAuthMethodsSupported: authMethods(),
+		RevocationEndpointAuthMethodsSupported:    authMethods(),
+	}
+
+	sort.Strings(h.metadata.ScopesSupported)
+
+	if signing.Method != nil {
+		h.metadata.IDTokenSigningAlgValuesSupported = []string{signing.Method.Alg()}
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+// Metadata returns the discovery document served by the handler.
+func (h *DiscoveryHandler) Metadata() Metadata {
+	return h.metadata
+}
+
+// ServeHTTP serves the discovery document.
+func (h *DiscoveryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeDocument(w, r, h.metadata)
+}
+
+// KeySetHandler is an implementation of net/http.Handler which serves the JSON
+// Web Key Set at the jwks_uri of the discovery document. Identities sign tokens
+// with shared secrets, so the set is always empty and tokens must be validated
+// using an auth.Authenticator with access to the identity storage.
+var KeySetHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	writeDocument(w, r, struct {
+		Keys []interface{} `json:"keys"`
+	}{Keys: []interface{}{}})
+})
+
+// Discover fetches and validates the discovery document for the issuer at issuerURL.
+// The issuer of the document must be identical to issuerURL, as required by
+// OpenID Connect Discovery 1.0 section 4.3, so that a document cannot claim to
+// be another issuer. When client is nil http.DefaultClient is used.
+func Discover(client *http.Client, issuerURL string) (Metadata, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Get(strings.TrimSuffix(issuerURL, "/") + DiscoveryPath)
+	if err != nil {
+		return Metadata{}, errors.Wrap(err, "fetching provider metadata")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Metadata{}, errors.Wrapf(ErrInvalidMetadata, "unexpected status %d", resp.StatusCode)
+	}
+
+	var metadata Metadata
+	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		return Metadata{}, errors.Wrap(ErrInvalidMetadata, err.Error())
+	}
+
+	if metadata.Issuer == "" {
+		return Metadata{}, errors.Wrap(ErrInvalidMetadata, "issuer missing")
+	}
+
+	if metadata.Issuer != issuerURL {
+		return Metadata{}, errors.Wrapf(ErrInvalidMetadata, "issuer %q does not match %q", metadata.Issuer, issuerURL)
+	}
+
+	if metadata.TokenEndpoint == "" {
+		return Metadata{}, errors.Wrap(ErrInvalidMetadata, "token_endpoint missing")
+	}
+
+	return metadata, nil
+}
+
+// NewAuthenticator discovers the issuer at issuerURL and returns an Authenticator,
+// backed by the provided fetcher, which only accepts tokens from the discovered issuer.
+// Any provided options are applied to the Authenticator after the issuer restriction.
+func NewAuthenticator(client *http.Client, issuerURL string, fetcher identity.Fetcher, opts ...auth.Option) (*auth.Authenticator, Metadata, error) {
+	metadata, err := Discover(client, issuerURL)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	opts = append([]auth.Option{auth.WithIssuers(metadata.Issuer)}, opts...)
+
+	return auth.New(fetcher, opts...), metadata, nil
+}
+
+// writeDocument writes a publicly cacheable JSON document in response to GET and HEAD requests
+func writeDocument(w http.ResponseWriter, r *http.Request, v interface{}) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method == http.MethodGet {
+		json.NewEncoder(w).Encode(v)
+	}
+}
+
+// authMethods returns the client authentication methods supported by authenticateClient
+func authMethods() []string {
+	return []string{"client_secret_basic", "client_secret_post"}
+}
+
+// endpoint returns the URL of path under base, or the empty string for an empty path
+func endpoint(base, path string) string {
+	if path == "" {
+		return ""
+	}
+
+	return base + "/" + strings.TrimPrefix(path, "/")
+}
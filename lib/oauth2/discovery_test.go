@@ -0,0 +1,133 @@
+package oauth2
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/georgemac/hola/lib/auth"
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/jose.v1/crypto"
+	"gopkg.in/jose.v1/jws"
+)
+
+var issuer = identity.Identity{
+	Key:    "hola-issuer",
+	Secret: []byte("this is the issuers secret"),
+	Method: crypto.SigningMethodHS256,
+	Scopes: []string{"resource.action", "other.action"},
+}
+
+func Test_Discovery(t *testing.T) {
+	var (
+		mux    = http.NewServeMux()
+		server = httptest.NewServer(mux)
+	)
+	defer server.Close()
+
+	// the signing identity is keyed by the issuer URL
+	signing := issuer
+	signing.Key = server.URL
+
+	fetcher := identity.FetcherFunc(func(key string) (identity.Identity, bool, error) {
+		if key == signing.Key {
+			return signing, true, nil
+		}
+
+		return storage.Fetch(key)
+	})
+
+	discovery := NewDiscoveryHandler(server.URL+"/", signing, WithEndpoints("/oauth/token", "", "/oauth/revoke"))
+	mux.Handle(DiscoveryPath, discovery)
+	mux.Handle("/.well-known/jwks.json", KeySetHandler)
+	mux.Handle("/oauth/token", NewTokenHandler(storage, WithSigningIdentity(signing)))
+
+	assert.Equal(t, Metadata{
+		Issuer:                            server.URL,
+		JWKSURI:                           server.URL + "/.well-known/jwks.json",
+		TokenEndpoint:                     server.URL + "/oauth/token",
+		RevocationEndpoint:                server.URL + "/oauth/revoke",
+		ScopesSupported:                   []string{"other.action", "resource.action"},
+		ResponseTypesSupported:            []string{"token"},
+		GrantTypesSupported:               []string{"client_credentials"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"HS256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post"},
+		IntrospectionEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post"},
+		RevocationEndpointAuthMethodsSupported:    []string{"client_secret_basic", "client_secret_post"},
+	}, discovery.Metadata())
+
+	authenticator, metadata, err := NewAuthenticator(server.Client(), server.URL, fetcher)
+	require.Nil(t, err)
+	assert.Equal(t, discovery.Metadata(), metadata)
+
+	// the key set never publishes the shared secrets
+	resp, err := server.Client().Get(metadata.JWKSURI)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+
+	var keys map[string][]interface{}
+	require.Nil(t, json.NewDecoder(resp.Body).Decode(&keys))
+	assert.Equal(t, map[string][]interface{}{"keys": {}}, keys)
+
+	// tokens from the discovered token endpoint are accepted
+	req, err := http.NewRequest("POST", metadata.TokenEndpoint, strings.NewReader("grant_type=client_credentials"))
+	require.Nil(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("some-client", "this is super secret")
+
+	resp, err = server.Client().Do(req)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var response TokenResponse
+	require.Nil(t, json.NewDecoder(resp.Body).Decode(&response))
+
+	token, err := jws.ParseJWT([]byte(response.AccessToken))
+	require.Nil(t, err)
+
+	_, err = authenticator.Validate(token)
+	assert.Nil(t, err)
+
+	// tokens self-signed by clients are not from the discovered issuer
+	token, err = jws.ParseJWT([]byte(issue(t)))
+	require.Nil(t, err)
+
+	_, err = authenticator.Validate(token)
+	assert.Equal(t, auth.ErrIssuerNotAllowed, errors.Cause(err))
+}
+
+func Test_Discover_Errors(t *testing.T) {
+	for name, handler := range map[string]http.HandlerFunc{
+		"not found": http.NotFound,
+		"malformed": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("not json"))
+		},
+		"issuer missing": func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(Metadata{TokenEndpoint: "http://localhost/token"})
+		},
+		"issuer mismatch": func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(Metadata{Issuer: "https://other.example.com", TokenEndpoint: "http://localhost/token"})
+		},
+		"token endpoint missing": func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(Metadata{Issuer: "http://" + r.Host})
+		},
+	} {
+		server := httptest.NewServer(handler)
+
+		_, err := Discover(server.Client(), server.URL)
+		assert.Equal(t, ErrInvalidMetadata, errors.Cause(err), name)
+
+		server.Close()
+	}
+
+	recorder := httptest.NewRecorder()
+	NewDiscoveryHandler("http://localhost", issuer).ServeHTTP(recorder, httptest.NewRequest("POST", DiscoveryPath, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
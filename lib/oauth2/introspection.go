@@ -0,0 +1,116 @@
+package oauth2
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/georgemac/hola/lib/auth"
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/pkg/errors"
+	"gopkg.in/jose.v1/jws"
+)
+
+// IntrospectionResponse is the response of the introspection endpoint,
+// as defined in RFC 7662 section 2.2. Only Active is set for inactive tokens.
+type IntrospectionResponse struct {
+	Active    bool        `json:"active"`
+	Scope     string      `json:"scope,omitempty"`
+	ClientID  string      `json:"client_id,omitempty"`
+	TokenType string      `json:"token_type,omitempty"`
+	Exp       int64       `json:"exp,omitempty"`
+	Iat       int64       `json:"iat,omitempty"`
+	Nbf       int64       `json:"nbf,omitempty"`
+	Sub       string      `json:"sub,omitempty"`
+	Aud       interface{} `json:"aud,omitempty"`
+	Iss       string      `json:"iss,omitempty"`
+	Jti       string      `json:"jti,omitempty"`
+}
+
+// IntrospectionHandler is an implementation of net/http.Handler which serves
+// the OAuth2 token introspection endpoint (RFC 7662).
+// Callers authenticate as an identity from the provided fetcher, in the same
+// manner as clients of the TokenHandler. Tokens are active when they pass
+// validation by the provided Authenticator, which includes any revocation list
+// it is configured with.
+type IntrospectionHandler struct {
+	fetcher identity.Fetcher
+	auth    *auth.Authenticator
+}
+
+// NewIntrospectionHandler returns an IntrospectionHandler which authenticates callers using
+// the provided fetcher and validates tokens using the provided Authenticator.
+func NewIntrospectionHandler(fetcher identity.Fetcher, authenticator *auth.Authenticator) *IntrospectionHandler {
+	return &IntrospectionHandler{fetcher: fetcher, auth: authenticator}
+}
+
+// ServeHTTP handles an introspection request.
+func (h *IntrospectionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	response, err := h.introspect(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *IntrospectionHandler) introspect(r *http.Request) (IntrospectionResponse, error) {
+	if err := parseForm(r); err != nil {
+		return IntrospectionResponse{}, err
+	}
+
+	if _, err := authenticateClient(r, h.fetcher); err != nil {
+		return IntrospectionResponse{}, err
+	}
+
+	raw := r.PostForm.Get("token")
+	if raw == "" {
+		return IntrospectionResponse{}, errors.Wrap(ErrInvalidRequest, "token missing")
+	}
+
+	token, err := jws.ParseJWT([]byte(raw))
+	if err != nil {
+		return IntrospectionResponse{Active: false}, nil
+	}
+
+	scopes, err := h.auth.Validate(token)
+	if err != nil {
+		// rejected tokens are inactive, whereas failing to validate is an error
+		if auth.IsRejection(err) {
+			return IntrospectionResponse{Active: false}, nil
+		}
+
+		return IntrospectionResponse{}, err
+	}
+
+	claims := token.Claims()
+	response := IntrospectionResponse{
+		Active:    true,
+		Scope:     strings.Join(scopes, " "),
+		TokenType: "Bearer",
+		Aud:       claims.Get("aud"),
+	}
+
+	response.Iss, _ = claims.Issuer()
+	response.Sub, _ = claims.Subject()
+	response.Jti, _ = claims.JWTID()
+
+	// tokens issued by the TokenHandler carry the client, otherwise it is the issuer
+	if response.ClientID, _ = claims.Get(string(auth.ClientIDKey)).(string); response.ClientID == "" {
+		response.ClientID = response.Iss
+	}
+
+	if exp, ok := claims.Expiration(); ok {
+		response.Exp = exp.Unix()
+	}
+
+	if iat, ok := claims.IssuedAt(); ok {
+		response.Iat = iat.Unix()
+	}
+
+	if nbf, ok := claims.NotBefore(); ok {
+		response.Nbf = nbf.Unix()
+	}
+
+	return response, nil
+}
@@ -0,0 +1,95 @@
+package oauth2
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/georgemac/hola/lib/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// issue returns an access token for some-client with the requested scopes
+func issue(t *testing.T, scopes ...string) string {
+	recorder := httptest.NewRecorder()
+	NewTokenHandler(storage, WithTokenAudience("test.audience.com")).ServeHTTP(recorder, tokenRequest("some-client", "this is super secret", url.Values{
+		"grant_type": {"client_credentials"},
+		"scope":      {strings.Join(scopes, " ")},
+	}))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var response TokenResponse
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&response))
+
+	return response.AccessToken
+}
+
+func introspect(t *testing.T, handler http.Handler, clientID, clientSecret, token string) (int, IntrospectionResponse) {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, tokenRequest(clientID, clientSecret, url.Values{"token": {token}}))
+
+	var response IntrospectionResponse
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&response))
+
+	return recorder.Code, response
+}
+
+func Test_Introspection_Active(t *testing.T) {
+	token := issue(t, "resource.action")
+	handler := NewIntrospectionHandler(storage, auth.New(storage))
+
+	code, response := introspect(t, handler, "some-client", "this is super secret", token)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, response.Active)
+	assert.Equal(t, "resource.action", response.Scope)
+	assert.Equal(t, "some-client", response.ClientID)
+	assert.Equal(t, "some-client", response.Iss)
+	assert.Equal(t, "some-client", response.Sub)
+	assert.Equal(t, "test.audience.com", response.Aud)
+	assert.Equal(t, int64(3600), response.Exp-response.Iat)
+	assert.NotEmpty(t, response.Jti)
+}
+
+func Test_Introspection_Inactive(t *testing.T) {
+	token := issue(t, "resource.action")
+
+	for name, handler := range map[string]http.Handler{
+		"rejected by policy": NewIntrospectionHandler(storage, auth.New(storage, auth.WithAudiences("other.audience.com"))),
+		"revoked": NewIntrospectionHandler(storage, auth.New(storage, auth.WithRevocationList(auth.RevocationListFunc(func(string, string) (bool, error) {
+			return true, nil
+		})))),
+	} {
+		code, response := introspect(t, handler, "some-client", "this is super secret", token)
+		assert.Equal(t, http.StatusOK, code, name)
+		assert.Equal(t, IntrospectionResponse{Active: false}, response, name)
+	}
+
+	handler := NewIntrospectionHandler(storage, auth.New(storage))
+	code, response := introspect(t, handler, "some-client", "this is super secret", "not a token")
+	assert.Equal(t, http.StatusOK, code)
+	assert.False(t, response.Active)
+}
+
+func Test_Introspection_Errors(t *testing.T) {
+	token := issue(t, "resource.action")
+
+	// callers must authenticate
+	recorder := httptest.NewRecorder()
+	NewIntrospectionHandler(storage, auth.New(storage)).ServeHTTP(recorder, tokenRequest("some-client", "not the secret", url.Values{"token": {token}}))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	// failures to validate are not reported as inactive tokens
+	failing := auth.RevocationListFunc(func(string, string) (bool, error) {
+		return false, errors.New("something went wrong in storage")
+	})
+
+	code, response := introspect(t, NewIntrospectionHandler(storage, auth.New(storage, auth.WithRevocationList(failing))),
+		"some-client", "this is super secret", token)
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.False(t, response.Active)
+}
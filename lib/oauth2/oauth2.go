@@ -0,0 +1,120 @@
+// Package oauth2 implements OAuth2 endpoints on top of the hola identity
+// and authentication primitives.
+package oauth2
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/pkg/errors"
+)
+
+// Error codes defined in RFC 6749 section 5.2. Errors returned by the
+// handlers within this package have one of these as their cause.
+var (
+	ErrInvalidRequest       = errors.New("invalid_request")
+	ErrInvalidClient        = errors.New("invalid_client")
+	ErrInvalidGrant         = errors.New("invalid_grant")
+	ErrUnauthorizedClient   = errors.New("unauthorized_client")
+	ErrUnsupportedGrantType = errors.New("unsupported_grant_type")
+	ErrInvalidScope         = errors.New("invalid_scope")
+	ErrServerError          = errors.New("server_error")
+)
+
+var now = time.Now
+
+// errorResponse is the JSON body of an error response.
+type errorResponse struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// writeError renders err as an OAuth2 error response.
+// The error code is derived from the cause of err and the remainder of the
+// message is used as the description.
+func writeError(w http.ResponseWriter, err error) {
+	cause := errors.Cause(err)
+
+	code, status := cause.Error(), http.StatusBadRequest
+	switch cause {
+	case ErrInvalidClient:
+		status = http.StatusUnauthorized
+		w.Header().Set("WWW-Authenticate", `Basic realm="hola"`)
+	case ErrInvalidRequest, ErrInvalidGrant, ErrUnauthorizedClient,
+		ErrUnsupportedGrantType, ErrInvalidScope:
+	default:
+		// internal errors are not described to clients
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Code: ErrServerError.Error()})
+		return
+	}
+
+	description := strings.TrimSuffix(strings.TrimSuffix(err.Error(), code), ": ")
+
+	writeJSON(w, status, errorResponse{Code: code, Description: description})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// parseForm parses the form body of a POST request.
+func parseForm(r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return errors.Wrapf(ErrInvalidRequest, "method %s not allowed", r.Method)
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return errors.Wrap(ErrInvalidRequest, "malformed form body")
+	}
+
+	return nil
+}
+
+// authenticateClient authenticates the client making the request, using
+// HTTP basic authentication or the client_id and client_secret form parameters
+// as described in RFC 6749 section 2.3.1. The client is the identity for client_id.
+func authenticateClient(r *http.Request, fetcher identity.Fetcher) (identity.Identity, error) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		// credentials are form encoded before being placed in the basic auth header
+		var err error
+		if clientID, err = url.QueryUnescape(clientID); err != nil {
+			return identity.Identity{}, errors.Wrap(ErrInvalidRequest, "malformed client_id")
+		}
+
+		if clientSecret, err = url.QueryUnescape(clientSecret); err != nil {
+			return identity.Identity{}, errors.Wrap(ErrInvalidRequest, "malformed client_secret")
+		}
+	} else {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	if clientID == "" || clientSecret == "" {
+		return identity.Identity{}, errors.Wrap(ErrInvalidClient, "client credentials missing")
+	}
+
+	id, ok, err := fetcher.Fetch(clientID)
+	if err != nil {
+		return identity.Identity{}, errors.Wrap(err, "fetching client identity")
+	}
+
+	// the same error is returned for unknown clients and invalid secrets
+	if !ok || subtle.ConstantTimeCompare(id.Secret, []byte(clientSecret)) != 1 {
+		return identity.Identity{}, errors.Wrap(ErrInvalidClient, "client authentication failed")
+	}
+
+	if id.Disabled || id.Expired(now()) {
+		return identity.Identity{}, errors.Wrap(ErrInvalidClient, "client is disabled or expired")
+	}
+
+	return id, nil
+}
@@ -0,0 +1,34 @@
+package oauth2
+
+import (
+	"time"
+
+	"github.com/georgemac/hola/lib/identity"
+)
+
+// TokenOption is a function which manipulates the state of a TokenHandler
+type TokenOption func(*TokenHandler)
+
+// WithTokenLifetime sets the lifetime of issued tokens, which defaults to one hour.
+// Clients with a shorter maximum lifetime in their policy are issued shorter lived tokens.
+func WithTokenLifetime(lifetime time.Duration) TokenOption {
+	return func(h *TokenHandler) {
+		h.lifetime = lifetime
+	}
+}
+
+// WithTokenAudience sets the audience claim of issued tokens
+func WithTokenAudience(aud ...string) TokenOption {
+	return func(h *TokenHandler) {
+		h.audience = aud
+	}
+}
+
+// WithSigningIdentity signs issued tokens with the provided identity, which becomes
+// the issuer of every token, instead of the requesting client.
+// Its scopes must contain every scope it grants for the tokens to be validated.
+func WithSigningIdentity(id identity.Identity) TokenOption {
+	return func(h *TokenHandler) {
+		h.signing = &id
+	}
+}
@@ -0,0 +1,156 @@
+package oauth2
+
+import (
+	"net/http"
+
+	"github.com/georgemac/hola/lib/auth"
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/pkg/errors"
+	"gopkg.in/jose.v1/jws"
+)
+
+// RevocationHandler is an implementation of net/http.Handler which serves the
+// OAuth2 token revocation endpoint (RFC 7009).
+// Callers authenticate as an identity from the provided fetcher and may only revoke
+// tokens issued to them. Revoked tokens are added to the TokenRevoker by their issuer
+// and JTI claim. The TokenRevoker should also be configured as the revocation list
+// of every Authenticator.
+// As per the RFC, invalid tokens and tokens without a JTI claim are ignored.
+type RevocationHandler struct {
+	fetcher identity.Fetcher
+	auth    *auth.Authenticator
+	revoker auth.TokenRevoker
+}
+
+// NewRevocationHandler returns a RevocationHandler which authenticates callers using the
+// provided fetcher, validates tokens using the Authenticator and revokes them using the revoker.
+func NewRevocationHandler(fetcher identity.Fetcher, authenticator *auth.Authenticator, revoker auth.TokenRevoker) *RevocationHandler {
+	return &RevocationHandler{fetcher: fetcher, auth: authenticator, revoker: revoker}
+}
+
+// ServeHTTP handles a revocation request.
+func (h *RevocationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h.revoke(r); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *RevocationHandler) revoke(r *http.Request) error {
+	if err := parseForm(r); err != nil {
+		return err
+	}
+
+	caller, err := authenticateClient(r, h.fetcher)
+	if err != nil {
+		return err
+	}
+
+	raw := r.PostForm.Get("token")
+	if raw == "" {
+		return errors.Wrap(ErrInvalidRequest, "token missing")
+	}
+
+	token, err := jws.ParseJWT([]byte(raw))
+	if err != nil {
+		return nil
+	}
+
+	// the signature must be verified, otherwise any jti could be revoked
+	if _, err := h.auth.Validate(token); err != nil {
+		if auth.IsRejection(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	claims := token.Claims()
+	issuer, _ := claims.Issuer()
+	owner, _ := claims.Get(string(auth.ClientIDKey)).(string)
+	if owner == "" {
+		owner = issuer
+	}
+
+	if owner != caller.Key {
+		return errors.Wrap(ErrUnauthorizedClient, "token was not issued to client")
+	}
+
+	jti, ok := claims.JWTID()
+	if !ok {
+		return nil
+	}
+
+	exp, _ := claims.Expiration()
+
+	return h.revoker.RevokeToken(issuer, jti, exp)
+}
+
+// IssuerRevocationHandler is an implementation of net/http.Handler which revokes
+// an issuer, and with it every token it has issued or been issued as a client,
+// using an identity.Revoker.
+// Callers authenticate as an identity from the provided fetcher, which must
+// have the admin scope. The issuer key is provided in the issuer form parameter.
+type IssuerRevocationHandler struct {
+	fetcher identity.Fetcher
+	revoker identity.Revoker
+	scope   string
+}
+
+// NewIssuerRevocationHandler returns an IssuerRevocationHandler which authenticates callers with
+// the provided fetcher, requiring them to have the scope, and revokes issuers using the revoker.
+func NewIssuerRevocationHandler(fetcher identity.Fetcher, revoker identity.Revoker, scope string) *IssuerRevocationHandler {
+	return &IssuerRevocationHandler{fetcher: fetcher, revoker: revoker, scope: scope}
+}
+
+// ServeHTTP handles an issuer revocation request.
+func (h *IssuerRevocationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h.revoke(r); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *IssuerRevocationHandler) revoke(r *http.Request) error {
+	if err := parseForm(r); err != nil {
+		return err
+	}
+
+	caller, err := authenticateClient(r, h.fetcher)
+	if err != nil {
+		return err
+	}
+
+	if !contains(caller.Scopes, h.scope) {
+		return errors.Wrapf(ErrUnauthorizedClient, "scope %q required", h.scope)
+	}
+
+	issuer := r.PostForm.Get("issuer")
+	if issuer == "" {
+		return errors.Wrap(ErrInvalidRequest, "issuer missing")
+	}
+
+	if _, ok, err := h.fetcher.Fetch(issuer); err != nil {
+		return err
+	} else if !ok {
+		return errors.Wrapf(ErrInvalidRequest, "unknown issuer %q", issuer)
+	}
+
+	return h.revoker.Revoke(issuer)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,111 @@
+package oauth2
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/georgemac/hola/lib/auth"
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/jose.v1/jws"
+)
+
+func Test_Revocation(t *testing.T) {
+	var (
+		token      = issue(t, "resource.action")
+		denylist   = auth.NewDenylist()
+		authorizer = auth.New(storage, auth.WithRevocationList(denylist))
+		handler    = NewRevocationHandler(storage, authorizer, denylist)
+	)
+
+	parsed, err := jws.ParseJWT([]byte(token))
+	require.Nil(t, err)
+
+	_, err = authorizer.Validate(parsed)
+	require.Nil(t, err)
+
+	// tokens can only be revoked by the client they were issued to
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, tokenRequest("short-lived-client", "this is super secret", url.Values{"token": {token}}))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	var response errorResponse
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&response))
+	assert.Equal(t, errorResponse{Code: "unauthorized_client", Description: "token was not issued to client"}, response)
+
+	_, err = authorizer.Validate(parsed)
+	require.Nil(t, err)
+
+	// revoking a token rejects it from then on, and revoking it again succeeds
+	for i := 0; i < 2; i++ {
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, tokenRequest("some-client", "this is super secret", url.Values{"token": {token}}))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	}
+
+	_, err = authorizer.Validate(parsed)
+	assert.Equal(t, auth.ErrTokenRevoked, errors.Cause(err))
+
+	// invalid tokens are ignored
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, tokenRequest("some-client", "this is super secret", url.Values{"token": {"not a token"}}))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	// callers must authenticate
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, tokenRequest("some-client", "not the secret", url.Values{"token": {token}}))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func Test_IssuerRevocation(t *testing.T) {
+	var revoked []string
+	handler := NewIssuerRevocationHandler(storage, identity.RevokerFunc(func(key string) error {
+		revoked = append(revoked, key)
+		return nil
+	}), "other.action")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, tokenRequest("some-client", "this is super secret", url.Values{"issuer": {"short-lived-client"}}))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, []string{"short-lived-client"}, revoked)
+
+	for name, testCase := range map[string]struct {
+		handler  http.Handler
+		form     url.Values
+		code     int
+		response errorResponse
+	}{
+		"admin scope required": {
+			handler:  NewIssuerRevocationHandler(storage, identity.RevokerFunc(func(string) error { return nil }), "admin"),
+			form:     url.Values{"issuer": {"short-lived-client"}},
+			code:     http.StatusBadRequest,
+			response: errorResponse{Code: "unauthorized_client", Description: `scope "admin" required`},
+		},
+		"issuer missing": {
+			handler:  handler,
+			code:     http.StatusBadRequest,
+			response: errorResponse{Code: "invalid_request", Description: "issuer missing"},
+		},
+		"unknown issuer": {
+			handler:  handler,
+			form:     url.Values{"issuer": {"unknown-client"}},
+			code:     http.StatusBadRequest,
+			response: errorResponse{Code: "invalid_request", Description: `unknown issuer "unknown-client"`},
+		},
+	} {
+		recorder := httptest.NewRecorder()
+		testCase.handler.ServeHTTP(recorder, tokenRequest("some-client", "this is super secret", testCase.form))
+		assert.Equal(t, testCase.code, recorder.Code, name)
+
+		var response errorResponse
+		require.Nil(t, json.NewDecoder(recorder.Body).Decode(&response), name)
+		assert.Equal(t, testCase.response, response, name)
+	}
+
+	assert.Equal(t, []string{"short-lived-client"}, revoked)
+}
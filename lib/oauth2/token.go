@@ -0,0 +1,162 @@
+package oauth2
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/georgemac/hola/lib/auth"
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/georgemac/hola/lib/signer"
+	"github.com/pkg/errors"
+)
+
+// GrantClientCredentials is the grant type for the client credentials grant.
+const GrantClientCredentials = "client_credentials"
+
+// TokenResponse is the successful response of the token endpoint,
+// as defined in RFC 6749 section 5.1.
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+}
+
+// TokenHandler is an implementation of net/http.Handler which serves the OAuth2
+// token endpoint for the client credentials grant (RFC 6749 section 4.4).
+// Clients authenticate with their identity key and secret. The requested scopes
+// are intersected with the scopes of the identity and a token is minted using
+// a signer.Signer. When no scopes are requested, every scope of the identity is granted.
+//
+// By default tokens are signed with the clients own secret and method, with the client
+// as the issuer, so that they are validated by an auth.Authenticator using the same storage.
+// The client is the subject of every token and its key is set in the auth.ClientIDKey claim,
+// so tokens signed by another identity are rejected once the client is revoked. Tokens are
+// only issued for the audiences and subjects permitted by the clients policy.
+type TokenHandler struct {
+	fetcher  identity.Fetcher
+	lifetime time.Duration
+	audience []string
+	signing  *identity.Identity
+}
+
+// NewTokenHandler returns a TokenHandler which authenticates clients using the provided fetcher.
+func NewTokenHandler(fetcher identity.Fetcher, opts ...TokenOption) *TokenHandler {
+	h := &TokenHandler{fetcher: fetcher, lifetime: time.Hour}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+// ServeHTTP handles a token request.
+func (h *TokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	response, err := h.token(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *TokenHandler) token(r *http.Request) (TokenResponse, error) {
+	if err := parseForm(r); err != nil {
+		return TokenResponse{}, err
+	}
+
+	client, err := authenticateClient(r, h.fetcher)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	switch grant := r.PostForm.Get("grant_type"); grant {
+	case GrantClientCredentials:
+	case "":
+		return TokenResponse{}, errors.Wrap(ErrInvalidRequest, "grant_type missing")
+	default:
+		return TokenResponse{}, errors.Wrapf(ErrUnsupportedGrantType, "found %q", grant)
+	}
+
+	scopes := client.Scopes
+	if requested := strings.Fields(r.PostForm.Get("scope")); len(requested) > 0 {
+		if scopes = intersect(requested, client.Scopes); len(scopes) == 0 {
+			return TokenResponse{}, errors.Wrapf(ErrInvalidScope, "none of %v granted", requested)
+		}
+	}
+
+	// tokens must not outlive the maximum lifetime of the clients policy
+	lifetime := h.lifetime
+	if max := client.Policy.MaxLifetime; max > 0 && max < lifetime {
+		lifetime = max
+	}
+
+	issuer := client
+	if h.signing != nil {
+		issuer = *h.signing
+	}
+
+	// tokens are only issued for audiences permitted by the clients policy
+	audience := h.audience
+	if allowed := client.Policy.Audiences; len(allowed) > 0 {
+		if len(audience) == 0 {
+			audience = allowed
+		} else if audience = intersect(audience, allowed); len(audience) == 0 {
+			return TokenResponse{}, errors.Wrapf(ErrUnauthorizedClient, "audience %v not permitted", h.audience)
+		}
+	}
+
+	opts := []signer.Option{
+		signer.WithFlatClaims(),
+		signer.WithIssuer(issuer.Key),
+		signer.WithSubject(client.Key),
+		signer.WithExpiration(lifetime),
+	}
+
+	if len(audience) > 0 {
+		opts = append(opts, signer.WithAudience(audience...))
+	}
+
+	if len(scopes) > 0 {
+		opts = append(opts, signer.WithScopes(scopes...))
+	}
+
+	token := signer.New(issuer.Method, opts...).Sign(map[string]interface{}{string(auth.ClientIDKey): client.Key})
+
+	// tokens which would be rejected under the clients policy are not issued
+	if err := auth.IdentityPolicy(client.Policy)(token.Claims()); err != nil {
+		return TokenResponse{}, errors.Wrapf(ErrUnauthorizedClient, "token not permitted by client policy: %s", err.Error())
+	}
+
+	serialized, err := token.Serialize(issuer.Secret)
+	if err != nil {
+		return TokenResponse{}, errors.Wrap(err, "signing token")
+	}
+
+	return TokenResponse{
+		AccessToken: string(serialized),
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(lifetime / time.Second),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+// intersect returns the values in a which are also present in b, in the order of a
+func intersect(a, b []string) (values []string) {
+	present := map[string]struct{}{}
+	for _, v := range b {
+		present[v] = struct{}{}
+	}
+
+	for _, v := range a {
+		if _, ok := present[v]; ok {
+			values = append(values, v)
+			delete(present, v)
+		}
+	}
+
+	return
+}
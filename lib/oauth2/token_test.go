@@ -0,0 +1,284 @@
+package oauth2
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/georgemac/hola/lib/auth"
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/georgemac/hola/lib/storage/memory"
+	"github.com/georgemac/legs"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/jose.v1/crypto"
+	"gopkg.in/jose.v1/jws"
+)
+
+var (
+	client = identity.Identity{
+		Key:    "some-client",
+		Secret: []byte("this is super secret"),
+		Method: crypto.SigningMethodHS256,
+		Scopes: []string{"resource.action", "other.action"},
+	}
+
+	storage = identity.FetcherFunc(func(key string) (identity.Identity, bool, error) {
+		switch key {
+		case client.Key:
+			return client, true, nil
+		case "short-lived-client":
+			short := client
+			short.Key = key
+			short.Policy.MaxLifetime = time.Minute
+			return short, true, nil
+		case "disabled-client":
+			disabled := client
+			disabled.Key = key
+			disabled.Disabled = true
+			return disabled, true, nil
+		case "audience-client":
+			audience := client
+			audience.Key = key
+			audience.Policy.Audiences = []string{"test.audience.com"}
+			return audience, true, nil
+		case "subject-client":
+			subject := client
+			subject.Key = key
+			subject.Policy.Subjects = []string{"another-client"}
+			return subject, true, nil
+		}
+
+		return identity.Identity{}, false, nil
+	})
+)
+
+func TestTokenHandler(t *testing.T) {
+	legs.Table{
+		tokenTestCase{
+			name:    "method not allowed",
+			request: httptest.NewRequest("GET", "/token", nil),
+			code:    http.StatusBadRequest,
+			err:     errorResponse{Code: "invalid_request", Description: "method GET not allowed"},
+		},
+		tokenTestCase{
+			name:    "missing client credentials",
+			request: tokenRequest("", "", url.Values{"grant_type": {"client_credentials"}}),
+			code:    http.StatusUnauthorized,
+			err:     errorResponse{Code: "invalid_client", Description: "client credentials missing"},
+		},
+		tokenTestCase{
+			name:    "invalid client secret",
+			request: tokenRequest("some-client", "not the secret", url.Values{"grant_type": {"client_credentials"}}),
+			code:    http.StatusUnauthorized,
+			err:     errorResponse{Code: "invalid_client", Description: "client authentication failed"},
+		},
+		tokenTestCase{
+			name:    "unknown client",
+			request: tokenRequest("unknown-client", "this is super secret", url.Values{"grant_type": {"client_credentials"}}),
+			code:    http.StatusUnauthorized,
+			err:     errorResponse{Code: "invalid_client", Description: "client authentication failed"},
+		},
+		tokenTestCase{
+			name:    "disabled client",
+			request: tokenRequest("disabled-client", "this is super secret", url.Values{"grant_type": {"client_credentials"}}),
+			code:    http.StatusUnauthorized,
+			err:     errorResponse{Code: "invalid_client", Description: "client is disabled or expired"},
+		},
+		tokenTestCase{
+			name:    "unsupported grant type",
+			request: tokenRequest("some-client", "this is super secret", url.Values{"grant_type": {"password"}}),
+			code:    http.StatusBadRequest,
+			err:     errorResponse{Code: "unsupported_grant_type", Description: `found "password"`},
+		},
+		tokenTestCase{
+			name:    "no granted scopes",
+			request: tokenRequest("some-client", "this is super secret", url.Values{"grant_type": {"client_credentials"}, "scope": {"admin"}}),
+			code:    http.StatusBadRequest,
+			err:     errorResponse{Code: "invalid_scope", Description: "none of [admin] granted"},
+		},
+		tokenTestCase{
+			name:    "all scopes by default",
+			request: tokenRequest("some-client", "this is super secret", url.Values{"grant_type": {"client_credentials"}}),
+			code:    http.StatusOK,
+			scopes:  []string{"resource.action", "other.action"},
+			expires: 3600,
+		},
+		tokenTestCase{
+			name: "requested scopes intersected with identity scopes",
+			request: tokenRequest("", "", url.Values{
+				"grant_type":    {"client_credentials"},
+				"scope":         {"admin other.action"},
+				"client_id":     {"some-client"},
+				"client_secret": {"this is super secret"},
+			}),
+			code:    http.StatusOK,
+			scopes:  []string{"other.action"},
+			expires: 3600,
+		},
+		tokenTestCase{
+			name:    "subject not permitted by identity policy",
+			request: tokenRequest("subject-client", "this is super secret", url.Values{"grant_type": {"client_credentials"}}),
+			code:    http.StatusBadRequest,
+			err: errorResponse{
+				Code:        "unauthorized_client",
+				Description: `token not permitted by client policy: found "subject-client": subject not allowed`,
+			},
+		},
+		tokenTestCase{
+			name:    "lifetime limited by identity policy",
+			request: tokenRequest("short-lived-client", "this is super secret", url.Values{"grant_type": {"client_credentials"}}),
+			code:    http.StatusOK,
+			scopes:  []string{"resource.action", "other.action"},
+			expires: 60,
+		},
+	}.Run(t)
+}
+
+type tokenTestCase struct {
+	// name
+	name string
+	// inputs
+	request *http.Request
+	// outputs
+	code    int
+	err     errorResponse
+	scopes  []string
+	expires int64
+}
+
+func (c tokenTestCase) Name() string { return c.name }
+
+func (c tokenTestCase) Run(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	NewTokenHandler(storage).ServeHTTP(recorder, c.request)
+
+	assert.Equal(t, c.code, recorder.Code)
+	assert.Equal(t, "no-store", recorder.Header().Get("Cache-Control"))
+
+	if c.code != http.StatusOK {
+		var response errorResponse
+		require.Nil(t, json.NewDecoder(recorder.Body).Decode(&response))
+		assert.Equal(t, c.err, response)
+		return
+	}
+
+	var response TokenResponse
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&response))
+	assert.Equal(t, "Bearer", response.TokenType)
+	assert.Equal(t, c.expires, response.ExpiresIn)
+	assert.Equal(t, strings.Join(c.scopes, " "), response.Scope)
+
+	// issued tokens are accepted by an Authenticator using the same storage
+	token, err := jws.ParseJWT([]byte(response.AccessToken))
+	require.Nil(t, err)
+
+	scopes, err := auth.New(storage).Validate(token)
+	require.Nil(t, err)
+	assert.Equal(t, c.scopes, scopes)
+	assert.Equal(t, token.Claims().Get("sub"), token.Claims().Get("client_id"))
+}
+
+func tokenRequest(clientID, clientSecret string, form url.Values) *http.Request {
+	request := httptest.NewRequest("POST", "/token", strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientID != "" {
+		request.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	}
+
+	return request
+}
+
+func Test_TokenHandler_ClientAudiences(t *testing.T) {
+	request := func() *http.Request {
+		return tokenRequest("audience-client", "this is super secret", url.Values{"grant_type": {"client_credentials"}})
+	}
+
+	// the audiences of the clients policy are used when none are configured
+	for _, test := range []struct {
+		audience []string
+		code     int
+		aud      []string
+	}{
+		{audience: nil, code: http.StatusOK, aud: []string{"test.audience.com"}},
+		{audience: []string{"test.audience.com", "other.audience.com"}, code: http.StatusOK, aud: []string{"test.audience.com"}},
+		{audience: []string{"other.audience.com"}, code: http.StatusBadRequest},
+	} {
+		recorder := httptest.NewRecorder()
+		NewTokenHandler(storage, WithTokenAudience(test.audience...)).ServeHTTP(recorder, request())
+		require.Equal(t, test.code, recorder.Code, test.audience)
+
+		if test.code != http.StatusOK {
+			var response errorResponse
+			require.Nil(t, json.NewDecoder(recorder.Body).Decode(&response))
+			assert.Equal(t, "unauthorized_client", response.Code)
+			continue
+		}
+
+		var response TokenResponse
+		require.Nil(t, json.NewDecoder(recorder.Body).Decode(&response))
+
+		token, err := jws.ParseJWT([]byte(response.AccessToken))
+		require.Nil(t, err)
+
+		aud, _ := token.Claims().Audience()
+		assert.Equal(t, test.aud, aud, test.audience)
+	}
+}
+
+func Test_TokenHandler_SigningIdentity_ClientRevoked(t *testing.T) {
+	for name, test := range map[string]struct {
+		revoke func(*memory.Storage) error
+		err    error
+	}{
+		"revoked": {
+			revoke: func(store *memory.Storage) error {
+				return store.Revoke(client.Key)
+			},
+			err: auth.ErrCannotFindIdentity,
+		},
+		"disabled": {
+			revoke: func(store *memory.Storage) error {
+				_, _, err := store.Update(client.Key, func(id *identity.Identity) error {
+					id.Disabled = true
+					return nil
+				})
+				return err
+			},
+			err: auth.ErrIdentityDisabled,
+		},
+	} {
+		store := memory.NewStorage(memory.WithIdentities(client, issuer))
+
+		recorder := httptest.NewRecorder()
+		NewTokenHandler(store, WithSigningIdentity(issuer)).ServeHTTP(recorder, tokenRequest("some-client", "this is super secret", url.Values{
+			"grant_type": {"client_credentials"},
+		}))
+		require.Equal(t, http.StatusOK, recorder.Code, name)
+
+		var response TokenResponse
+		require.Nil(t, json.NewDecoder(recorder.Body).Decode(&response))
+
+		token, err := jws.ParseJWT([]byte(response.AccessToken))
+		require.Nil(t, err)
+
+		iss, _ := token.Claims().Issuer()
+		assert.Equal(t, issuer.Key, iss)
+
+		authenticator := auth.New(store)
+		_, err = authenticator.Validate(token)
+		require.Nil(t, err)
+
+		// outstanding tokens are rejected once their client can no longer authenticate
+		require.Nil(t, test.revoke(store))
+
+		_, err = authenticator.Validate(token)
+		assert.Equal(t, test.err, errors.Cause(err), name)
+		assert.True(t, auth.IsRejection(err), name)
+	}
+}
@@ -0,0 +1,157 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrKeyMissing is returned when a master key cannot be located.
+	ErrKeyMissing = errors.New("master key missing")
+
+	// ErrKeyInvalid is returned when a master key is not a valid AES key.
+	ErrKeyInvalid = errors.New("master key must be 16, 24 or 32 bytes")
+
+	// ErrUnknownKeyID is returned when a wrapped data key references a key ID which is not present.
+	ErrUnknownKeyID = errors.New("unknown master key ID")
+)
+
+// validate at compile time that the providers implement KeyProvider.
+var (
+	_ KeyProvider = MasterKey(nil)
+	_ KeyProvider = (*LocalKMS)(nil)
+)
+
+// KeyProvider is an interface which describes a mechanism for wrapping and
+// unwrapping the data keys used to encrypt secrets, using a master key
+// which it is responsible for keeping.
+type KeyProvider interface {
+	WrapKey(dataKey []byte) (wrapped []byte, err error)
+	UnwrapKey(wrapped []byte) (dataKey []byte, err error)
+}
+
+// MasterKey is a KeyProvider which wraps data keys with AES-GCM,
+// using its own value as the key.
+type MasterKey []byte
+
+// NewMasterKey returns a MasterKey after validating its length.
+func NewMasterKey(key []byte) (MasterKey, error) {
+	if !validKeySize(key) {
+		return nil, errors.Wrapf(ErrKeyInvalid, "secrets: found %d bytes", len(key))
+	}
+
+	return MasterKey(key), nil
+}
+
+// FromEnv returns a MasterKey from the base64 encoded value of the environment variable name.
+func FromEnv(name string) (MasterKey, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return nil, errors.Wrapf(ErrKeyMissing, "secrets: environment variable %q", name)
+	}
+
+	return decodeKey(value)
+}
+
+// FromFile returns a MasterKey from the base64 encoded contents of the file at path.
+func FromFile(path string) (MasterKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Wrapf(ErrKeyMissing, "secrets: file %q", path)
+		}
+
+		return nil, errors.Wrap(err, "secrets")
+	}
+
+	return decodeKey(string(data))
+}
+
+// WrapKey encrypts the data key using the master key.
+func (m MasterKey) WrapKey(dataKey []byte) ([]byte, error) {
+	return seal(m, dataKey)
+}
+
+// UnwrapKey decrypts a wrapped data key using the master key.
+func (m MasterKey) UnwrapKey(wrapped []byte) ([]byte, error) {
+	return open(m, wrapped)
+}
+
+// LocalKMS is a local stand-in for a key management service.
+// It holds a set of master keys by ID, wraps data keys with the current key
+// and records the key ID alongside the wrapped key. This allows the current
+// key to be rotated while secrets wrapped by previous keys remain readable.
+type LocalKMS struct {
+	current string
+	keys    map[string]MasterKey
+}
+
+// NewLocalKMS returns a LocalKMS which wraps data keys using the key for the current ID.
+func NewLocalKMS(current string, keys map[string][]byte) (*LocalKMS, error) {
+	kms := &LocalKMS{current: current, keys: map[string]MasterKey{}}
+	for id, key := range keys {
+		if strings.ContainsRune(id, 0) {
+			return nil, errors.Errorf("secrets: invalid key ID %q", id)
+		}
+
+		if !validKeySize(key) {
+			return nil, errors.Wrapf(ErrKeyInvalid, "secrets: key ID %q found %d bytes", id, len(key))
+		}
+
+		kms.keys[id] = MasterKey(key)
+	}
+
+	if _, ok := kms.keys[current]; !ok {
+		return nil, errors.Wrapf(ErrUnknownKeyID, "secrets: current key ID %q", current)
+	}
+
+	return kms, nil
+}
+
+// WrapKey encrypts the data key using the current master key, prefixed by its key ID.
+func (l *LocalKMS) WrapKey(dataKey []byte) ([]byte, error) {
+	wrapped, err := l.keys[l.current].WrapKey(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append([]byte(l.current), 0), wrapped...), nil
+}
+
+// UnwrapKey decrypts the data key using the master key identified by the wrapped key.
+func (l *LocalKMS) UnwrapKey(wrapped []byte) ([]byte, error) {
+	i := bytes.IndexByte(wrapped, 0)
+	if i < 0 {
+		return nil, ErrMalformed
+	}
+
+	master, ok := l.keys[string(wrapped[:i])]
+	if !ok {
+		return nil, errors.Wrapf(ErrUnknownKeyID, "found %q", wrapped[:i])
+	}
+
+	return master.UnwrapKey(wrapped[i+1:])
+}
+
+func decodeKey(value string) (MasterKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, errors.Wrap(err, "secrets: decoding master key")
+	}
+
+	return NewMasterKey(key)
+}
+
+func validKeySize(key []byte) bool {
+	switch len(key) {
+	case 16, 24, 32:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,120 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrReferenceMissing is returned when the target of a secret reference cannot be found.
+	ErrReferenceMissing = errors.New("secret reference cannot be resolved")
+
+	// ErrReferenceInvalid is returned when a secret reference is malformed.
+	ErrReferenceInvalid = errors.New("secret reference is invalid")
+
+	// ErrReferenceNotAllowed is returned when decoding a reference to the environment or a file.
+	ErrReferenceNotAllowed = errors.New("secret reference not allowed")
+)
+
+// schemes is the set of prefixes which are not interpreted literally by Resolve.
+var schemes = []string{"env:", "file:", "base64:", "hex:", prefix}
+
+// IsReference returns true if the value is a reference to a secret, or an
+// encrypted secret, rather than a literal secret.
+func IsReference(value string) bool {
+	for _, scheme := range schemes {
+		if strings.HasPrefix(value, scheme) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Encode returns a representation of the secret which Resolve maps back to the secret.
+// Printable secrets which would not be mistaken for a reference are returned as is,
+// otherwise they are base64 encoded.
+func Encode(secret []byte) string {
+	value := string(secret)
+	if !IsReference(value) && utf8.ValidString(value) && strings.IndexFunc(value, notPrintable) < 0 {
+		return value
+	}
+
+	return "base64:" + base64.StdEncoding.EncodeToString(secret)
+}
+
+func notPrintable(r rune) bool { return !unicode.IsPrint(r) }
+
+// Resolve resolves a secret reference in to the secret it refers to.
+// The following forms of reference are supported:
+//
+//	env:NAME       the value of the environment variable NAME
+//	file:/path     the contents of the file at /path, without trailing newlines
+//	base64:VALUE   the standard base64 decoding of VALUE
+//	hex:VALUE      the hex decoding of VALUE
+//
+// Any other value, including encrypted secrets, is returned as is.
+func Resolve(ref string) ([]byte, error) {
+	scheme, value := "", ref
+	if i := strings.Index(ref, ":"); i >= 0 {
+		scheme, value = ref[:i], ref[i+1:]
+	}
+
+	switch scheme {
+	case "env":
+		secret, ok := os.LookupEnv(value)
+		if !ok {
+			return nil, errors.Wrapf(ErrReferenceMissing, "secrets: environment variable %q not set", value)
+		}
+
+		return []byte(secret), nil
+	case "file":
+		data, err := ioutil.ReadFile(value)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, errors.Wrapf(ErrReferenceMissing, "secrets: file %q does not exist", value)
+			}
+
+			return nil, errors.Wrap(err, "secrets")
+		}
+
+		return bytes.TrimRight(data, "\r\n"), nil
+	case "base64":
+		secret, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, errors.Wrapf(ErrReferenceInvalid, "secrets: base64: %s", err.Error())
+		}
+
+		return secret, nil
+	case "hex":
+		secret, err := hex.DecodeString(value)
+		if err != nil {
+			return nil, errors.Wrapf(ErrReferenceInvalid, "secrets: hex: %s", err.Error())
+		}
+
+		return secret, nil
+	}
+
+	return []byte(ref), nil
+}
+
+// Decode reverses Encode. Unlike Resolve it never reads the environment or the
+// filesystem, so it is safe to use on untrusted input: env: and file: references
+// return ErrReferenceNotAllowed. Encrypted secrets are returned as is.
+func Decode(value string) ([]byte, error) {
+	for _, scheme := range []string{"env:", "file:"} {
+		if strings.HasPrefix(value, scheme) {
+			return nil, errors.Wrapf(ErrReferenceNotAllowed, "secrets: found %q reference", strings.TrimSuffix(scheme, ":"))
+		}
+	}
+
+	return Resolve(value)
+}
@@ -0,0 +1,91 @@
+package secrets
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Resolve(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hola")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "secret")
+	require.Nil(t, ioutil.WriteFile(path, []byte("this is super secret\n"), 0600))
+
+	os.Setenv("HOLA_TEST_SECRET", "this is super secret")
+	defer os.Unsetenv("HOLA_TEST_SECRET")
+
+	for ref, expected := range map[string]string{
+		"this is super secret":                   "this is super secret",
+		"env:HOLA_TEST_SECRET":                   "this is super secret",
+		"file:" + path:                           "this is super secret",
+		"base64:dGhpcyBpcyBzdXBlciBzZWNyZXQ=":    "this is super secret",
+		"hex:7468697320697320737570657220736563": "this is super sec",
+		"enc:abc:def":                            "enc:abc:def",
+	} {
+		secret, err := Resolve(ref)
+		require.Nil(t, err, ref)
+		assert.Equal(t, expected, string(secret), ref)
+	}
+}
+
+func Test_Resolve_Errors(t *testing.T) {
+	for ref, expected := range map[string]error{
+		"env:HOLA_TEST_MISSING_SECRET": ErrReferenceMissing,
+		"file:/does/not/exist":         ErrReferenceMissing,
+		"base64:!!!":                   ErrReferenceInvalid,
+		"hex:xyz":                      ErrReferenceInvalid,
+	} {
+		_, err := Resolve(ref)
+		assert.Equal(t, expected, errors.Cause(err), ref)
+	}
+}
+
+func Test_Encode(t *testing.T) {
+	for _, secret := range [][]byte{
+		[]byte("this is super secret"),
+		[]byte("env:HOLA_TEST_SECRET"),
+		[]byte("enc:abc:def"),
+		{0, 1, 2, 255},
+		[]byte("line\nbreak"),
+	} {
+		resolved, err := Resolve(Encode(secret))
+		require.Nil(t, err)
+		assert.Equal(t, secret, resolved)
+	}
+
+	assert.Equal(t, "this is super secret", Encode([]byte("this is super secret")))
+	assert.Equal(t, "base64:ZW52OkhPTEE=", Encode([]byte("env:HOLA")))
+}
+
+func Test_Decode(t *testing.T) {
+	os.Setenv("HOLA_TEST_SECRET", "this is super secret")
+	defer os.Unsetenv("HOLA_TEST_SECRET")
+
+	for _, secret := range [][]byte{
+		[]byte("this is super secret"),
+		[]byte("env:HOLA_TEST_SECRET"),
+		[]byte("enc:abc:def"),
+		{0, 1, 2, 255},
+	} {
+		decoded, err := Decode(Encode(secret))
+		require.Nil(t, err)
+		assert.Equal(t, secret, decoded)
+	}
+
+	for ref, expected := range map[string]error{
+		"env:HOLA_TEST_SECRET": ErrReferenceNotAllowed,
+		"file:/etc/shadow":     ErrReferenceNotAllowed,
+		"base64:!!!":           ErrReferenceInvalid,
+	} {
+		_, err := Decode(ref)
+		assert.Equal(t, expected, errors.Cause(err), ref)
+	}
+}
@@ -0,0 +1,142 @@
+package secrets
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// prefix identifies secrets stored in the encrypted envelope format.
+const prefix = "enc:"
+
+// dataKeySize is the size in bytes of the AES-256 keys generated per secret.
+const dataKeySize = 32
+
+var (
+	// ErrNotEncrypted is returned when attempting to decrypt a secret which is not in the envelope format.
+	ErrNotEncrypted = errors.New("secret is not encrypted")
+
+	// ErrMalformed is returned when an encrypted secret cannot be parsed.
+	ErrMalformed = errors.New("malformed encrypted secret")
+
+	// ErrDecrypt is returned when a secret or data key fails to decrypt.
+	ErrDecrypt = errors.New("secret cannot be decrypted")
+)
+
+// IsEncrypted returns true if the secret is in the encrypted envelope format.
+func IsEncrypted(secret []byte) bool {
+	return bytes.HasPrefix(secret, []byte(prefix))
+}
+
+// Encrypt performs envelope encryption of the plaintext secret.
+// A new data key is generated and used to encrypt the secret with AES-GCM.
+// The data key is then wrapped by the KeyProvider and stored alongside the secret,
+// in the form enc:<base64 wrapped data key>:<base64 sealed secret>.
+func Encrypt(p KeyProvider, plaintext []byte) ([]byte, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, errors.Wrap(err, "secrets: generating data key")
+	}
+
+	sealed, err := seal(dataKey, plaintext)
+	if err != nil {
+		return nil, errors.Wrap(err, "secrets: encrypting secret")
+	}
+
+	wrapped, err := p.WrapKey(dataKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "secrets: wrapping data key")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(prefix)
+	buf.WriteString(base64.RawStdEncoding.EncodeToString(wrapped))
+	buf.WriteByte(':')
+	buf.WriteString(base64.RawStdEncoding.EncodeToString(sealed))
+
+	return buf.Bytes(), nil
+}
+
+// Decrypt reverses Encrypt, unwrapping the data key using the KeyProvider
+// and using it to decrypt the secret.
+func Decrypt(p KeyProvider, secret []byte) ([]byte, error) {
+	if !IsEncrypted(secret) {
+		return nil, errors.Wrap(ErrNotEncrypted, "secrets")
+	}
+
+	parts := bytes.Split(secret[len(prefix):], []byte{':'})
+	if len(parts) != 2 {
+		return nil, errors.Wrapf(ErrMalformed, "secrets: expected 2 parts found %d", len(parts))
+	}
+
+	wrapped, err := base64.RawStdEncoding.DecodeString(string(parts[0]))
+	if err != nil {
+		return nil, errors.Wrapf(ErrMalformed, "secrets: data key: %s", err.Error())
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(string(parts[1]))
+	if err != nil {
+		return nil, errors.Wrapf(ErrMalformed, "secrets: secret: %s", err.Error())
+	}
+
+	dataKey, err := p.UnwrapKey(wrapped)
+	if err != nil {
+		return nil, errors.Wrap(err, "secrets: unwrapping data key")
+	}
+
+	plaintext, err := open(dataKey, sealed)
+	if err != nil {
+		return nil, errors.Wrap(err, "secrets: decrypting secret")
+	}
+
+	return plaintext, nil
+}
+
+// seal encrypts plaintext using AES-GCM and returns the nonce followed by the ciphertext
+func seal(key, plaintext []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// open decrypts the output of seal
+func open(key, sealed []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,109 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	keyOne = bytes.Repeat([]byte{1}, 32)
+	keyTwo = bytes.Repeat([]byte{2}, 16)
+)
+
+func Test_Encrypt_Decrypt(t *testing.T) {
+	master, err := NewMasterKey(keyOne)
+	require.Nil(t, err)
+
+	encrypted, err := Encrypt(master, []byte("this is super secret"))
+	require.Nil(t, err)
+	assert.True(t, IsEncrypted(encrypted))
+	assert.False(t, bytes.Contains(encrypted, []byte("this is super secret")))
+
+	decrypted, err := Decrypt(master, encrypted)
+	require.Nil(t, err)
+	assert.Equal(t, []byte("this is super secret"), decrypted)
+
+	// the wrong master key cannot decrypt the secret
+	_, err = Decrypt(MasterKey(keyTwo), encrypted)
+	assert.Equal(t, ErrDecrypt, errors.Cause(err))
+}
+
+func Test_Decrypt_Errors(t *testing.T) {
+	master := MasterKey(keyOne)
+
+	_, err := Decrypt(master, []byte("this is super secret"))
+	assert.Equal(t, ErrNotEncrypted, errors.Cause(err))
+
+	_, err = Decrypt(master, []byte("enc:abc"))
+	assert.Equal(t, ErrMalformed, errors.Cause(err))
+
+	_, err = Decrypt(master, []byte("enc:!!!:abc"))
+	assert.Equal(t, ErrMalformed, errors.Cause(err))
+}
+
+func Test_NewMasterKey_Invalid(t *testing.T) {
+	_, err := NewMasterKey([]byte("too short"))
+	assert.Equal(t, ErrKeyInvalid, errors.Cause(err))
+}
+
+func Test_FromEnv(t *testing.T) {
+	_, err := FromEnv("HOLA_TEST_MISSING_MASTER_KEY")
+	assert.Equal(t, ErrKeyMissing, errors.Cause(err))
+
+	os.Setenv("HOLA_TEST_MASTER_KEY", base64.StdEncoding.EncodeToString(keyOne))
+	defer os.Unsetenv("HOLA_TEST_MASTER_KEY")
+
+	master, err := FromEnv("HOLA_TEST_MASTER_KEY")
+	require.Nil(t, err)
+	assert.Equal(t, MasterKey(keyOne), master)
+}
+
+func Test_FromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hola")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "master.key")
+	_, err = FromFile(path)
+	assert.Equal(t, ErrKeyMissing, errors.Cause(err))
+
+	require.Nil(t, ioutil.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(keyTwo)+"\n"), 0600))
+
+	master, err := FromFile(path)
+	require.Nil(t, err)
+	assert.Equal(t, MasterKey(keyTwo), master)
+}
+
+func Test_LocalKMS_Rotation(t *testing.T) {
+	before, err := NewLocalKMS("one", map[string][]byte{"one": keyOne})
+	require.Nil(t, err)
+
+	encrypted, err := Encrypt(before, []byte("this is super secret"))
+	require.Nil(t, err)
+
+	// rotate current key to "two", keeping "one" for decryption
+	after, err := NewLocalKMS("two", map[string][]byte{"one": keyOne, "two": keyTwo})
+	require.Nil(t, err)
+
+	decrypted, err := Decrypt(after, encrypted)
+	require.Nil(t, err)
+	assert.Equal(t, []byte("this is super secret"), decrypted)
+
+	// once "one" is removed it can no longer be decrypted
+	removed, err := NewLocalKMS("two", map[string][]byte{"two": keyTwo})
+	require.Nil(t, err)
+
+	_, err = Decrypt(removed, encrypted)
+	assert.Equal(t, ErrUnknownKeyID, errors.Cause(err))
+
+	_, err = NewLocalKMS("three", map[string][]byte{"two": keyTwo})
+	assert.Equal(t, ErrUnknownKeyID, errors.Cause(err))
+}
@@ -27,3 +27,26 @@ func WithIssuer(iss string) Option {
 		s.iss = optionalString{valid: true, value: iss}
 	}
 }
+
+// WithAudience sets the audience claim on every signed token.
+func WithAudience(aud ...string) Option {
+	return func(s *Signer) {
+		s.aud = aud
+	}
+}
+
+// WithFlatClaims merges the additional claims passed to Sign in to the top
+// level of the token claims, instead of nesting them under the data key.
+func WithFlatClaims() Option {
+	return func(s *Signer) {
+		s.flat = true
+	}
+}
+
+// WithScopes sets the ScopesClaim on every signed token, which is the
+// claim the auth.Authenticator reads scopes from.
+func WithScopes(scopes ...string) Option {
+	return func(s *Signer) {
+		s.scopes = scopes
+	}
+}
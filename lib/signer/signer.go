@@ -1,8 +1,10 @@
 package signer
 
 import (
+	"encoding/json"
 	"time"
 
+	"github.com/pkg/errors"
 	"gopkg.in/jose.v1/crypto"
 	"gopkg.in/jose.v1/jws"
 	"gopkg.in/jose.v1/jwt"
@@ -10,10 +12,28 @@ import (
 	uuid "github.com/satori/go.uuid"
 )
 
+// ScopesClaim is the claim the scopes of a Signer are set under,
+// which is the claim an auth.Authenticator reads scopes from.
+const ScopesClaim = "scopes"
+
+var (
+	// ErrRegisteredClaim is returned when custom claims attempt to override
+	// a registered claim set by the Signer.
+	ErrRegisteredClaim = errors.New("custom claim overrides registered claim")
+
+	// ErrClaimsNotObject is returned when a claims struct does not encode to a JSON object.
+	ErrClaimsNotObject = errors.New("claims must encode to a JSON object")
+)
+
 var (
 	now         = time.Now
 	jti         = func() string { return uuid.NewV4().String() }
 	fiveMinutes = 5 * time.Minute
+
+	// registered is the set of claims which are reserved by RFC 7519
+	registered = map[string]struct{}{
+		"iss": {}, "sub": {}, "aud": {}, "exp": {}, "nbf": {}, "iat": {}, "jti": {},
+	}
 )
 
 type optionalString struct {
@@ -23,7 +43,10 @@ type optionalString struct {
 
 type Signer struct {
 	claimsKey string
+	flat      bool
 	sub, iss  optionalString
+	aud       []string
+	scopes    []string
 	exp       time.Duration
 	method    crypto.SigningMethod
 }
@@ -42,7 +65,23 @@ func New(method crypto.SigningMethod, opts ...Option) *Signer {
 	return signer
 }
 
+// Sign constructs a new JWT with the registered claims configured on the Signer.
+// By default the additional claims are nested under the Signers data key.
+// When the Signer is configured WithFlatClaims, they are merged in to the top level
+// of the claims and any which collide with a registered or scopes claim are dropped.
 func (s *Signer) Sign(additionalClaims map[string]interface{}) jwt.JWT {
+	token, _ := s.sign(additionalClaims, false)
+	return token
+}
+
+// SignClaims constructs a new JWT in the same way as Sign, but returns an error
+// ErrRegisteredClaim instead of dropping flat claims which collide with a
+// registered or scopes claim.
+func (s *Signer) SignClaims(additionalClaims map[string]interface{}) (jwt.JWT, error) {
+	return s.sign(additionalClaims, true)
+}
+
+func (s *Signer) sign(additionalClaims map[string]interface{}, strict bool) (jwt.JWT, error) {
 	now := now()
 	claims := jws.Claims{}
 	// set issued at to result of now()
@@ -62,8 +101,52 @@ func (s *Signer) Sign(additionalClaims map[string]interface{}) jwt.JWT {
 		claims.SetIssuer(s.iss.value)
 	}
 
-	// set custom claims issued by caller
-	claims.Set(s.claimsKey, additionalClaims)
+	// set audience to s.aud
+	if len(s.aud) > 0 {
+		claims.SetAudience(s.aud...)
+	}
+
+	// set scopes in the format expected by the auth.Authenticator
+	if len(s.scopes) > 0 {
+		claims.Set(ScopesClaim, s.scopes)
+	}
+
+	if !s.flat {
+		// set custom claims issued by caller
+		claims.Set(s.claimsKey, additionalClaims)
+
+		return jws.NewJWT(claims, s.method), nil
+	}
+
+	// merge custom claims in to the top level
+	for key, value := range additionalClaims {
+		if _, ok := registered[key]; ok || claims.Has(key) {
+			if strict {
+				return nil, errors.Wrapf(ErrRegisteredClaim, "signer: claim %q", key)
+			}
+
+			continue
+		}
+
+		claims.Set(key, value)
+	}
+
+	return jws.NewJWT(claims, s.method), nil
+}
+
+// SignStruct encodes v as a JSON object and signs the result as additional claims.
+// It allows typed claims structs to be used in place of a map and, like SignClaims,
+// returns an error ErrRegisteredClaim when a flat claim collides with a registered claim.
+func (s *Signer) SignStruct(v interface{}) (jwt.JWT, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "signer: encoding claims")
+	}
+
+	var additionalClaims map[string]interface{}
+	if err := json.Unmarshal(data, &additionalClaims); err != nil || additionalClaims == nil {
+		return nil, errors.Wrapf(ErrClaimsNotObject, "signer: found %s", data)
+	}
 
-	return jws.NewJWT(claims, s.method)
+	return s.SignClaims(additionalClaims)
 }
@@ -0,0 +1,78 @@
+package signer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/jose.v1/crypto"
+)
+
+func init() {
+	now = func() time.Time { return time.Unix(1500000000, 0) }
+	jti = func() string { return "some-jti" }
+}
+
+func Test_Sign_Nested(t *testing.T) {
+	signer := New(crypto.SigningMethodHS256, WithIssuer("some-issuer-key"), WithAudience("test.audience.com"))
+
+	token := signer.Sign(map[string]interface{}{"team": "platform"})
+
+	claims := token.Claims()
+	assert.Equal(t, map[string]interface{}{"team": "platform"}, claims.Get("claims"))
+	assert.Nil(t, claims.Get("team"))
+
+	iss, _ := claims.Issuer()
+	assert.Equal(t, "some-issuer-key", iss)
+
+	aud, _ := claims.Audience()
+	assert.Equal(t, []string{"test.audience.com"}, aud)
+}
+
+func Test_Sign_Flat(t *testing.T) {
+	signer := New(crypto.SigningMethodHS256, WithFlatClaims(), WithScopes("resource.action"))
+
+	token := signer.Sign(map[string]interface{}{"team": "platform"})
+
+	claims := token.Claims()
+	assert.Equal(t, "platform", claims.Get("team"))
+	assert.Equal(t, []string{"resource.action"}, claims.Get("scopes"))
+	assert.Nil(t, claims.Get("claims"))
+}
+
+func Test_Sign_Flat_RegisteredClaim(t *testing.T) {
+	signer := New(crypto.SigningMethodHS256, WithFlatClaims(), WithIssuer("some-issuer-key"), WithScopes("resource.action"))
+
+	claims := signer.Sign(map[string]interface{}{"iss": "override", "scopes": "override", "team": "platform"}).Claims()
+	assert.Equal(t, "some-issuer-key", claims.Get("iss"))
+	assert.Equal(t, []string{"resource.action"}, claims.Get("scopes"))
+	assert.Equal(t, "platform", claims.Get("team"))
+}
+
+func Test_SignClaims_Flat_RegisteredClaim(t *testing.T) {
+	signer := New(crypto.SigningMethodHS256, WithFlatClaims(), WithScopes("resource.action"))
+
+	for _, key := range []string{"iss", "exp", "jti", "scopes"} {
+		_, err := signer.SignClaims(map[string]interface{}{key: "override"})
+		assert.Equal(t, ErrRegisteredClaim, errors.Cause(err), key)
+	}
+
+	token, err := signer.SignClaims(map[string]interface{}{"team": "platform"})
+	require.Nil(t, err)
+	assert.Equal(t, "platform", token.Claims().Get("team"))
+}
+
+func Test_SignStruct(t *testing.T) {
+	signer := New(crypto.SigningMethodHS256, WithFlatClaims())
+
+	token, err := signer.SignStruct(struct {
+		Team string `json:"team"`
+	}{Team: "platform"})
+	require.Nil(t, err)
+	assert.Equal(t, "platform", token.Claims().Get("team"))
+
+	_, err = signer.SignStruct([]string{"not", "an", "object"})
+	assert.Equal(t, ErrClaimsNotObject, errors.Cause(err))
+}
@@ -0,0 +1,200 @@
+// Package file implements identity storage persisted to a file, encoded
+// as YAML, JSON or TOML according to the extension of the file.
+package file
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/georgemac/hola/lib/storage/yaml"
+	"github.com/pkg/errors"
+	yamlv2 "gopkg.in/yaml.v2"
+)
+
+// ErrUnknownFormat is returned when a file format cannot be determined from its extension.
+var ErrUnknownFormat = errors.New("unknown file format")
+
+// Format encodes and decodes the identities held in a file.
+type Format struct {
+	Name      string
+	Marshal   func([]identity.Stored) ([]byte, error)
+	Unmarshal func([]byte) ([]identity.Stored, error)
+}
+
+var (
+	// YAML stores identities as a list, the format read by yaml.Storage.
+	YAML = Format{Name: "yaml", Marshal: marshalYAML, Unmarshal: unmarshalYAML}
+
+	// JSON stores identities as an array.
+	JSON = Format{Name: "json", Marshal: marshalJSON, Unmarshal: unmarshalJSON}
+
+	// TOML stores identities in an array of tables named identities,
+	// which may equally be written as inline tables.
+	TOML = Format{Name: "toml", Marshal: identity.MarshalTOML, Unmarshal: unmarshalTOML}
+)
+
+// extensions maps file extensions to the format of the file.
+var extensions = map[string]Format{
+	".yaml": YAML,
+	".yml":  YAML,
+	".json": JSON,
+	".toml": TOML,
+}
+
+// FormatFor returns the Format of the file at path, according to its extension.
+func FormatFor(path string) (Format, error) {
+	format, ok := extensions[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return Format{}, errors.Wrapf(ErrUnknownFormat, "file %q", path)
+	}
+
+	return format, nil
+}
+
+// Storage is a yaml.Storage which reads and writes its identities in the format
+// of a file. Secrets are encrypted at rest when configured with WithKeyProvider.
+type Storage struct {
+	*yaml.Storage
+
+	path   string
+	format *Format
+	opts   []yaml.Option
+}
+
+// New returns an empty Storage for the file at path, without reading it.
+// The format is chosen from the extension of the file unless set with WithFormat.
+func New(path string, opts ...Option) (*Storage, error) {
+	s := &Storage{path: path}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.format == nil {
+		format, err := FormatFor(path)
+		if err != nil {
+			return nil, err
+		}
+
+		s.format = &format
+	}
+
+	s.Storage = yaml.NewStorage(s.opts...)
+
+	return s, nil
+}
+
+// Open returns a Storage containing the identities read from the file at path.
+func Open(path string, opts ...Option) (*Storage, error) {
+	s, err := New(path, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.ReadFile(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// ReadFrom reads identities encoded in the format of the Storage from r,
+// implementing io.ReaderFrom. It returns the number of bytes read.
+func (s *Storage) ReadFrom(r io.Reader) (int64, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return int64(len(data)), err
+	}
+
+	identities, err := s.format.Unmarshal(data)
+	if err != nil {
+		return int64(len(data)), err
+	}
+
+	return int64(len(data)), s.Load(identities)
+}
+
+// Save writes the identities to w in the format of the Storage.
+func (s *Storage) Save(w io.Writer) error {
+	data, err := s.format.Marshal(s.Snapshot())
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// ReadFile reads the identities from the file.
+func (s *Storage) ReadFile() error {
+	fi, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+
+	defer fi.Close()
+
+	_, err = s.ReadFrom(fi)
+	return errors.Wrapf(err, "reading %q", s.path)
+}
+
+// WriteFile writes the identities to a temporary file,
+// which replaces the file once completely written.
+func (s *Storage) WriteFile() error {
+	fi, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(fi.Name())
+
+	if err := s.Save(fi); err != nil {
+		fi.Close()
+		return err
+	}
+
+	if err := fi.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(fi.Name(), s.path)
+}
+
+func marshalYAML(identities []identity.Stored) ([]byte, error) {
+	return yamlv2.Marshal(identities)
+}
+
+func unmarshalYAML(data []byte) ([]identity.Stored, error) {
+	var identities identity.Entries
+	err := yamlv2.Unmarshal(data, &identities)
+	return identities, err
+}
+
+func marshalJSON(identities []identity.Stored) ([]byte, error) {
+	data, err := json.MarshalIndent(identities, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(data, '\n'), nil
+}
+
+func unmarshalJSON(data []byte) ([]identity.Stored, error) {
+	var identities identity.Entries
+	err := json.Unmarshal(data, &identities)
+	return identities, err
+}
+
+func unmarshalTOML(data []byte) ([]identity.Stored, error) {
+	var document struct {
+		Identities identity.Entries `toml:"identities"`
+	}
+
+	err := toml.Unmarshal(data, &document)
+	return document.Identities, err
+}
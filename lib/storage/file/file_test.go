@@ -0,0 +1,281 @@
+package file
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/georgemac/hola/lib/secrets"
+	"github.com/georgemac/hola/lib/storage/storagetest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/jose.v1/crypto"
+)
+
+var identities = []identity.Identity{
+	{
+		Key:       "first",
+		Secret:    []byte("first secret"),
+		Scopes:    []string{"resource.action"},
+		Method:    crypto.SigningMethodHS256,
+		Policy:    identity.Policy{MaxLifetime: time.Hour},
+		CreatedAt: time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC),
+		Owner:     "platform",
+	},
+	{
+		Key:         "second",
+		Secret:      []byte("second secret"),
+		Method:      crypto.SigningMethodHS512,
+		Disabled:    true,
+		Description: "a disabled identity",
+	},
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "hola")
+	require.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func Test_Storage_Conformance(t *testing.T) {
+	dir := tempDir(t)
+
+	storagetest.Run(t, func(t *testing.T) identity.Fetcher {
+		s, err := New(filepath.Join(dir, "identities.json"))
+		require.Nil(t, err)
+		return s
+	})
+}
+
+func Test_Storage_RoundTrip(t *testing.T) {
+	master, err := secrets.NewMasterKey(bytes.Repeat([]byte{1}, 32))
+	require.Nil(t, err)
+
+	for _, name := range []string{"identities.yaml", "identities.yml", "identities.json", "identities.toml"} {
+		for _, encrypted := range []bool{false, true} {
+			var opts []Option
+			if encrypted {
+				opts = append(opts, WithKeyProvider(master))
+			}
+
+			path := filepath.Join(tempDir(t), name)
+
+			s, err := New(path, opts...)
+			require.Nil(t, err)
+
+			for _, id := range identities {
+				require.Nil(t, s.Put(id))
+			}
+
+			require.Nil(t, s.WriteFile())
+
+			data, err := ioutil.ReadFile(path)
+			require.Nil(t, err)
+			assert.Equal(t, !encrypted, strings.Contains(string(data), "first secret"), name)
+
+			read, err := Open(path, opts...)
+			require.Nil(t, err, name)
+
+			for _, id := range identities {
+				found, ok, err := read.Fetch(id.Key)
+				require.Nil(t, err)
+				require.True(t, ok)
+
+				assert.Equal(t, id, found, name)
+			}
+		}
+	}
+}
+
+func Test_Storage_Formats(t *testing.T) {
+	for _, testCase := range []struct {
+		name string
+		data string
+		opts []Option
+	}{
+		{
+			name: "identities.yaml",
+			data: "- key: first\n  secret: first secret\n  signing_method: HS256\n",
+		},
+		{
+			name: "identities.json",
+			data: `[{"key": "first", "secret": "first secret", "signing_method": "HS256"}]`,
+		},
+		{
+			name: "identities.toml",
+			data: "[[identities]]\nkey = \"first\"\nsecret = \"first secret\"\nsigning_method = \"HS256\"\n",
+		},
+		{
+			name: "identities.conf",
+			data: `[{"key": "first", "secret": "first secret", "signing_method": "HS256"}]`,
+			opts: []Option{WithFormat(JSON)},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			path := filepath.Join(tempDir(t), testCase.name)
+			require.Nil(t, ioutil.WriteFile(path, []byte(testCase.data), 0600))
+
+			s, err := Open(path, testCase.opts...)
+			require.Nil(t, err)
+
+			id, ok, err := s.Fetch("first")
+			require.Nil(t, err)
+			require.True(t, ok)
+			assert.Equal(t, []byte("first secret"), id.Secret)
+			assert.Equal(t, crypto.SigningMethodHS256, id.Method)
+		})
+	}
+}
+
+func Test_Storage_Errors(t *testing.T) {
+	dir := tempDir(t)
+
+	_, err := New(filepath.Join(dir, "identities.conf"))
+	assert.Equal(t, ErrUnknownFormat, errors.Cause(err))
+
+	_, err = Open(filepath.Join(dir, "missing.json"))
+	assert.True(t, os.IsNotExist(errors.Cause(err)))
+
+	path := filepath.Join(dir, "malformed.toml")
+	require.Nil(t, ioutil.WriteFile(path, []byte(`identities = [{key = "first", scopes = "resource.action"}]`), 0600))
+
+	_, err = Open(path)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), identity.ErrMalformedIdentity.Error())
+}
+
+func Test_Storage_MalformedEntry(t *testing.T) {
+	dir := tempDir(t)
+
+	for name, data := range map[string]string{
+		"identities.yaml": "- key: first\n  signing_method: HS256\n- key: second\n  signing_method: RS256\n",
+		"identities.json": `[{"key": "first", "signing_method": "HS256"}, {"key": "second", "signing_method": "RS256"}]`,
+		"identities.toml": "[[identities]]\nkey = \"first\"\nsigning_method = \"HS256\"\n\n[[identities]]\nkey = \"second\"\nsigning_method = \"RS256\"\n",
+		"inline.toml":     `identities = [{key = "first", signing_method = "HS256"}, {key = "second", signing_method = "RS256"}]`,
+	} {
+		path := filepath.Join(dir, name)
+		require.Nil(t, ioutil.WriteFile(path, []byte(data), 0600), name)
+
+		// the error names the position and key of the entry which cannot be decoded
+		_, err := Open(path)
+		require.NotNil(t, err, name)
+		assert.Contains(t, err.Error(), `identities[1]: identity "second": found "RS256"`, name)
+		assert.True(t, identity.IsMalformed(err), name)
+	}
+}
+
+func Test_Storage_TOML_Layout(t *testing.T) {
+	var buf bytes.Buffer
+
+	s, err := New("identities.toml")
+	require.Nil(t, err)
+	require.Nil(t, s.Save(&buf))
+	assert.Equal(t, "identities = []\n", buf.String())
+
+	for _, id := range identities {
+		require.Nil(t, s.Put(id))
+	}
+
+	buf.Reset()
+	require.Nil(t, s.Save(&buf))
+	assert.Equal(t, `[[identities]]
+key = "first"
+secret = "first secret"
+scopes = ["resource.action"]
+signing_method = "HS256"
+created_at = 2017-07-14T02:40:00Z
+owner = "platform"
+[identities.policy]
+max_lifetime = "1h0m0s"
+
+[[identities]]
+key = "second"
+secret = "second secret"
+signing_method = "HS512"
+disabled = true
+description = "a disabled identity"
+`, buf.String())
+}
+
+func Test_ParseLocation(t *testing.T) {
+	for location, expected := range map[string][2]string{
+		"identities.yaml":        {"", "identities.yaml"},
+		"yaml:identities.json":   {"yaml", "identities.json"},
+		"file:identities.json":   {"file", "identities.json"},
+		"other:/srv/ids.yaml":    {"other", "/srv/ids.yaml"},
+		"/srv/hola:v2/ids.yaml":  {"", "/srv/hola:v2/ids.yaml"},
+		"file:/srv/hola:v2/ids":  {"file", "/srv/hola:v2/ids"},
+		`C:\hola\identities.yml`: {"", `C:\hola\identities.yml`},
+	} {
+		scheme, path := ParseLocation(location)
+		assert.Equal(t, expected, [2]string{scheme, path}, location)
+	}
+}
+
+func Test_OpenLocation(t *testing.T) {
+	dir := filepath.Join(tempDir(t), "hola:v2")
+	require.Nil(t, os.Mkdir(dir, 0700))
+
+	path := filepath.Join(dir, "identities.json")
+
+	s, err := NewLocation("file:" + path)
+	require.Nil(t, err)
+	require.Nil(t, s.Put(identities[0]))
+	require.Nil(t, s.WriteFile())
+
+	read, err := OpenLocation("file:" + path)
+	require.Nil(t, err)
+
+	_, ok, err := read.Fetch("first")
+	require.Nil(t, err)
+	assert.True(t, ok)
+
+	// the yaml scheme rejects the extensions of other formats
+	_, err = OpenLocation("yaml:" + path)
+	assert.Equal(t, ErrSchemeMismatch, errors.Cause(err))
+
+	_, err = OpenLocation("other:" + path)
+	assert.Equal(t, ErrUnknownScheme, errors.Cause(err))
+}
+
+func Test_NewLocation_NoScheme(t *testing.T) {
+	dir := tempDir(t)
+
+	for name, format := range map[string]Format{
+		"ids.yaml": YAML,
+		"ids.json": JSON,
+		"ids.toml": TOML,
+		"ids":      YAML,
+	} {
+		path := filepath.Join(dir, name)
+
+		s, err := NewLocation(path)
+		require.Nil(t, err, name)
+		assert.Equal(t, format.Name, s.format.Name, name)
+
+		// the file is written and read back in the format of its extension
+		require.Nil(t, s.Put(identities[0]), name)
+		require.Nil(t, s.WriteFile(), name)
+
+		expected, err := format.Marshal([]identity.Stored{{Identity: identities[0]}})
+		require.Nil(t, err, name)
+
+		data, err := ioutil.ReadFile(path)
+		require.Nil(t, err, name)
+		assert.Equal(t, string(expected), string(data), name)
+
+		read, err := OpenLocation(path)
+		require.Nil(t, err, name)
+
+		_, ok, err := read.Fetch("first")
+		require.Nil(t, err, name)
+		assert.True(t, ok, name)
+	}
+}
@@ -0,0 +1,74 @@
+package file
+
+import (
+	"path/filepath"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// ErrUnknownScheme is returned when a store location has a scheme which is not supported.
+var ErrUnknownScheme = errors.New("unknown store scheme")
+
+// ErrSchemeMismatch is returned when the extension of a store location is
+// the extension of a format other than the format of its scheme.
+var ErrSchemeMismatch = errors.New("extension does not match store scheme")
+
+// schemePattern matches the scheme of a location, which follows the syntax of
+// a URL scheme. Single letters are not schemes, so drive letters are left intact.
+var schemePattern = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9+.-]+):`)
+
+// ParseLocation splits a store location in the form [scheme:]path in to its scheme
+// and path. Text before the first colon is only a scheme when it is a valid URL
+// scheme, so paths which contain a colon, such as /srv/hola:v2/ids.yaml, are
+// returned whole. Locations without a scheme have an empty scheme.
+func ParseLocation(location string) (scheme, path string) {
+	if match := schemePattern.FindStringSubmatch(location); match != nil {
+		return match[1], location[len(match[0]):]
+	}
+
+	return "", location
+}
+
+// NewLocation returns an empty Storage for the file at a location in the form
+// [scheme:]path, without reading it. The file scheme chooses the format from the
+// extension of the file, while the yaml scheme reads and writes YAML and returns
+// ErrSchemeMismatch for the extensions of other formats. Without a scheme the format
+// is chosen from the extension, falling back to YAML for unknown extensions.
+// Any other scheme returns ErrUnknownScheme.
+func NewLocation(location string, opts ...Option) (*Storage, error) {
+	scheme, path := ParseLocation(location)
+	format, err := FormatFor(path)
+	switch scheme {
+	case "":
+		if err != nil {
+			opts = append([]Option{WithFormat(YAML)}, opts...)
+		}
+	case "yaml":
+		if err == nil && format.Name != YAML.Name {
+			return nil, errors.Wrapf(ErrSchemeMismatch, "found %q for scheme %q", filepath.Ext(path), scheme)
+		}
+
+		opts = append([]Option{WithFormat(YAML)}, opts...)
+	case "file":
+	default:
+		return nil, errors.Wrapf(ErrUnknownScheme, "found %q", scheme)
+	}
+
+	return New(path, opts...)
+}
+
+// OpenLocation returns a Storage containing the identities read from the file at
+// a location in the form [scheme:]path, as described by NewLocation.
+func OpenLocation(location string, opts ...Option) (*Storage, error) {
+	s, err := NewLocation(location, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.ReadFile(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
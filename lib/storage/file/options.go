@@ -0,0 +1,32 @@
+package file
+
+import (
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/georgemac/hola/lib/secrets"
+	"github.com/georgemac/hola/lib/storage/yaml"
+)
+
+// Option is a function which manipulates the state of a Storage
+type Option func(*Storage)
+
+// WithFormat sets the format of the file, regardless of its extension.
+func WithFormat(format Format) Option {
+	return func(s *Storage) {
+		s.format = &format
+	}
+}
+
+// WithKeyProvider decrypts secrets as identities are read and encrypts
+// them as they are stored, using the provided KeyProvider.
+func WithKeyProvider(provider secrets.KeyProvider) Option {
+	return func(s *Storage) {
+		s.opts = append(s.opts, yaml.WithKeyProvider(provider))
+	}
+}
+
+// WithIssuePolicy validates requests to issue identities against the policy.
+func WithIssuePolicy(policy identity.IssuePolicy) Option {
+	return func(s *Storage) {
+		s.opts = append(s.opts, yaml.WithIssuePolicy(policy))
+	}
+}
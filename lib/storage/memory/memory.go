@@ -0,0 +1,142 @@
+// Package memory implements identity storage held in memory, which is
+// safe for concurrent use. It is intended for tests and for embedding hola
+// in processes which manage persistence themselves.
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/pkg/errors"
+)
+
+// validate at compile time that Storage implements the identity storage interfaces.
+var (
+	_ identity.Fetcher = (*Storage)(nil)
+	_ identity.Issuer  = (*Storage)(nil)
+	_ identity.Revoker = (*Storage)(nil)
+	_ identity.Lister  = (*Storage)(nil)
+	_ identity.Updater = (*Storage)(nil)
+	_ identity.Rotator = (*Storage)(nil)
+	_ identity.Putter  = (*Storage)(nil)
+)
+
+var now = time.Now
+
+// Storage is an in-memory identity store. The zero value is not usable, see NewStorage.
+type Storage struct {
+	mu         sync.RWMutex
+	identities map[string]identity.Identity
+	policy     identity.IssuePolicy
+}
+
+// NewStorage returns an empty Storage configured with the provided options.
+func NewStorage(opts ...Option) *Storage {
+	s := &Storage{identities: map[string]identity.Identity{}}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Fetch returns the identity for the key.
+func (s *Storage) Fetch(key string) (identity.Identity, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.identities[key]
+	return id.Clone(), ok, nil
+}
+
+// Issue stores and returns a new identity generated for the request,
+// which is validated against the issue policy of the Storage.
+func (s *Storage) Issue(req identity.IssueRequest) (identity.Identity, error) {
+	id, err := identity.NewGenerator(s.policy).Issue(req)
+	if err != nil {
+		return identity.Identity{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.identities[id.Key]; ok {
+		return identity.Identity{}, errors.Wrapf(identity.ErrKeyInUse, "key %q", id.Key)
+	}
+
+	s.identities[id.Key] = id.Clone()
+	return id, nil
+}
+
+// Put stores the identity, replacing any existing identity with the same key.
+func (s *Storage) Put(id identity.Identity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.identities[id.Key] = id.Clone()
+	return nil
+}
+
+// Revoke removes the identity for the key, if present.
+func (s *Storage) Revoke(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.identities, key)
+	return nil
+}
+
+// List returns the page of identities described by opts.
+func (s *Storage) List(opts identity.ListOptions) (identity.Page, error) {
+	s.mu.RLock()
+	identities := make([]identity.Identity, 0, len(s.identities))
+	for _, id := range s.identities {
+		identities = append(identities, id.Clone())
+	}
+	s.mu.RUnlock()
+
+	return identity.Paginate(identities, opts)
+}
+
+// Update applies update to the identity for the key and stores the result.
+// Updates which grant a scope or signing method not permitted by the issue policy
+// are rejected. The stored identity is left unchanged when update returns an error.
+func (s *Storage) Update(key string, update func(*identity.Identity) error) (identity.Identity, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.identities[key]
+	if !ok {
+		return identity.Identity{}, false, nil
+	}
+
+	id := stored.Clone()
+	if err := update(&id); err != nil {
+		return identity.Identity{}, true, err
+	}
+
+	if id.Key != key {
+		return identity.Identity{}, true, errors.Wrapf(identity.ErrKeyChanged, "identity %q", key)
+	}
+
+	if err := s.policy.ValidateUpdate(stored, id); err != nil {
+		return identity.Identity{}, true, errors.Wrapf(err, "identity %q", key)
+	}
+
+	s.identities[key] = id.Clone()
+	return id, true, nil
+}
+
+// Rotate replaces the secret of the identity for the key with a secret generated
+// under the issue policy of the Storage, retaining the previous secret for
+// verification during the grace period.
+func (s *Storage) Rotate(key string, grace time.Duration) (identity.Identity, bool, error) {
+	rotate, err := identity.NewGenerator(s.policy).Rotation(grace, now())
+	if err != nil {
+		return identity.Identity{}, false, err
+	}
+
+	return s.Update(key, rotate)
+}
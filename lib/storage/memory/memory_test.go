@@ -0,0 +1,38 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/georgemac/hola/lib/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/jose.v1/crypto"
+)
+
+func Test_Storage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(*testing.T) identity.Fetcher {
+		return NewStorage()
+	})
+}
+
+func Test_Storage_Isolation(t *testing.T) {
+	storage := NewStorage(WithIdentities(identity.Identity{
+		Key:    "some-issuer-key",
+		Secret: []byte("this is super secret"),
+		Method: crypto.SigningMethodHS256,
+		Scopes: []string{"resource.action"},
+	}))
+
+	// mutating a fetched identity does not modify the stored identity
+	id, ok, err := storage.Fetch("some-issuer-key")
+	require.Nil(t, err)
+	require.True(t, ok)
+	id.Scopes[0] = "admin"
+	id.Secret[0] = 'T'
+
+	id, _, err = storage.Fetch("some-issuer-key")
+	require.Nil(t, err)
+	assert.Equal(t, []string{"resource.action"}, id.Scopes)
+	assert.Equal(t, []byte("this is super secret"), id.Secret)
+}
@@ -0,0 +1,23 @@
+package memory
+
+import "github.com/georgemac/hola/lib/identity"
+
+// Option is a function which manipulates the state of a Storage
+type Option func(*Storage)
+
+// WithIssuePolicy validates requests to issue identities, and the scopes and
+// signing methods granted by updates, against the policy.
+func WithIssuePolicy(policy identity.IssuePolicy) Option {
+	return func(s *Storage) {
+		s.policy = policy
+	}
+}
+
+// WithIdentities stores the provided identities.
+func WithIdentities(identities ...identity.Identity) Option {
+	return func(s *Storage) {
+		for _, id := range identities {
+			s.identities[id.Key] = id.Clone()
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/georgemac/hola/lib/secrets"
+	"github.com/georgemac/hola/lib/signer"
+	"github.com/pkg/errors"
+)
+
+// validate at compile time that Fetcher implements identity.Fetcher.
+var _ identity.Fetcher = (*Fetcher)(nil)
+
+// ErrUnexpectedStatus is returned when the server responds with an unexpected status code.
+var ErrUnexpectedStatus = errors.New("unexpected response status")
+
+// cached is an identity with the entity tag it was served with
+type cached struct {
+	etag     string
+	identity identity.Identity
+}
+
+// Fetcher is an identity.Fetcher which fetches identities from a Handler over HTTP.
+//
+// Each attempt is bounded by a timeout and failed attempts are retried, with a
+// linearly increasing backoff, when the request fails or the server responds with
+// a 5xx or 429 status. Fetched identities are retained with their ETag and
+// revalidated with conditional requests, so unchanged identities are not transferred again.
+type Fetcher struct {
+	baseURL  string
+	client   *http.Client
+	timeout  time.Duration
+	retries  int
+	backoff  time.Duration
+	identity *identity.Identity
+	keys     secrets.KeyProvider
+
+	mu    sync.Mutex
+	cache map[string]cached
+}
+
+// NewFetcher returns a Fetcher for the Handler served at baseURL. By default
+// attempts time out after five seconds and are retried twice, backing off 100ms.
+func NewFetcher(baseURL string, opts ...Option) *Fetcher {
+	f := &Fetcher{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  http.DefaultClient,
+		timeout: 5 * time.Second,
+		retries: 2,
+		backoff: 100 * time.Millisecond,
+		cache:   map[string]cached{},
+	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	return f
+}
+
+// Fetch returns the identity for the key from the server.
+func (f *Fetcher) Fetch(key string) (identity.Identity, bool, error) {
+	var err error
+	for attempt := 0; attempt <= f.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * f.backoff)
+		}
+
+		var (
+			id    identity.Identity
+			ok    bool
+			retry bool
+		)
+
+		if id, ok, retry, err = f.fetch(key); err == nil || !retry {
+			return id, ok, err
+		}
+	}
+
+	return identity.Identity{}, false, errors.Wrapf(err, "fetching identity %q after %d attempts", key, f.retries+1)
+}
+
+// fetch makes a single attempt to fetch the identity, returning whether a failure may be retried
+func (f *Fetcher) fetch(key string) (id identity.Identity, ok, retry bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodGet, f.baseURL+"/identities/"+url.PathEscape(key), nil)
+	if err != nil {
+		return identity.Identity{}, false, false, err
+	}
+
+	req = req.WithContext(ctx)
+
+	if err := f.authorize(req); err != nil {
+		return identity.Identity{}, false, false, err
+	}
+
+	f.mu.Lock()
+	entry, isCached := f.cache[key]
+	f.mu.Unlock()
+
+	if isCached {
+		req.Header.Set("If-None-Match", entry.etag)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return identity.Identity{}, false, true, err
+	}
+
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		if isCached {
+			return entry.identity, true, false, nil
+		}
+
+		return identity.Identity{}, false, false, errors.Wrap(ErrUnexpectedStatus, "not modified without a cached identity")
+	case http.StatusNotFound:
+		f.mu.Lock()
+		delete(f.cache, key)
+		f.mu.Unlock()
+
+		return identity.Identity{}, false, false, nil
+	default:
+		retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return identity.Identity{}, false, retry, errors.Wrapf(ErrUnexpectedStatus, "found %d", resp.StatusCode)
+	}
+
+	// identities are untrusted, so references to the environment or files are rejected
+	var sealed identity.Sealed
+	if err := json.NewDecoder(resp.Body).Decode(&sealed); err != nil {
+		// responses which were read but hold an invalid identity are not retried
+		return identity.Identity{}, false, !identity.IsMalformed(err), errors.Wrap(ErrMalformedIdentity, err.Error())
+	}
+
+	if id, err = sealed.Open(f.keys); err != nil {
+		return identity.Identity{}, false, false, errors.Wrap(ErrMalformedIdentity, err.Error())
+	}
+
+	if tag := resp.Header.Get("ETag"); tag != "" {
+		f.mu.Lock()
+		f.cache[key] = cached{etag: tag, identity: id}
+		f.mu.Unlock()
+	}
+
+	return id, true, false, nil
+}
+
+// authorize adds a short lived bearer token, signed by the configured identity, to the request
+func (f *Fetcher) authorize(req *http.Request) error {
+	if f.identity == nil {
+		return nil
+	}
+
+	token := signer.New(f.identity.Method,
+		signer.WithIssuer(f.identity.Key),
+		signer.WithScopes(f.identity.Scopes...),
+		signer.WithExpiration(time.Minute),
+	).Sign(nil)
+
+	serialized, err := token.Serialize(f.identity.Secret)
+	if err != nil {
+		return errors.Wrap(err, "signing request token")
+	}
+
+	req.Header.Set("Authorization", "Bearer "+string(serialized))
+	return nil
+}
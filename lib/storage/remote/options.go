@@ -0,0 +1,64 @@
+package remote
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/georgemac/hola/lib/secrets"
+)
+
+// Option is a function which manipulates the state of a Fetcher
+type Option func(*Fetcher)
+
+// WithHTTPClient sets the client used to make requests, which defaults to http.DefaultClient.
+func WithHTTPClient(client *http.Client) Option {
+	return func(f *Fetcher) {
+		f.client = client
+	}
+}
+
+// WithTimeout sets the maximum duration of each attempt to fetch an identity.
+func WithTimeout(timeout time.Duration) Option {
+	return func(f *Fetcher) {
+		f.timeout = timeout
+	}
+}
+
+// WithRetries sets the number of times a failed attempt is retried, and the backoff
+// before the first retry, which increases linearly with each subsequent retry.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(f *Fetcher) {
+		f.retries = retries
+		f.backoff = backoff
+	}
+}
+
+// WithIdentity authenticates requests with short lived tokens signed by the identity,
+// containing each of its scopes. The identity must have the scope required by the server.
+func WithIdentity(id identity.Identity) Option {
+	return func(f *Fetcher) {
+		f.identity = &id
+	}
+}
+
+// WithKeyProvider decrypts encrypted secrets in fetched identities using keys,
+// such as those served by a Handler configured with WithSealingKey.
+// Without a key provider, identities with encrypted secrets are rejected.
+func WithKeyProvider(keys secrets.KeyProvider) Option {
+	return func(f *Fetcher) {
+		f.keys = keys
+	}
+}
+
+// HandlerOption is a function which manipulates the state of a Handler
+type HandlerOption func(*Handler)
+
+// WithSealingKey encrypts the secrets of served identities using keys, so they are
+// not exposed to anything between the Handler and a Fetcher configured with
+// WithKeyProvider using the same keys. Secrets are served in plaintext by default.
+func WithSealingKey(keys secrets.KeyProvider) HandlerOption {
+	return func(h *Handler) {
+		h.keys = keys
+	}
+}
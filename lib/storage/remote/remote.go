@@ -0,0 +1,19 @@
+// Package remote implements fetching identities over HTTP, so that identities
+// can be held by one service and fetched by others.
+package remote
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+)
+
+// ErrMalformedIdentity is returned when an identity document cannot be used.
+var ErrMalformedIdentity = errors.New("malformed identity document")
+
+// etag returns a strong entity tag for the encoded document
+func etag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
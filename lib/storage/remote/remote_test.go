@@ -0,0 +1,343 @@
+package remote
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/georgemac/hola/lib/auth"
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/georgemac/hola/lib/secrets"
+	"github.com/georgemac/hola/lib/storage/memory"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/jose.v1/crypto"
+)
+
+var (
+	admin = identity.Identity{
+		Key:    "admin-key",
+		Secret: []byte("this is super secret"),
+		Method: crypto.SigningMethodHS256,
+		Scopes: []string{"hola.admin"},
+	}
+
+	reader = identity.Identity{
+		Key:    "reader-key",
+		Secret: []byte("reader secret"),
+		Method: crypto.SigningMethodHS256,
+		Scopes: []string{"resource.action"},
+	}
+
+	service = identity.Identity{
+		Key:       "service/key",
+		Secret:    []byte("service secret"),
+		Method:    crypto.SigningMethodHS512,
+		Scopes:    []string{"resource.action"},
+		Policy:    identity.Policy{MaxLifetime: time.Hour, Audiences: []string{"api.example.com"}},
+		CreatedAt: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+		Owner:     "platform",
+		Retired: &identity.RetiredSecret{
+			Secret:    []byte("previous secret"),
+			ExpiresAt: time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC),
+		},
+	}
+)
+
+func newServer(t *testing.T) (*httptest.Server, *memory.Storage) {
+	store := memory.NewStorage(memory.WithIdentities(admin, reader, service))
+	server := httptest.NewServer(NewServer(store, auth.New(store), "hola.admin"))
+	t.Cleanup(server.Close)
+	return server, store
+}
+
+func Test_Fetcher(t *testing.T) {
+	var (
+		server, store = newServer(t)
+		notModified   int32
+		handler       = server.Config.Handler
+	)
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		if recorder.Code == http.StatusNotModified {
+			atomic.AddInt32(&notModified, 1)
+		}
+
+		for k, v := range recorder.Header() {
+			w.Header()[k] = v
+		}
+
+		w.WriteHeader(recorder.Code)
+		w.Write(recorder.Body.Bytes())
+	})
+
+	fetcher := NewFetcher(server.URL, WithIdentity(admin))
+
+	// fetch
+	id, ok, err := fetcher.Fetch(service.Key)
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.Equal(t, service, id)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&notModified))
+
+	// revalidated with a conditional request
+	id, ok, err = fetcher.Fetch(service.Key)
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.Equal(t, service, id)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&notModified))
+
+	// changes are fetched
+	_, _, err = store.Update(service.Key, identity.SetScopes("resource.other"))
+	require.Nil(t, err)
+
+	id, ok, err = fetcher.Fetch(service.Key)
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.Equal(t, []string{"resource.other"}, id.Scopes)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&notModified))
+
+	// revoked identities are not found
+	require.Nil(t, store.Revoke(service.Key))
+
+	_, ok, err = fetcher.Fetch(service.Key)
+	require.Nil(t, err)
+	assert.False(t, ok)
+
+	// unknown identities are not found
+	_, ok, err = fetcher.Fetch("unknown")
+	require.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func Test_Fetcher_Authentication(t *testing.T) {
+	server, _ := newServer(t)
+
+	for _, testCase := range []struct {
+		name   string
+		opts   []Option
+		status string
+	}{
+		{name: "no identity", status: "found 400"},
+		{
+			name:   "missing admin scope",
+			opts:   []Option{WithIdentity(reader)},
+			status: "found 403",
+		},
+		{
+			name: "invalid secret",
+			opts: []Option{WithIdentity(identity.Identity{
+				Key:    admin.Key,
+				Secret: []byte("not the secret"),
+				Method: admin.Method,
+				Scopes: admin.Scopes,
+			})},
+			status: "found 401",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, ok, err := NewFetcher(server.URL, testCase.opts...).Fetch(service.Key)
+			assert.False(t, ok)
+			assert.Equal(t, ErrUnexpectedStatus, errors.Cause(err))
+			assert.Contains(t, err.Error(), testCase.status)
+		})
+	}
+}
+
+func Test_Fetcher_Retries(t *testing.T) {
+	for _, testCase := range []struct {
+		name     string
+		failures int32
+		status   int
+		retried  bool
+		requests int32
+	}{
+		{name: "recovers from server errors", failures: 2, status: http.StatusBadGateway, retried: true, requests: 3},
+		{name: "recovers when rate limited", failures: 1, status: http.StatusTooManyRequests, retried: true, requests: 2},
+		{name: "gives up after retries", failures: 3, status: http.StatusServiceUnavailable, requests: 3},
+		{name: "client errors are not retried", failures: 3, status: http.StatusBadRequest, requests: 1},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			var (
+				server, _ = newServer(t)
+				handler   = server.Config.Handler
+				requests  int32
+			)
+
+			server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&requests, 1) <= testCase.failures {
+					w.WriteHeader(testCase.status)
+					return
+				}
+
+				handler.ServeHTTP(w, r)
+			})
+
+			fetcher := NewFetcher(server.URL, WithIdentity(admin), WithRetries(2, time.Millisecond))
+
+			id, ok, err := fetcher.Fetch(service.Key)
+			assert.Equal(t, testCase.requests, atomic.LoadInt32(&requests))
+			if !testCase.retried {
+				assert.Equal(t, ErrUnexpectedStatus, errors.Cause(err))
+				assert.False(t, ok)
+				return
+			}
+
+			require.Nil(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, service.Key, id.Key)
+		})
+	}
+}
+
+func Test_Fetcher_MalformedIdentity(t *testing.T) {
+	for _, testCase := range []struct {
+		name     string
+		body     string
+		requests int32
+	}{
+		{name: "environment reference", body: `{"key": "k", "secret": "env:HOME", "signing_method": "HS256"}`, requests: 1},
+		{name: "file reference", body: `{"key": "k", "secret": "file:/etc/passwd", "signing_method": "HS256"}`, requests: 1},
+		{name: "unsupported method", body: `{"key": "k", "secret": "s", "signing_method": "none"}`, requests: 1},
+		{name: "encrypted without key provider", body: `{"key": "k", "secret": "enc:abc:def", "signing_method": "HS256"}`, requests: 1},
+		{name: "truncated body is retried", body: `{"key": "k", "sec`, requests: 3},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			var (
+				requests int32
+				server   = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					atomic.AddInt32(&requests, 1)
+					w.Write([]byte(testCase.body))
+				}))
+			)
+
+			defer server.Close()
+
+			fetcher := NewFetcher(server.URL, WithRetries(2, time.Millisecond))
+
+			_, ok, err := fetcher.Fetch("k")
+			assert.False(t, ok)
+			assert.Equal(t, ErrMalformedIdentity, errors.Cause(err))
+			assert.Equal(t, testCase.requests, atomic.LoadInt32(&requests))
+		})
+	}
+}
+
+func Test_Fetcher_KeyProvider(t *testing.T) {
+	keys := secrets.MasterKey(bytes.Repeat([]byte{1}, 32))
+
+	encrypted, err := secrets.Encrypt(keys, reader.Secret)
+	require.Nil(t, err)
+
+	body, err := json.Marshal(identity.Stored{Identity: reader, EncodedSecret: string(encrypted)})
+	require.Nil(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+
+	defer server.Close()
+
+	id, ok, err := NewFetcher(server.URL, WithKeyProvider(keys)).Fetch(reader.Key)
+	require.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, reader, id)
+
+	// secrets encrypted with another key cannot be decrypted
+	_, ok, err = NewFetcher(server.URL, WithKeyProvider(secrets.MasterKey(bytes.Repeat([]byte{2}, 32)))).Fetch(reader.Key)
+	assert.False(t, ok)
+	assert.Equal(t, ErrMalformedIdentity, errors.Cause(err))
+}
+
+func Test_Server_SealingKey(t *testing.T) {
+	var (
+		keys   = secrets.MasterKey(bytes.Repeat([]byte{1}, 32))
+		store  = memory.NewStorage(memory.WithIdentities(admin, service))
+		server = httptest.NewServer(NewServer(store, auth.New(store), "hola.admin", WithSealingKey(keys)))
+	)
+
+	defer server.Close()
+
+	// secrets are encrypted in responses
+	recorder := httptest.NewRecorder()
+	NewHandler(store, WithSealingKey(keys)).ServeHTTP(recorder, httptest.NewRequest("GET", "/identities/service%2Fkey", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.NotContains(t, recorder.Body.String(), string(service.Secret))
+	assert.NotContains(t, recorder.Body.String(), string(service.Retired.Secret))
+
+	// and decrypted by fetchers with the same keys, which revalidate them
+	fetcher := NewFetcher(server.URL, WithIdentity(admin), WithKeyProvider(keys))
+	for i := 0; i < 2; i++ {
+		id, ok, err := fetcher.Fetch(service.Key)
+		require.Nil(t, err)
+		require.True(t, ok)
+		assert.Equal(t, service, id)
+	}
+
+	request := httptest.NewRequest("GET", "/identities/service%2Fkey", nil)
+	request.Header.Set("If-None-Match", recorder.Header().Get("ETag"))
+	recorder = httptest.NewRecorder()
+	NewHandler(store, WithSealingKey(keys)).ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusNotModified, recorder.Code)
+
+	// fetchers without the keys reject them
+	_, ok, err := NewFetcher(server.URL, WithIdentity(admin)).Fetch(service.Key)
+	assert.False(t, ok)
+	assert.Equal(t, ErrMalformedIdentity, errors.Cause(err))
+}
+
+func Test_Fetcher_Timeout(t *testing.T) {
+	var (
+		requests int32
+		release  = make(chan struct{})
+		server   = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}))
+	)
+
+	defer server.Close()
+	defer close(release)
+
+	fetcher := NewFetcher(server.URL, WithTimeout(10*time.Millisecond), WithRetries(1, time.Millisecond))
+
+	_, ok, err := fetcher.Fetch(service.Key)
+	assert.False(t, ok)
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func Test_Handler(t *testing.T) {
+	store := memory.NewStorage(memory.WithIdentities(service))
+	handler := NewHandler(store)
+
+	for _, testCase := range []struct {
+		name   string
+		method string
+		path   string
+		status int
+	}{
+		{name: "get", method: "GET", path: "/identities/service%2Fkey", status: http.StatusOK},
+		{name: "head", method: "HEAD", path: "/identities/service%2Fkey", status: http.StatusOK},
+		{name: "unknown key", method: "GET", path: "/identities/unknown", status: http.StatusNotFound},
+		{name: "unknown path", method: "GET", path: "/keys/service", status: http.StatusNotFound},
+		{name: "nested path", method: "GET", path: "/identities/service/key", status: http.StatusNotFound},
+		{name: "method not allowed", method: "DELETE", path: "/identities/service%2Fkey", status: http.StatusMethodNotAllowed},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(testCase.method, testCase.path, nil))
+			assert.Equal(t, testCase.status, recorder.Code)
+		})
+	}
+}
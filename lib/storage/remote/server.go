@@ -0,0 +1,109 @@
+package remote
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/georgemac/hola/lib/auth"
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/georgemac/hola/lib/middleware"
+	"github.com/georgemac/hola/lib/secrets"
+)
+
+// Handler is an implementation of net/http.Handler which serves identities
+// from an identity.Fetcher at /identities/{key}, including their secrets.
+// Responses carry an ETag and conditional requests using If-None-Match
+// are answered with 304 Not Modified when the identity is unchanged.
+// It does not authenticate requests itself, see NewServer.
+type Handler struct {
+	fetcher identity.Fetcher
+	keys    secrets.KeyProvider
+}
+
+// NewHandler returns a Handler which serves identities from the fetcher.
+func NewHandler(fetcher identity.Fetcher, opts ...HandlerOption) *Handler {
+	h := &Handler{fetcher: fetcher}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+// NewServer returns a Handler protected by middleware.HTTP using the provided
+// Authenticator. As identities include their secrets, requests must present
+// a token containing scope, which should only be granted to admin identities.
+func NewServer(fetcher identity.Fetcher, authenticator *auth.Authenticator, scope string, opts ...HandlerOption) *middleware.HTTP {
+	return middleware.New(middleware.RequireScope(scope, NewHandler(fetcher, opts...)), authenticator)
+}
+
+// ServeHTTP serves the identity for the key in the request path.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.EscapedPath(), "/")
+	if !strings.HasPrefix(path, "identities/") || strings.Count(path, "/") != 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	key, err := url.PathUnescape(strings.TrimPrefix(path, "identities/"))
+	if err != nil {
+		http.Error(w, "malformed key", http.StatusBadRequest)
+		return
+	}
+
+	id, ok, err := h.fetcher.Fetch(key)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	} else if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	data, err := json.Marshal(id)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// encryption is not deterministic, so the tag is that of the identity as it is
+	tag := etag(data)
+	if h.keys != nil {
+		if data, err = h.seal(id); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("ETag", tag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+
+	if r.Header.Get("If-None-Match") == tag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method == http.MethodGet {
+		w.Write(data)
+	}
+}
+
+// seal returns the identity encoded with its secrets encrypted
+func (h *Handler) seal(id identity.Identity) ([]byte, error) {
+	sealed, err := identity.Seal(id, h.keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(sealed)
+}
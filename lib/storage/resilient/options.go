@@ -0,0 +1,37 @@
+package resilient
+
+import "time"
+
+// Option is a function which manipulates the state of a Fetcher
+type Option func(*Fetcher)
+
+// WithStaleWindow sets how long after it was last fetched successfully an identity
+// is served when the decorated fetcher fails. Zero disables serving stale identities.
+func WithStaleWindow(window time.Duration) Option {
+	return func(f *Fetcher) {
+		f.stale = window
+	}
+}
+
+// WithFailureThreshold sets the number of consecutive failures which open the circuit breaker.
+func WithFailureThreshold(threshold int) Option {
+	return func(f *Fetcher) {
+		f.threshold = threshold
+	}
+}
+
+// WithCooldown sets how long the circuit breaker remains open before a trial fetch is made.
+func WithCooldown(cooldown time.Duration) Option {
+	return func(f *Fetcher) {
+		f.cooldown = cooldown
+	}
+}
+
+// WithStateHook sets a function called whenever the circuit breaker changes state.
+// The hook is called synchronously while the Fetcher is locked, so it must not
+// call the Fetcher and should return quickly.
+func WithStateHook(hook func(from, to State)) Option {
+	return func(f *Fetcher) {
+		f.hook = hook
+	}
+}
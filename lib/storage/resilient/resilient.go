@@ -0,0 +1,255 @@
+// Package resilient implements an identity.Fetcher decorator which keeps
+// authentication working through short outages of the storage it decorates.
+package resilient
+
+import (
+	"sync"
+	"time"
+
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/pkg/errors"
+)
+
+// validate at compile time that Fetcher implements identity.Fetcher.
+var _ identity.Fetcher = (*Fetcher)(nil)
+
+// ErrCircuitOpen is returned when the circuit breaker is open and no
+// stale identity can be served in place of the decorated fetcher.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+var now = time.Now
+
+// State is the state of a circuit breaker.
+type State int
+
+const (
+	// Closed is the state in which every fetch is sent to the decorated fetcher.
+	Closed State = iota
+	// Open is the state in which fetches are not sent to the decorated fetcher.
+	Open
+	// HalfOpen is the state in which a single trial fetch is sent to the
+	// decorated fetcher, to determine whether it has recovered.
+	HalfOpen
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+
+	return "unknown"
+}
+
+// entry is the last known good identity for a key
+type entry struct {
+	identity  identity.Identity
+	fetchedAt time.Time
+	// seq is the sequence number of the fetch which returned the identity
+	seq uint64
+}
+
+// Fetcher is an identity.Fetcher which decorates another fetcher.
+//
+// Identities fetched successfully are retained, and served in place of an
+// error for the stale window when the decorated fetcher fails. Identities
+// which are no longer found are forgotten immediately, so revocations take
+// effect as soon as the decorated fetcher observes them. Fetches may complete
+// out of order, so an identity is only retained from a fetch which started
+// after any fetch observed that identity to be missing.
+//
+// After a number of consecutive failures the circuit breaker opens and fetches
+// are no longer sent to the decorated fetcher until the cooldown has passed.
+// A single trial fetch is then made, which closes the breaker on success
+// or opens it again on failure.
+type Fetcher struct {
+	fetcher   identity.Fetcher
+	stale     time.Duration
+	threshold int
+	cooldown  time.Duration
+	hook      func(from, to State)
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	trial    bool
+	entries  map[string]entry
+
+	// seq numbers fetches sent to the decorated fetcher in the order they start
+	seq uint64
+	// pending counts the fetches in flight for each key
+	pending map[string]int
+	// missing is the sequence number of the latest fetch to find each key missing,
+	// kept only while earlier fetches for the key may still be in flight
+	missing map[string]uint64
+}
+
+// New returns a Fetcher which decorates the provided fetcher. By default stale identities
+// are served for five minutes and the breaker opens after five consecutive failures,
+// for a cooldown of thirty seconds.
+func New(fetcher identity.Fetcher, opts ...Option) *Fetcher {
+	f := &Fetcher{
+		fetcher:   fetcher,
+		stale:     5 * time.Minute,
+		threshold: 5,
+		cooldown:  30 * time.Second,
+		entries:   map[string]entry{},
+		pending:   map[string]int{},
+		missing:   map[string]uint64{},
+	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	return f
+}
+
+// State returns the current state of the circuit breaker.
+func (f *Fetcher) State() State {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.state
+}
+
+// Fetch returns the identity for the key from the decorated fetcher, or the last known
+// good identity for the key when the decorated fetcher fails or the breaker is open.
+func (f *Fetcher) Fetch(key string) (identity.Identity, bool, error) {
+	seq, allowed := f.allow(key)
+	if !allowed {
+		if id, ok := f.lastKnown(key); ok {
+			return id, true, nil
+		}
+
+		return identity.Identity{}, false, ErrCircuitOpen
+	}
+
+	id, ok, err := f.fetcher.Fetch(key)
+	if err != nil {
+		f.failure(key)
+
+		if id, ok := f.lastKnown(key); ok {
+			return id, true, nil
+		}
+
+		return identity.Identity{}, false, err
+	}
+
+	f.success(key, id, ok, seq)
+
+	return id, ok, nil
+}
+
+// allow returns true, along with the sequence number of the fetch,
+// if a fetch for the key may be sent to the decorated fetcher
+func (f *Fetcher) allow(key string) (uint64, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch f.state {
+	case Open:
+		if now().Sub(f.openedAt) < f.cooldown {
+			return 0, false
+		}
+
+		f.transition(HalfOpen)
+		f.trial = true
+	case HalfOpen:
+		// only the trial fetch is sent until it completes
+		if f.trial {
+			return 0, false
+		}
+
+		f.trial = true
+	}
+
+	f.seq++
+	f.pending[key]++
+	return f.seq, true
+}
+
+func (f *Fetcher) success(key string, id identity.Identity, ok bool, seq uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	e, found := f.entries[key]
+	switch {
+	case found && e.seq > seq:
+		// a later fetch has already completed for the key
+	case ok && seq > f.missing[key]:
+		f.entries[key] = entry{identity: id, fetchedAt: now(), seq: seq}
+	case !ok:
+		delete(f.entries, key)
+		if seq > f.missing[key] {
+			f.missing[key] = seq
+		}
+	}
+
+	f.release(key)
+
+	f.failures = 0
+	f.trial = false
+	f.transition(Closed)
+}
+
+func (f *Fetcher) failure(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.release(key)
+
+	f.failures++
+	f.trial = false
+
+	if f.state == HalfOpen || f.failures >= f.threshold {
+		f.openedAt = now()
+		f.transition(Open)
+	}
+}
+
+// release records a fetch for the key as complete, forgetting when the key
+// was last found missing once no fetch for it remains in flight.
+// It must be called with the mutex held.
+func (f *Fetcher) release(key string) {
+	if f.pending[key]--; f.pending[key] > 0 {
+		return
+	}
+
+	delete(f.pending, key)
+	delete(f.missing, key)
+}
+
+// lastKnown returns the last known good identity for the key, if it is within the stale window
+func (f *Fetcher) lastKnown(key string) (identity.Identity, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	e, ok := f.entries[key]
+	if !ok || f.stale <= 0 || now().Sub(e.fetchedAt) > f.stale {
+		return identity.Identity{}, false
+	}
+
+	return e.identity, true
+}
+
+// transition changes the state of the breaker, calling the hook on change.
+// It must be called with the mutex held.
+func (f *Fetcher) transition(to State) {
+	if f.state == to {
+		return
+	}
+
+	from := f.state
+	f.state = to
+
+	if f.hook != nil {
+		f.hook(from, to)
+	}
+}
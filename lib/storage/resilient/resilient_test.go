@@ -0,0 +1,273 @@
+package resilient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errUnavailable = errors.New("storage unavailable")
+
+// backend is a fetcher which knows a single identity and can be made to fail
+type backend struct {
+	calls   int
+	failing bool
+	revoked bool
+}
+
+func (b *backend) Fetch(key string) (identity.Identity, bool, error) {
+	b.calls++
+	if b.failing {
+		return identity.Identity{}, false, errUnavailable
+	}
+
+	if key != "some-issuer-key" || b.revoked {
+		return identity.Identity{}, false, nil
+	}
+
+	return identity.Identity{Key: key, Secret: []byte("this is super secret")}, true, nil
+}
+
+type clock struct{ time.Time }
+
+func (c *clock) advance(d time.Duration) { c.Time = c.Add(d) }
+
+func setup(t *testing.T, opts ...Option) (*Fetcher, *backend, *clock, *[]string) {
+	c := &clock{time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)}
+	now = func() time.Time { return c.Time }
+
+	var transitions []string
+	opts = append([]Option{WithStateHook(func(from, to State) {
+		transitions = append(transitions, from.String()+"->"+to.String())
+	})}, opts...)
+
+	b := &backend{}
+	return New(b, opts...), b, c, &transitions
+}
+
+func Test_Fetcher_StaleWhileError(t *testing.T) {
+	defer func() { now = time.Now }()
+
+	fetcher, backend, clock, _ := setup(t, WithStaleWindow(time.Minute), WithFailureThreshold(100))
+
+	id, ok, err := fetcher.Fetch("some-issuer-key")
+	require.Nil(t, err)
+	require.True(t, ok)
+
+	// errors are masked by the last known good identity within the stale window
+	backend.failing = true
+	clock.advance(time.Minute)
+
+	stale, ok, err := fetcher.Fetch("some-issuer-key")
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.Equal(t, id, stale)
+
+	// but not once it has passed
+	clock.advance(time.Second)
+	_, ok, err = fetcher.Fetch("some-issuer-key")
+	assert.False(t, ok)
+	assert.Equal(t, errUnavailable, err)
+
+	// keys never fetched successfully are not masked
+	_, _, err = fetcher.Fetch("other-key")
+	assert.Equal(t, errUnavailable, err)
+
+	// identities no longer found are forgotten
+	backend.failing, backend.revoked = false, true
+	_, ok, err = fetcher.Fetch("some-issuer-key")
+	require.Nil(t, err)
+	assert.False(t, ok)
+
+	backend.failing = true
+	_, _, err = fetcher.Fetch("some-issuer-key")
+	assert.Equal(t, errUnavailable, err)
+}
+
+func Test_Fetcher_CircuitBreaker(t *testing.T) {
+	defer func() { now = time.Now }()
+
+	fetcher, backend, clock, transitions := setup(t, WithFailureThreshold(2), WithCooldown(10*time.Second))
+
+	_, _, err := fetcher.Fetch("some-issuer-key")
+	require.Nil(t, err)
+
+	backend.failing = true
+	for i := 0; i < 2; i++ {
+		_, _, err = fetcher.Fetch("some-issuer-key")
+		require.Nil(t, err, "stale identity served")
+	}
+
+	assert.Equal(t, Open, fetcher.State())
+	assert.Equal(t, []string{"closed->open"}, *transitions)
+	assert.Equal(t, 3, backend.calls)
+
+	// the backend is not called while open
+	id, ok, err := fetcher.Fetch("some-issuer-key")
+	require.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "some-issuer-key", id.Key)
+
+	_, ok, err = fetcher.Fetch("other-key")
+	assert.False(t, ok)
+	assert.Equal(t, ErrCircuitOpen, err)
+	assert.Equal(t, 3, backend.calls)
+
+	// a failed trial after the cooldown opens the breaker again
+	clock.advance(10 * time.Second)
+	_, _, err = fetcher.Fetch("other-key")
+	assert.Equal(t, errUnavailable, err)
+	assert.Equal(t, 4, backend.calls)
+	assert.Equal(t, Open, fetcher.State())
+
+	// a successful trial closes it
+	backend.failing = false
+	clock.advance(10 * time.Second)
+	_, ok, err = fetcher.Fetch("some-issuer-key")
+	require.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, Closed, fetcher.State())
+	assert.Equal(t, []string{
+		"closed->open",
+		"open->half-open",
+		"half-open->open",
+		"open->half-open",
+		"half-open->closed",
+	}, *transitions)
+}
+
+func Test_Fetcher_HalfOpen_SingleTrial(t *testing.T) {
+	defer func() { now = time.Now }()
+
+	fetcher, backend, clock, _ := setup(t, WithFailureThreshold(1), WithCooldown(time.Second))
+
+	backend.failing = true
+	_, _, err := fetcher.Fetch("some-issuer-key")
+	require.Equal(t, errUnavailable, err)
+	require.Equal(t, Open, fetcher.State())
+
+	// while a trial is in flight other fetches are not sent to the backend
+	clock.advance(time.Second)
+	_, allowed := fetcher.allow("some-issuer-key")
+	require.True(t, allowed)
+	assert.Equal(t, HalfOpen, fetcher.State())
+	_, allowed = fetcher.allow("some-issuer-key")
+	assert.False(t, allowed)
+
+	_, _, err = fetcher.Fetch("some-issuer-key")
+	assert.Equal(t, ErrCircuitOpen, err)
+	assert.Equal(t, 1, backend.calls)
+}
+
+// result is the outcome of a fetch from a blocking backend
+type result struct {
+	id  identity.Identity
+	ok  bool
+	err error
+}
+
+// blocking is a fetcher which sends each fetch a channel on started and returns
+// the result sent to that channel
+type blocking struct {
+	started chan chan result
+}
+
+func (b *blocking) Fetch(string) (identity.Identity, bool, error) {
+	results := make(chan result)
+	b.started <- results
+	r := <-results
+	return r.id, r.ok, r.err
+}
+
+func Test_Fetcher_OutOfOrderRevocation(t *testing.T) {
+	var (
+		backend = &blocking{started: make(chan chan result)}
+		fetcher = New(backend, WithFailureThreshold(100))
+		id      = identity.Identity{Key: "some-issuer-key", Secret: []byte("this is super secret")}
+		slowed  = make(chan struct{})
+		revoked = make(chan struct{})
+	)
+
+	// a slow fetch starts before the identity is revoked
+	go func() {
+		defer close(slowed)
+		_, ok, err := fetcher.Fetch("some-issuer-key")
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	}()
+	slow := <-backend.started
+
+	// and a later fetch observes the revocation first
+	go func() {
+		defer close(revoked)
+		_, ok, err := fetcher.Fetch("some-issuer-key")
+		assert.Nil(t, err)
+		assert.False(t, ok)
+	}()
+	(<-backend.started) <- result{}
+	<-revoked
+
+	// the slow fetch completes last
+	slow <- result{id: id, ok: true}
+	<-slowed
+
+	// the revoked identity is not served when the backend fails
+	go func() {
+		(<-backend.started) <- result{err: errUnavailable}
+	}()
+
+	_, ok, err := fetcher.Fetch("some-issuer-key")
+	assert.False(t, ok)
+	assert.Equal(t, errUnavailable, err)
+}
+
+func Test_Fetcher_MissingOtherKey(t *testing.T) {
+	var (
+		backend = &blocking{started: make(chan chan result)}
+		fetcher = New(backend, WithFailureThreshold(100))
+		id      = identity.Identity{Key: "some-issuer-key", Secret: []byte("this is super secret")}
+		slowed  = make(chan struct{})
+		missed  = make(chan struct{})
+	)
+
+	// a slow fetch starts for one key
+	go func() {
+		defer close(slowed)
+		_, ok, err := fetcher.Fetch("some-issuer-key")
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	}()
+	slow := <-backend.started
+
+	// and a later fetch finds another key missing
+	go func() {
+		defer close(missed)
+		_, ok, err := fetcher.Fetch("other-issuer-key")
+		assert.Nil(t, err)
+		assert.False(t, ok)
+	}()
+	(<-backend.started) <- result{}
+	<-missed
+
+	// the slow fetch completes last
+	slow <- result{id: id, ok: true}
+	<-slowed
+
+	// the identity is still served when the backend fails
+	go func() {
+		(<-backend.started) <- result{err: errUnavailable}
+	}()
+
+	fetched, ok, err := fetcher.Fetch("some-issuer-key")
+	require.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, id, fetched)
+
+	// and nothing is kept for keys without fetches in flight
+	assert.Empty(t, fetcher.pending)
+	assert.Empty(t, fetcher.missing)
+}
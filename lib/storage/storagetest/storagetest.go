@@ -0,0 +1,423 @@
+// Package storagetest provides a conformance test suite for identity storage backends,
+// so that custom backends can prove they behave like the reference implementations.
+package storagetest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/jose.v1/crypto"
+)
+
+// Factory returns a new empty store on each call. Stores must implement
+// identity.Fetcher and are exercised as an identity.Issuer, Revoker, Lister,
+// Updater, Rotator and Putter when they implement those interfaces. Suites which
+// create identities require an identity.Issuer and are skipped otherwise.
+type Factory func(t *testing.T) identity.Fetcher
+
+// Run runs the conformance suite against stores returned by the factory.
+// Run it with the race detector enabled to verify concurrent access.
+func Run(t *testing.T, factory Factory) {
+	t.Run("Fetcher", func(t *testing.T) { testFetcher(t, factory) })
+	t.Run("Issuer", func(t *testing.T) { testIssuer(t, factory) })
+	t.Run("Revoker", func(t *testing.T) { testRevoker(t, factory) })
+	t.Run("Lister", func(t *testing.T) { testLister(t, factory) })
+	t.Run("Updater", func(t *testing.T) { testUpdater(t, factory) })
+	t.Run("Rotator", func(t *testing.T) { testRotator(t, factory) })
+	t.Run("Putter", func(t *testing.T) { testPutter(t, factory) })
+	t.Run("Isolation", func(t *testing.T) { testIsolation(t, factory) })
+	t.Run("Concurrency", func(t *testing.T) { testConcurrency(t, factory) })
+}
+
+// issuer returns a new store as an identity.Issuer, skipping the test if it is not one
+func issuer(t *testing.T, factory Factory) (identity.Fetcher, identity.Issuer) {
+	store := factory(t)
+
+	issuer, ok := store.(identity.Issuer)
+	if !ok {
+		t.Skip("store does not implement identity.Issuer")
+	}
+
+	return store, issuer
+}
+
+func issue(t *testing.T, issuer identity.Issuer, req identity.IssueRequest) identity.Identity {
+	id, err := issuer.Issue(req)
+	require.Nil(t, err)
+	return id
+}
+
+func testFetcher(t *testing.T, factory Factory) {
+	store := factory(t)
+
+	// missing keys are not an error
+	for _, key := range []string{"missing-key", ""} {
+		_, ok, err := store.Fetch(key)
+		require.Nil(t, err, key)
+		assert.False(t, ok, key)
+	}
+}
+
+func testIssuer(t *testing.T, factory Factory) {
+	store, issuer := issuer(t, factory)
+
+	issued := issue(t, issuer, identity.IssueRequest{
+		Scopes:      []string{"resource.action", "other.action"},
+		Method:      "HS512",
+		KeyPrefix:   "svc-",
+		Owner:       "platform",
+		Description: "some client",
+	})
+	assert.NotEmpty(t, issued.Key)
+	assert.NotEmpty(t, issued.Secret)
+
+	// issued identities are immediately fetchable
+	fetched, ok, err := store.Fetch(issued.Key)
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.Equal(t, issued.Key, fetched.Key)
+	assert.Equal(t, issued.Secret, fetched.Secret)
+	assert.Equal(t, []string{"resource.action", "other.action"}, fetched.Scopes)
+	assert.Equal(t, "HS512", fetched.Method.Alg())
+	assert.Equal(t, "platform", fetched.Owner)
+	assert.Equal(t, "some client", fetched.Description)
+	assert.Equal(t, "svc-", fetched.Key[:4])
+
+	// keys and secrets are unique
+	other := issue(t, issuer, identity.IssueRequest{})
+	assert.NotEqual(t, issued.Key, other.Key)
+	assert.NotEqual(t, issued.Secret, other.Secret)
+
+	// keys may be requested, but not reused
+	named := issue(t, issuer, identity.IssueRequest{Key: "some-issuer-key"})
+	assert.Equal(t, "some-issuer-key", named.Key)
+
+	_, err = issuer.Issue(identity.IssueRequest{Key: "some-issuer-key"})
+	assert.Equal(t, identity.ErrKeyInUse, errors.Cause(err))
+
+	// invalid requests are rejected
+	_, err = issuer.Issue(identity.IssueRequest{Method: "none"})
+	assert.NotNil(t, err)
+}
+
+func testRevoker(t *testing.T, factory Factory) {
+	store, issuer := issuer(t, factory)
+
+	revoker, ok := store.(identity.Revoker)
+	if !ok {
+		t.Skip("store does not implement identity.Revoker")
+	}
+
+	revoked := issue(t, issuer, identity.IssueRequest{})
+	kept := issue(t, issuer, identity.IssueRequest{})
+	require.Nil(t, revoker.Revoke(revoked.Key))
+
+	// revoked identities disappear
+	_, ok, err := store.Fetch(revoked.Key)
+	require.Nil(t, err)
+	assert.False(t, ok)
+
+	// other identities are unaffected
+	_, ok, err = store.Fetch(kept.Key)
+	require.Nil(t, err)
+	assert.True(t, ok)
+
+	// revoking a missing identity is not an error
+	assert.Nil(t, revoker.Revoke(revoked.Key))
+	assert.Nil(t, revoker.Revoke("missing-key"))
+}
+
+func testLister(t *testing.T, factory Factory) {
+	store, issuer := issuer(t, factory)
+
+	lister, ok := store.(identity.Lister)
+	if !ok {
+		t.Skip("store does not implement identity.Lister")
+	}
+
+	page, err := lister.List(identity.ListOptions{})
+	require.Nil(t, err)
+	assert.Empty(t, page.Identities)
+	assert.Empty(t, page.Next)
+
+	var hs512 string
+	for _, method := range []string{"HS256", "HS256", "HS512"} {
+		id := issue(t, issuer, identity.IssueRequest{Method: method, Scopes: []string{"scope." + method}})
+		if method == "HS512" {
+			hs512 = id.Key
+		}
+	}
+
+	all, err := identity.ListAll(lister, identity.ListOptions{})
+	require.Nil(t, err)
+	require.Len(t, all, 3)
+	for i := 1; i < len(all); i++ {
+		assert.True(t, all[i-1].Key < all[i].Key, "identities are ordered by key")
+	}
+
+	page, err = lister.List(identity.ListOptions{Limit: 2})
+	require.Nil(t, err)
+	assert.Equal(t, all[:2], page.Identities)
+	require.NotEmpty(t, page.Next)
+
+	page, err = lister.List(identity.ListOptions{Limit: 2, Cursor: page.Next})
+	require.Nil(t, err)
+	assert.Equal(t, all[2:], page.Identities)
+	assert.Empty(t, page.Next)
+
+	filtered, err := identity.ListAll(lister, identity.ListOptions{Method: "HS512"})
+	require.Nil(t, err)
+	require.Len(t, filtered, 1)
+	assert.Equal(t, hs512, filtered[0].Key)
+
+	filtered, err = identity.ListAll(lister, identity.ListOptions{Scope: "scope.HS256"})
+	require.Nil(t, err)
+	assert.Len(t, filtered, 2)
+
+	_, err = lister.List(identity.ListOptions{Cursor: "not a cursor"})
+	assert.Equal(t, identity.ErrInvalidCursor, errors.Cause(err))
+}
+
+func testUpdater(t *testing.T, factory Factory) {
+	store, issuer := issuer(t, factory)
+
+	updater, ok := store.(identity.Updater)
+	if !ok {
+		t.Skip("store does not implement identity.Updater")
+	}
+
+	issued := issue(t, issuer, identity.IssueRequest{Scopes: []string{"resource.action"}})
+
+	updated, ok, err := updater.Update(issued.Key, identity.AddScopes("other.action"))
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.Equal(t, []string{"resource.action", "other.action"}, updated.Scopes)
+
+	fetched, _, err := store.Fetch(issued.Key)
+	require.Nil(t, err)
+	assert.Equal(t, updated.Scopes, fetched.Scopes)
+	assert.Equal(t, issued.Secret, fetched.Secret)
+
+	// failed updates are not applied
+	failure := errors.New("update failed")
+	_, _, err = updater.Update(issued.Key, identity.Updates(identity.SetScopes(), func(*identity.Identity) error {
+		return failure
+	}))
+	assert.Equal(t, failure, errors.Cause(err))
+
+	_, _, err = updater.Update(issued.Key, func(id *identity.Identity) error {
+		id.Key = "other-key"
+		return nil
+	})
+	assert.Equal(t, identity.ErrKeyChanged, errors.Cause(err))
+
+	fetched, _, err = store.Fetch(issued.Key)
+	require.Nil(t, err)
+	assert.Equal(t, updated.Scopes, fetched.Scopes)
+
+	_, ok, err = store.Fetch("other-key")
+	require.Nil(t, err)
+	assert.False(t, ok)
+
+	// missing identities are not an error
+	_, ok, err = updater.Update("missing-key", identity.SetScopes())
+	require.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func testRotator(t *testing.T, factory Factory) {
+	store, issuer := issuer(t, factory)
+
+	rotator, ok := store.(identity.Rotator)
+	if !ok {
+		t.Skip("store does not implement identity.Rotator")
+	}
+
+	issued := issue(t, issuer, identity.IssueRequest{})
+
+	rotated, ok, err := rotator.Rotate(issued.Key, time.Hour)
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.NotEqual(t, issued.Secret, rotated.Secret)
+	require.NotNil(t, rotated.Retired)
+	assert.Equal(t, issued.Secret, rotated.Retired.Secret)
+
+	fetched, _, err := store.Fetch(issued.Key)
+	require.Nil(t, err)
+	assert.Equal(t, rotated.Secret, fetched.Secret)
+	require.NotNil(t, fetched.Retired)
+	assert.Equal(t, issued.Secret, fetched.Retired.Secret)
+
+	// without a grace period the previous secret is discarded
+	rotated, _, err = rotator.Rotate(issued.Key, 0)
+	require.Nil(t, err)
+	assert.Nil(t, rotated.Retired)
+
+	fetched, _, err = store.Fetch(issued.Key)
+	require.Nil(t, err)
+	assert.Equal(t, rotated.Secret, fetched.Secret)
+	assert.Nil(t, fetched.Retired)
+
+	_, ok, err = rotator.Rotate("missing-key", 0)
+	require.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func testPutter(t *testing.T, factory Factory) {
+	store := factory(t)
+
+	putter, ok := store.(identity.Putter)
+	if !ok {
+		t.Skip("store does not implement identity.Putter")
+	}
+
+	id := identity.Identity{
+		Key:       "put-key",
+		Secret:    []byte("this is super secret"),
+		Scopes:    []string{"resource.action"},
+		Method:    crypto.SigningMethodHS256,
+		CreatedAt: time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC),
+	}
+
+	// put identities keep their key and secret
+	require.Nil(t, putter.Put(id))
+
+	found, ok, err := store.Fetch(id.Key)
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.Equal(t, id, found)
+
+	// putting an existing key replaces the identity
+	id.Secret = []byte("this is another secret")
+	id.Scopes = []string{"resource.other"}
+	require.Nil(t, putter.Put(id))
+
+	found, ok, err = store.Fetch(id.Key)
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.Equal(t, id, found)
+}
+
+func testIsolation(t *testing.T, factory Factory) {
+	store, issuer := issuer(t, factory)
+
+	issued := issue(t, issuer, identity.IssueRequest{Scopes: []string{"resource.action", "other.action"}})
+
+	// mutating a returned identity does not modify the stored identity
+	issued.Scopes[0] = "admin"
+
+	fetched, _, err := store.Fetch(issued.Key)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"resource.action", "other.action"}, fetched.Scopes)
+
+	fetched.Scopes[0] = "admin"
+	fetched.Secret[0]++
+
+	again, _, err := store.Fetch(issued.Key)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"resource.action", "other.action"}, again.Scopes)
+	assert.NotEqual(t, fetched.Secret, again.Secret)
+
+	updater, ok := store.(identity.Updater)
+	if !ok {
+		return
+	}
+
+	// failed updates leave the stored identity unchanged, even when they changed it in place
+	failure := errors.New("update failed")
+	_, _, err = updater.Update(issued.Key, func(id *identity.Identity) error {
+		id.Scopes[0] = "admin"
+		return failure
+	})
+	assert.Equal(t, failure, errors.Cause(err))
+
+	// updates do not modify identities returned before them
+	updated, _, err := updater.Update(issued.Key, identity.Updates(identity.RemoveScopes("other.action"), identity.AddScopes("third.action")))
+	require.Nil(t, err)
+	assert.Equal(t, []string{"resource.action", "third.action"}, updated.Scopes)
+	assert.Equal(t, []string{"resource.action", "other.action"}, again.Scopes)
+
+	updated.Scopes[0] = "admin"
+
+	fetched, _, err = store.Fetch(issued.Key)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"resource.action", "third.action"}, fetched.Scopes)
+}
+
+func testConcurrency(t *testing.T, factory Factory) {
+	store, issuer := issuer(t, factory)
+
+	const workers, iterations = 8, 10
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < iterations; i++ {
+				id, err := issuer.Issue(identity.IssueRequest{Scopes: []string{"resource.action"}})
+				if !assert.Nil(t, err) {
+					return
+				}
+
+				fetched, ok, err := store.Fetch(id.Key)
+				assert.Nil(t, err)
+				assert.True(t, ok)
+				assert.Equal(t, id.Secret, fetched.Secret)
+
+				if updater, ok := store.(identity.Updater); ok {
+					_, _, err := updater.Update(id.Key, identity.AddScopes("other.action"))
+					assert.Nil(t, err)
+
+					// updates which change the identity in place must not race with
+					// reads of identities returned earlier
+					current, _, err := store.Fetch(id.Key)
+					assert.Nil(t, err)
+
+					done := make(chan struct{})
+					go func() {
+						defer close(done)
+						for _, scope := range current.Scopes {
+							_ = scope
+						}
+					}()
+
+					_, _, err = updater.Update(id.Key, func(id *identity.Identity) error {
+						id.Scopes[0] = "resource.action"
+						return nil
+					})
+					assert.Nil(t, err)
+					<-done
+				}
+
+				if lister, ok := store.(identity.Lister); ok {
+					_, err := lister.List(identity.ListOptions{Limit: 5})
+					assert.Nil(t, err)
+				}
+
+				if revoker, ok := store.(identity.Revoker); ok && i%2 == 0 {
+					assert.Nil(t, revoker.Revoke(id.Key))
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if lister, ok := store.(identity.Lister); ok {
+		remaining := workers * iterations
+		if _, ok := store.(identity.Revoker); ok {
+			remaining /= 2
+		}
+
+		all, err := identity.ListAll(lister, identity.ListOptions{})
+		require.Nil(t, err)
+		assert.Len(t, all, remaining)
+	}
+}
@@ -0,0 +1,17 @@
+package storagetest
+
+import (
+	"testing"
+
+	"github.com/georgemac/hola/lib/identity"
+)
+
+// Test_Run_FetcherOnly verifies stores which only implement identity.Fetcher
+// are exercised without the suites which require them to issue identities.
+func Test_Run_FetcherOnly(t *testing.T) {
+	Run(t, func(*testing.T) identity.Fetcher {
+		return identity.FetcherFunc(func(string) (identity.Identity, bool, error) {
+			return identity.Identity{}, false, nil
+		})
+	})
+}
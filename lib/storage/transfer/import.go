@@ -0,0 +1,209 @@
+package transfer
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrUnknownConflictPolicy is returned when a conflict policy is not supported.
+	ErrUnknownConflictPolicy = errors.New("unknown conflict policy")
+
+	// ErrConflict is returned by Import, under the Fail conflict policy, when
+	// identities in the archive already exist with different attributes.
+	ErrConflict = errors.New("identities conflict")
+)
+
+// Store is a storage backend identities can be imported in to.
+// Imported identities keep their keys and secrets, so they are stored with
+// an identity.Putter rather than issued with an identity.Issuer.
+type Store interface {
+	identity.Fetcher
+	identity.Putter
+}
+
+// ConflictPolicy decides how Import treats an identity which already
+// exists in the store with different attributes.
+type ConflictPolicy string
+
+// Conflict policies supported by Import.
+const (
+	// Skip leaves the existing identity in place
+	Skip ConflictPolicy = "skip"
+	// Overwrite replaces the existing identity with the imported identity
+	Overwrite ConflictPolicy = "overwrite"
+	// Fail aborts the import before any identity is stored
+	Fail ConflictPolicy = "fail"
+)
+
+// ParseConflictPolicy returns the ConflictPolicy with the given name.
+func ParseConflictPolicy(name string) (ConflictPolicy, error) {
+	switch policy := ConflictPolicy(name); policy {
+	case Skip, Overwrite, Fail:
+		return policy, nil
+	}
+
+	return "", errors.Wrapf(ErrUnknownConflictPolicy, "found %q", name)
+}
+
+// Action is what Import does with an identity from an archive.
+type Action string
+
+// Actions reported by Import.
+const (
+	// Create stores an identity which does not exist
+	Create Action = "create"
+	// Update replaces an existing identity which differs
+	Update Action = "update"
+	// Unchanged leaves an existing identity which is identical
+	Unchanged Action = "unchanged"
+	// Conflict leaves an existing identity which differs, as configured by the conflict policy
+	Conflict Action = "conflict"
+)
+
+// Change describes the action taken for a single identity. Fields names
+// the attributes of an existing identity which differ from the archive.
+type Change struct {
+	Key    string   `json:"key"`
+	Action Action   `json:"action"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+// Report describes the changes made, or that would be made during a dry run, by Import.
+type Report struct {
+	DryRun  bool     `json:"dry_run"`
+	Changes []Change `json:"changes"`
+}
+
+// Count returns the number of changes with the action.
+func (r Report) Count(action Action) (count int) {
+	for _, change := range r.Changes {
+		if change.Action == action {
+			count++
+		}
+	}
+
+	return
+}
+
+// Import stores the identities in the archive, which are compared with those already
+// in the store first. New identities are created and identical identities left alone.
+// Identities which differ are handled according to the conflict policy; under the
+// default Fail policy nothing is stored and ErrConflict is returned along with the report.
+// With WithDryRun the report is produced without anything being stored.
+func Import(store Store, a Archive, opts ...Option) (Report, error) {
+	o := newOptions(opts)
+	if _, err := ParseConflictPolicy(string(o.conflict)); err != nil {
+		return Report{}, err
+	}
+
+	var (
+		report    = Report{DryRun: o.dryRun, Changes: make([]Change, 0, len(a.Identities))}
+		conflicts []string
+	)
+
+	for _, id := range a.Identities {
+		existing, ok, err := store.Fetch(id.Key)
+		if err != nil {
+			return report, errors.Wrapf(err, "fetching identity %q", id.Key)
+		}
+
+		change := Change{Key: id.Key, Action: Create}
+		if ok {
+			change.Fields = Diff(existing, id)
+
+			switch {
+			case len(change.Fields) == 0:
+				change.Action = Unchanged
+			case o.conflict == Overwrite:
+				change.Action = Update
+			default:
+				change.Action = Conflict
+				conflicts = append(conflicts, id.Key)
+			}
+		}
+
+		report.Changes = append(report.Changes, change)
+	}
+
+	if o.conflict == Fail && len(conflicts) > 0 {
+		return report, errors.Wrapf(ErrConflict, "keys %s", strings.Join(conflicts, ", "))
+	}
+
+	if o.dryRun {
+		return report, nil
+	}
+
+	for i, change := range report.Changes {
+		if change.Action != Create && change.Action != Update {
+			continue
+		}
+
+		if err := store.Put(a.Identities[i]); err != nil {
+			return report, errors.Wrapf(err, "storing identity %q", change.Key)
+		}
+	}
+
+	return report, nil
+}
+
+// Diff returns the names of the attributes which differ between identities a and b,
+// in the order they are written to archives.
+func Diff(a, b identity.Identity) (fields []string) {
+	check := func(field string, equal bool) {
+		if !equal {
+			fields = append(fields, field)
+		}
+	}
+
+	check("key", a.Key == b.Key)
+	check("secret", bytes.Equal(a.Secret, b.Secret))
+	check("scopes", equalStrings(a.Scopes, b.Scopes))
+	check("signing_method", alg(a) == alg(b))
+	check("policy", a.Policy.MaxLifetime == b.Policy.MaxLifetime &&
+		equalStrings(a.Policy.Audiences, b.Policy.Audiences) &&
+		equalStrings(a.Policy.Subjects, b.Policy.Subjects) &&
+		equalStrings(a.Policy.RequiredClaims, b.Policy.RequiredClaims))
+	check("created_at", a.CreatedAt.Equal(b.CreatedAt))
+	check("expires_at", a.ExpiresAt.Equal(b.ExpiresAt))
+	check("disabled", a.Disabled == b.Disabled)
+	check("owner", a.Owner == b.Owner)
+	check("description", a.Description == b.Description)
+	check("retired_secret", equalRetired(a.Retired, b.Retired))
+
+	return
+}
+
+func alg(id identity.Identity) string {
+	if id.Method == nil {
+		return ""
+	}
+
+	return id.Method.Alg()
+}
+
+// equalStrings compares slices element wise, treating nil and empty slices as equal
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func equalRetired(a, b *identity.RetiredSecret) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return bytes.Equal(a.Secret, b.Secret) && a.ExpiresAt.Equal(b.ExpiresAt)
+}
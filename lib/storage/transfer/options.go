@@ -0,0 +1,53 @@
+package transfer
+
+import "github.com/georgemac/hola/lib/secrets"
+
+// Option is a function which configures how archives are written, read or imported
+type Option func(*options)
+
+type options struct {
+	format   Format
+	keys     secrets.KeyProvider
+	conflict ConflictPolicy
+	dryRun   bool
+}
+
+func newOptions(opts []Option) options {
+	o := options{format: YAML, conflict: Fail}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// WithFormat sets the format archives are written and read in, which defaults to YAML.
+func WithFormat(format Format) Option {
+	return func(o *options) {
+		o.format = format
+	}
+}
+
+// WithKeyProvider encrypts secrets as archives are written, and decrypts them as
+// they are read, using the key provider. The key provider is unrelated to any used
+// by the exporting or importing storage, so archives can be handed between them.
+func WithKeyProvider(keys secrets.KeyProvider) Option {
+	return func(o *options) {
+		o.keys = keys
+	}
+}
+
+// WithConflictPolicy sets how Import treats identities which already exist
+// with different attributes, which defaults to Fail.
+func WithConflictPolicy(policy ConflictPolicy) Option {
+	return func(o *options) {
+		o.conflict = policy
+	}
+}
+
+// WithDryRun reports the changes Import would make without making them.
+func WithDryRun() Option {
+	return func(o *options) {
+		o.dryRun = true
+	}
+}
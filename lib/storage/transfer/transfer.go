@@ -0,0 +1,201 @@
+// Package transfer exports identities from one storage backend in to a portable,
+// versioned archive and imports archives in to another backend, so identities can
+// be moved between backends without their keys or secrets changing.
+package transfer
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/georgemac/hola/lib/secrets"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Version is the version of the archive format written by Write.
+const Version = 1
+
+var (
+	// ErrUnknownFormat is returned when an archive format is not supported.
+	ErrUnknownFormat = errors.New("unknown archive format")
+
+	// ErrUnsupportedVersion is returned when reading an archive with a version other than Version.
+	ErrUnsupportedVersion = errors.New("unsupported archive version")
+
+	// ErrMalformedArchive is returned when an archive cannot be read.
+	ErrMalformedArchive = errors.New("malformed archive")
+
+	// ErrKeyProviderMissing is returned when reading an archive containing
+	// encrypted secrets without a key provider.
+	ErrKeyProviderMissing = errors.New("key provider required for encrypted secrets")
+)
+
+var now = time.Now
+
+// Format is an encoding of an archive.
+type Format string
+
+// Formats in which archives can be written and read.
+const (
+	YAML Format = "yaml"
+	JSON Format = "json"
+)
+
+// ParseFormat returns the Format with the given name.
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(name); format {
+	case YAML, JSON:
+		return format, nil
+	}
+
+	return "", errors.Wrapf(ErrUnknownFormat, "found %q", name)
+}
+
+// Archive is a set of identities exported from a storage backend, ordered by key.
+type Archive struct {
+	ExportedAt time.Time
+	Identities []identity.Identity
+}
+
+// Export returns an Archive containing every identity listed by the Lister.
+func Export(l identity.Lister) (Archive, error) {
+	identities, err := identity.ListAll(l, identity.ListOptions{})
+	if err != nil {
+		return Archive{}, errors.Wrap(err, "exporting identities")
+	}
+
+	sort.Slice(identities, func(i, j int) bool { return identities[i].Key < identities[j].Key })
+
+	return Archive{ExportedAt: now().UTC().Truncate(time.Second), Identities: identities}, nil
+}
+
+// archive is the encoded representation of an Archive. Identities are written
+// in the format of identity.Identity, as identity.Stored so that encrypted
+// secrets are written in their encrypted form.
+type archive struct {
+	Version    int               `yaml:"version" json:"version"`
+	ExportedAt time.Time         `yaml:"exported_at" json:"exported_at"`
+	Identities []identity.Stored `yaml:"identities" json:"identities"`
+}
+
+// untrustedArchive is an archive as it is read. Identities are decoded as
+// identity.Sealed, so secrets referencing the environment or files are rejected
+// and encrypted secrets are kept to be decrypted.
+type untrustedArchive struct {
+	Version    int               `yaml:"version" json:"version"`
+	ExportedAt time.Time         `yaml:"exported_at" json:"exported_at"`
+	Identities []identity.Sealed `yaml:"identities" json:"identities"`
+}
+
+// Write encodes the archive to w. Secrets are written in plaintext
+// unless a key provider is configured with WithKeyProvider.
+func Write(w io.Writer, a Archive, opts ...Option) error {
+	o := newOptions(opts)
+
+	encoded := archive{Version: Version, ExportedAt: a.ExportedAt, Identities: make([]identity.Stored, 0, len(a.Identities))}
+	for _, id := range a.Identities {
+		stored, err := encrypt(id, o.keys)
+		if err != nil {
+			return errors.Wrapf(err, "writing identity %q", id.Key)
+		}
+
+		encoded.Identities = append(encoded.Identities, stored)
+	}
+
+	switch o.format {
+	case YAML:
+		data, err := yaml.Marshal(encoded)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(data)
+		return err
+	case JSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(encoded)
+	}
+
+	return errors.Wrapf(ErrUnknownFormat, "found %q", o.format)
+}
+
+// Read decodes an archive from r. Encrypted secrets are decrypted using
+// the key provider configured with WithKeyProvider.
+func Read(r io.Reader, opts ...Option) (Archive, error) {
+	o := newOptions(opts)
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Archive{}, err
+	}
+
+	var encoded untrustedArchive
+	switch o.format {
+	case YAML:
+		err = yaml.UnmarshalStrict(data, &encoded)
+	case JSON:
+		err = json.Unmarshal(data, &encoded)
+	default:
+		return Archive{}, errors.Wrapf(ErrUnknownFormat, "found %q", o.format)
+	}
+
+	if identity.IsMalformed(err) {
+		return Archive{}, errors.Wrap(err, "reading identity")
+	} else if err != nil {
+		return Archive{}, errors.Wrap(ErrMalformedArchive, err.Error())
+	}
+
+	if encoded.Version != Version {
+		return Archive{}, errors.Wrapf(ErrUnsupportedVersion, "found %d expected %d", encoded.Version, Version)
+	}
+
+	var (
+		a    = Archive{ExportedAt: encoded.ExportedAt, Identities: make([]identity.Identity, 0, len(encoded.Identities))}
+		seen = map[string]bool{}
+	)
+
+	for _, sealed := range encoded.Identities {
+		if sealed.Key == "" {
+			return Archive{}, errors.Wrap(ErrMalformedArchive, "identity without a key")
+		}
+
+		if seen[sealed.Key] {
+			return Archive{}, errors.Wrapf(ErrMalformedArchive, "identity %q appears more than once", sealed.Key)
+		}
+
+		seen[sealed.Key] = true
+
+		id, err := decrypt(sealed, o.keys)
+		if err != nil {
+			return Archive{}, errors.Wrapf(err, "reading identity %q", sealed.Key)
+		}
+
+		a.Identities = append(a.Identities, id)
+	}
+
+	return a, nil
+}
+
+// encrypt returns the identity to write, with its secrets encrypted when keys is not nil
+func encrypt(id identity.Identity, keys secrets.KeyProvider) (identity.Stored, error) {
+	if keys == nil {
+		return identity.Stored{Identity: id}, nil
+	}
+
+	return identity.Seal(id, keys)
+}
+
+// decrypt returns the identity with its encrypted secrets decrypted. Identities
+// with encrypted secrets require a key provider.
+func decrypt(sealed identity.Sealed, keys secrets.KeyProvider) (identity.Identity, error) {
+	if keys == nil && (secrets.IsEncrypted(sealed.Secret) || sealed.Retired != nil && secrets.IsEncrypted(sealed.Retired.Secret)) {
+		return identity.Identity{}, ErrKeyProviderMissing
+	}
+
+	return sealed.Open(keys)
+}
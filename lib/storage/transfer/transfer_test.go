@@ -0,0 +1,264 @@
+package transfer
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/georgemac/hola/lib/secrets"
+	"github.com/georgemac/hola/lib/storage/memory"
+	"github.com/georgemac/hola/lib/storage/yaml"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/jose.v1/crypto"
+)
+
+func init() {
+	now = func() time.Time { return time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC) }
+}
+
+var (
+	first = identity.Identity{
+		Key:       "first",
+		Secret:    []byte("first secret"),
+		Scopes:    []string{"resource.action"},
+		Method:    crypto.SigningMethodHS256,
+		Policy:    identity.Policy{MaxLifetime: time.Hour, Audiences: []string{"api.example.com"}},
+		CreatedAt: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+		Owner:     "platform",
+		Retired: &identity.RetiredSecret{
+			Secret:    []byte{0, 1, 2, 3},
+			ExpiresAt: time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	second = identity.Identity{
+		Key:         "second",
+		Secret:      []byte("env:looks like a reference"),
+		Method:      crypto.SigningMethodHS512,
+		ExpiresAt:   time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		Disabled:    true,
+		Description: "a disabled identity",
+	}
+)
+
+func masterKey(t *testing.T) secrets.MasterKey {
+	key, err := secrets.NewMasterKey(bytes.Repeat([]byte{1}, 32))
+	require.Nil(t, err)
+	return key
+}
+
+func Test_Export_RoundTrip(t *testing.T) {
+	source := memory.NewStorage(memory.WithIdentities(second, first))
+
+	archive, err := Export(source)
+	require.Nil(t, err)
+	assert.Equal(t, now(), archive.ExportedAt)
+	assert.Equal(t, []identity.Identity{first, second}, archive.Identities)
+
+	for _, testCase := range []struct {
+		name      string
+		opts      []Option
+		encrypted bool
+	}{
+		{name: "yaml"},
+		{name: "json", opts: []Option{WithFormat(JSON)}},
+		{name: "encrypted yaml", opts: []Option{WithKeyProvider(masterKey(t))}, encrypted: true},
+		{name: "encrypted json", opts: []Option{WithFormat(JSON), WithKeyProvider(masterKey(t))}, encrypted: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.Nil(t, Write(&buf, archive, testCase.opts...))
+
+			assert.Equal(t, testCase.encrypted, strings.Contains(buf.String(), "secret: enc:") ||
+				strings.Contains(buf.String(), `"secret": "enc:`))
+			assert.Equal(t, !testCase.encrypted, strings.Contains(buf.String(), "first secret"))
+
+			read, err := Read(&buf, testCase.opts...)
+			require.Nil(t, err)
+			assert.Equal(t, archive, read)
+		})
+	}
+}
+
+func Test_Write_IdentityFormat(t *testing.T) {
+	var buf bytes.Buffer
+	require.Nil(t, Write(&buf, Archive{ExportedAt: now(), Identities: []identity.Identity{first}}, WithFormat(JSON)))
+
+	var encoded struct {
+		Identities []json.RawMessage `json:"identities"`
+	}
+
+	require.Nil(t, json.Unmarshal(buf.Bytes(), &encoded))
+	require.Len(t, encoded.Identities, 1)
+
+	// identities are written as identity.Identity marshals them
+	expected, err := json.Marshal(first)
+	require.Nil(t, err)
+	assert.JSONEq(t, string(expected), string(encoded.Identities[0]))
+
+	var policy struct {
+		Policy struct {
+			MaxLifetime string `json:"max_lifetime"`
+		} `json:"policy"`
+	}
+
+	require.Nil(t, json.Unmarshal(encoded.Identities[0], &policy))
+	assert.Equal(t, "1h0m0s", policy.Policy.MaxLifetime)
+}
+
+func Test_Read_Errors(t *testing.T) {
+	encrypted := func() string {
+		var buf bytes.Buffer
+		require.Nil(t, Write(&buf, Archive{Identities: []identity.Identity{first}}, WithKeyProvider(masterKey(t))))
+		return buf.String()
+	}()
+
+	for _, testCase := range []struct {
+		name  string
+		input string
+		opts  []Option
+		err   error
+	}{
+		{name: "malformed", input: "version: [", err: ErrMalformedArchive},
+		{name: "unknown field", input: "version: 1\nunknown: true", err: ErrMalformedArchive},
+		{name: "missing version", input: "identities: []", err: ErrUnsupportedVersion},
+		{name: "future version", input: "version: 2", err: ErrUnsupportedVersion},
+		{name: "unknown format", input: "version: 1", opts: []Option{WithFormat("toml")}, err: ErrUnknownFormat},
+		{
+			name:  "missing key",
+			input: "version: 1\nidentities:\n- secret: s\n  signing_method: HS256",
+			err:   ErrMalformedArchive,
+		},
+		{
+			name:  "duplicate key",
+			input: "version: 1\nidentities:\n- {key: a, secret: s, signing_method: HS256}\n- {key: a, secret: s, signing_method: HS256}",
+			err:   ErrMalformedArchive,
+		},
+		{
+			name:  "unsupported method",
+			input: "version: 1\nidentities:\n- {key: a, secret: s, signing_method: RS256}",
+			err:   identity.ErrMalformedIdentity,
+		},
+		{name: "encrypted without key provider", input: encrypted, err: ErrKeyProviderMissing},
+		{
+			name:  "environment reference",
+			input: "version: 1\nidentities:\n- {key: a, secret: \"env:HOME\", signing_method: HS256}",
+			err:   secrets.ErrReferenceNotAllowed,
+		},
+		{
+			name:  "file reference",
+			input: "version: 1\nidentities:\n- {key: a, secret: \"file:/etc/passwd\", signing_method: HS256}",
+			err:   secrets.ErrReferenceNotAllowed,
+		},
+		{
+			name:  "retired file reference",
+			input: "version: 1\nidentities:\n- {key: a, secret: s, signing_method: HS256, retired_secret: {secret: \"file:/etc/passwd\", expires_at: 2017-01-02T00:00:00Z}}",
+			err:   secrets.ErrReferenceNotAllowed,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := Read(strings.NewReader(testCase.input), testCase.opts...)
+			assert.Equal(t, testCase.err, errors.Cause(err))
+		})
+	}
+}
+
+func Test_Import(t *testing.T) {
+	changed := first
+	changed.Scopes = []string{"resource.other"}
+	changed.Owner = "security"
+
+	archive := Archive{Identities: []identity.Identity{changed, second}}
+
+	for _, testCase := range []struct {
+		name    string
+		opts    []Option
+		changes []Change
+		stored  []identity.Identity
+		err     error
+	}{
+		{
+			name: "fail on conflict",
+			changes: []Change{
+				{Key: "first", Action: Conflict, Fields: []string{"scopes", "owner"}},
+				{Key: "second", Action: Create},
+			},
+			stored: []identity.Identity{first},
+			err:    ErrConflict,
+		},
+		{
+			name: "skip conflicts",
+			opts: []Option{WithConflictPolicy(Skip)},
+			changes: []Change{
+				{Key: "first", Action: Conflict, Fields: []string{"scopes", "owner"}},
+				{Key: "second", Action: Create},
+			},
+			stored: []identity.Identity{first, second},
+		},
+		{
+			name: "overwrite conflicts",
+			opts: []Option{WithConflictPolicy(Overwrite)},
+			changes: []Change{
+				{Key: "first", Action: Update, Fields: []string{"scopes", "owner"}},
+				{Key: "second", Action: Create},
+			},
+			stored: []identity.Identity{changed, second},
+		},
+		{
+			name: "dry run",
+			opts: []Option{WithConflictPolicy(Overwrite), WithDryRun()},
+			changes: []Change{
+				{Key: "first", Action: Update, Fields: []string{"scopes", "owner"}},
+				{Key: "second", Action: Create},
+			},
+			stored: []identity.Identity{first},
+		},
+		{
+			name:   "unknown conflict policy",
+			opts:   []Option{WithConflictPolicy("merge")},
+			stored: []identity.Identity{first},
+			err:    ErrUnknownConflictPolicy,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			store := memory.NewStorage(memory.WithIdentities(first))
+
+			report, err := Import(store, archive, testCase.opts...)
+			assert.Equal(t, testCase.err, errors.Cause(err))
+			assert.Equal(t, testCase.changes, report.Changes)
+
+			stored, err := identity.ListAll(store, identity.ListOptions{})
+			require.Nil(t, err)
+			assert.Equal(t, testCase.stored, stored)
+		})
+	}
+}
+
+func Test_Import_Unchanged(t *testing.T) {
+	source := memory.NewStorage(memory.WithIdentities(first, second))
+	archive, err := Export(source)
+	require.Nil(t, err)
+
+	// identities move between backends without changing
+	target := yaml.NewStorage()
+	report, err := Import(target, archive)
+	require.Nil(t, err)
+	assert.Equal(t, 2, report.Count(Create))
+
+	report, err = Import(target, archive)
+	require.Nil(t, err)
+	assert.Equal(t, 2, report.Count(Unchanged))
+	assert.Equal(t, 0, report.Count(Create))
+
+	for _, id := range archive.Identities {
+		stored, ok, err := target.Fetch(id.Key)
+		require.Nil(t, err)
+		require.True(t, ok)
+		assert.Empty(t, Diff(id, stored))
+	}
+}
@@ -0,0 +1,25 @@
+package yaml
+
+import (
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/georgemac/hola/lib/secrets"
+)
+
+// Option is a function which manipulates the state of a Storage
+type Option func(*Storage)
+
+// WithKeyProvider decrypts secrets stored in the secrets envelope format
+// using the provided KeyProvider, as identities are loaded.
+func WithKeyProvider(provider secrets.KeyProvider) Option {
+	return func(s *Storage) {
+		s.keys = provider
+	}
+}
+
+// WithIssuePolicy validates requests to issue identities, and the scopes and
+// signing methods granted by updates, against the policy.
+func WithIssuePolicy(policy identity.IssuePolicy) Option {
+	return func(s *Storage) {
+		s.policy = policy
+	}
+}
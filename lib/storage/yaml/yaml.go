@@ -3,42 +3,309 @@ package yaml
 import (
 	"io"
 	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/georgemac/hola/lib/identity"
+	"github.com/georgemac/hola/lib/secrets"
+	"github.com/pkg/errors"
 	yaml "gopkg.in/yaml.v2"
 )
 
+// validate at compile time that Storage implements the identity storage interfaces.
+var (
+	_ identity.Fetcher = (*Storage)(nil)
+	_ identity.Issuer  = (*Storage)(nil)
+	_ identity.Revoker = (*Storage)(nil)
+	_ identity.Lister  = (*Storage)(nil)
+	_ identity.Updater = (*Storage)(nil)
+	_ identity.Rotator = (*Storage)(nil)
+	_ identity.Putter  = (*Storage)(nil)
+)
+
+var now = time.Now
+
+// ErrNoKeyProvider is returned when an encrypted secret is loaded without a KeyProvider configured.
+var ErrNoKeyProvider = errors.New("encrypted secret found but no key provider configured")
+
+// Storage holds identities in memory, which are read and written as YAML.
+// The zero value is an empty Storage ready to use.
 type Storage struct {
-	Identities map[string]identity.Identity
-	identities []identity.Identity
+	mu         sync.RWMutex
+	identities map[string]identity.Identity
+	keys       secrets.KeyProvider
+	policy     identity.IssuePolicy
+
+	// encoded maps the key of each identity to the form its secrets are written in,
+	// keyed by secret. Entries only exist for the secrets an identity holds, so a
+	// replaced secret is never written in the form of the secret it replaced.
+	encoded map[string]map[string]string
 }
 
-func NewStorage() *Storage {
-	return &Storage{Identities: map[string]identity.Identity{}}
+func NewStorage(opts ...Option) *Storage {
+	s := &Storage{}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
 func (s *Storage) UnmarshalYAML(unmarshal func(interface{}) error) error {
-	if err := unmarshal(&s.identities); err != nil {
+	var identities identity.Entries
+	if err := unmarshal(&identities); err != nil {
 		return err
 	}
 
-	for _, id := range s.identities {
-		s.Identities[id.Key] = id
+	return s.Load(identities)
+}
+
+// Load stores the identities, replacing any existing identities with the same keys.
+// Secrets in the secrets envelope format are decrypted using the KeyProvider,
+// so identities decoded from any format can be loaded as they are read.
+// Encoded secrets are retained, and written in place of the secrets they encode
+// until they are replaced.
+func (s *Storage) Load(identities []identity.Stored) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stored := range identities {
+		id, encoded := stored.Identity, map[string]string{}
+
+		secret, err := s.decrypt(id.Secret)
+		if err != nil {
+			return errors.Wrapf(err, "identity %q", id.Key)
+		}
+
+		id.Secret = secret
+		if stored.EncodedSecret != "" {
+			encoded[string(secret)] = stored.EncodedSecret
+		}
+
+		if id.Retired != nil {
+			retired := *id.Retired
+			if retired.Secret, err = s.decrypt(retired.Secret); err != nil {
+				return errors.Wrapf(err, "identity %q retired secret", id.Key)
+			}
+
+			id.Retired = &retired
+			if stored.EncodedRetiredSecret != "" {
+				encoded[string(retired.Secret)] = stored.EncodedRetiredSecret
+			}
+		}
+
+		s.set(id, encoded)
 	}
 
 	return nil
 }
 
+// decrypt returns the secret decrypted when it is in the secrets envelope format,
+// otherwise the secret is returned as is
+func (s *Storage) decrypt(secret []byte) ([]byte, error) {
+	if !secrets.IsEncrypted(secret) {
+		return secret, nil
+	}
+
+	if s.keys == nil {
+		return nil, ErrNoKeyProvider
+	}
+
+	return secrets.Decrypt(s.keys, secret)
+}
+
 func (s *Storage) Fetch(key string) (id identity.Identity, ok bool, err error) {
-	id, ok = s.Identities[key]
-	return
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok = s.identities[key]
+	return id.Clone(), ok, nil
 }
 
-func (s *Storage) ReadFrom(r io.Reader) error {
-	data, err := ioutil.ReadAll(r)
+// Issue stores and returns a new identity generated for the request,
+// which is validated against the issue policy of the Storage.
+func (s *Storage) Issue(req identity.IssueRequest) (identity.Identity, error) {
+	id, err := identity.NewGenerator(s.policy).Issue(req)
+	if err != nil {
+		return identity.Identity{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.identities[id.Key]; ok {
+		return identity.Identity{}, errors.Wrapf(identity.ErrKeyInUse, "key %q", id.Key)
+	}
+
+	return id, s.put(id)
+}
+
+// List returns the page of identities described by opts.
+func (s *Storage) List(opts identity.ListOptions) (identity.Page, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	identities := make([]identity.Identity, 0, len(s.identities))
+	for _, id := range s.identities {
+		identities = append(identities, id.Clone())
+	}
+
+	return identity.Paginate(identities, opts)
+}
+
+// Update applies update to the identity for the key and stores the result.
+// Updates which grant a scope or signing method not permitted by the issue policy
+// are rejected. The stored identity is left unchanged when update returns an error.
+func (s *Storage) Update(key string, update func(*identity.Identity) error) (identity.Identity, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.identities[key]
+	if !ok {
+		return identity.Identity{}, false, nil
+	}
+
+	id := stored.Clone()
+	if err := update(&id); err != nil {
+		return identity.Identity{}, true, err
+	}
+
+	if id.Key != key {
+		return identity.Identity{}, true, errors.Wrapf(identity.ErrKeyChanged, "identity %q", key)
+	}
+
+	if err := s.policy.ValidateUpdate(stored, id); err != nil {
+		return identity.Identity{}, true, errors.Wrapf(err, "identity %q", key)
+	}
+
+	if err := s.put(id); err != nil {
+		return identity.Identity{}, true, err
+	}
+
+	return id, true, nil
+}
+
+// Rotate replaces the secret of the identity for the key with a secret generated
+// under the issue policy of the Storage, retaining the previous secret for
+// verification during the grace period.
+func (s *Storage) Rotate(key string, grace time.Duration) (identity.Identity, bool, error) {
+	rotate, err := identity.NewGenerator(s.policy).Rotation(grace, now())
+	if err != nil {
+		return identity.Identity{}, false, err
+	}
+
+	return s.Update(key, rotate)
+}
+
+// Put stores the identity, replacing any existing identity with the same key.
+// Secrets the identity already held keep the form they were loaded or stored in.
+// When the Storage has a KeyProvider any other secrets are encrypted,
+// so that they are stored encrypted at rest once saved.
+func (s *Storage) Put(id identity.Identity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.put(id)
+}
+
+// set stores the identity along with the encoded forms of its secrets,
+// creating the maps of a zero value Storage. It must be called with the mutex held.
+func (s *Storage) set(id identity.Identity, encoded map[string]string) {
+	if s.identities == nil {
+		s.identities = map[string]identity.Identity{}
+		s.encoded = map[string]map[string]string{}
+	}
+
+	s.identities[id.Key] = id
+	s.encoded[id.Key] = encoded
+}
+
+func (s *Storage) put(id identity.Identity) error {
+	previous, encoded := s.encoded[id.Key], map[string]string{}
+
+	held := [][]byte{id.Secret}
+	if id.Retired != nil {
+		held = append(held, id.Retired.Secret)
+	}
+
+	for _, secret := range held {
+		if value, ok := previous[string(secret)]; ok {
+			encoded[string(secret)] = value
+			continue
+		}
+
+		if s.keys != nil {
+			encrypted, err := secrets.Encrypt(s.keys, secret)
+			if err != nil {
+				return errors.Wrapf(err, "identity %q", id.Key)
+			}
+
+			encoded[string(secret)] = string(encrypted)
+		}
+	}
+
+	s.set(id.Clone(), encoded)
+	return nil
+}
+
+// Revoke removes the identity for the key, if present.
+func (s *Storage) Revoke(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.identities, key)
+	delete(s.encoded, key)
+	return nil
+}
+
+// MarshalYAML marshals the identities as a list ordered by key.
+func (s *Storage) MarshalYAML() (interface{}, error) {
+	return s.Snapshot(), nil
+}
+
+// Snapshot returns every identity ordered by key, along with the form its secrets
+// are stored in, so encrypted secrets and references are written as stored when
+// they are marshalled.
+func (s *Storage) Snapshot() []identity.Stored {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	identities := make([]identity.Stored, 0, len(s.identities))
+	for key, id := range s.identities {
+		stored := identity.Stored{Identity: id.Clone(), EncodedSecret: s.encoded[key][string(id.Secret)]}
+		if id.Retired != nil {
+			stored.EncodedRetiredSecret = s.encoded[key][string(id.Retired.Secret)]
+		}
+
+		identities = append(identities, stored)
+	}
+
+	sort.Slice(identities, func(i, j int) bool {
+		return identities[i].Key < identities[j].Key
+	})
+
+	return identities
+}
+
+// Save writes the identities to w in the format read by ReadFrom.
+func (s *Storage) Save(w io.Writer) error {
+	data, err := yaml.Marshal(s)
 	if err != nil {
 		return err
 	}
 
-	return yaml.Unmarshal(data, s)
+	_, err = w.Write(data)
+	return err
+}
+
+// ReadFrom reads identities from r in the format written by Save, implementing
+// io.ReaderFrom. It returns the number of bytes read.
+func (s *Storage) ReadFrom(r io.Reader) (int64, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return int64(len(data)), err
+	}
+
+	return int64(len(data)), yaml.Unmarshal(data, s)
 }
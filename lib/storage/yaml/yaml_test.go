@@ -0,0 +1,287 @@
+package yaml
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/georgemac/hola/lib/identity"
+	"github.com/georgemac/hola/lib/secrets"
+	"github.com/georgemac/hola/lib/storage/storagetest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/jose.v1/crypto"
+)
+
+const identities = `
+- key: some-issuer-key
+  secret: this is super secret
+  scopes: [resource.action]
+  signing_method: HS256
+  created_at: 2017-07-14T02:40:00Z
+  expires_at: 2018-07-14T02:40:00Z
+  owner: platform
+  description: some client
+- key: other-issuer-key
+  secret: this is also secret
+  signing_method: HS512
+  disabled: true
+`
+
+func Test_Storage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(*testing.T) identity.Fetcher {
+		return NewStorage()
+	})
+}
+
+func Test_Storage_Fetch(t *testing.T) {
+	storage := NewStorage()
+	_, err := storage.ReadFrom(strings.NewReader(identities))
+	require.Nil(t, err)
+
+	id, ok, err := storage.Fetch("some-issuer-key")
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.Equal(t, []byte("this is super secret"), id.Secret)
+	assert.Equal(t, "HS256", id.Method.Alg())
+	assert.Equal(t, time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC), id.CreatedAt)
+	assert.Equal(t, time.Date(2018, 7, 14, 2, 40, 0, 0, time.UTC), id.ExpiresAt)
+	assert.Equal(t, "platform", id.Owner)
+	assert.Equal(t, "some client", id.Description)
+	assert.False(t, id.Disabled)
+
+	id, ok, err = storage.Fetch("other-issuer-key")
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.True(t, id.Disabled)
+
+	_, ok, err = storage.Fetch("missing-key")
+	require.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func Test_Storage_EncryptedSecret(t *testing.T) {
+	master, err := secrets.NewMasterKey(bytes.Repeat([]byte{1}, 32))
+	require.Nil(t, err)
+
+	encrypted, err := secrets.Encrypt(master, []byte("this is super secret"))
+	require.Nil(t, err)
+
+	data := fmt.Sprintf("- key: some-issuer-key\n  secret: %s\n  signing_method: HS256\n", encrypted)
+
+	storage := NewStorage(WithKeyProvider(master))
+	_, err = storage.ReadFrom(strings.NewReader(data))
+	require.Nil(t, err)
+
+	id, ok, err := storage.Fetch("some-issuer-key")
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.Equal(t, []byte("this is super secret"), id.Secret)
+
+	// encrypted secrets without a key provider are rejected
+	_, err = NewStorage().ReadFrom(strings.NewReader(data))
+	assert.Equal(t, ErrNoKeyProvider, errors.Cause(err))
+}
+
+func Test_Storage_Put_Revoke_Save(t *testing.T) {
+	storage := NewStorage()
+	_, err := storage.ReadFrom(strings.NewReader(identities))
+	require.Nil(t, err)
+
+	require.Nil(t, storage.Put(identity.Identity{
+		Key:    "new-issuer-key",
+		Secret: []byte("this is a new secret"),
+		Method: crypto.SigningMethodHS384,
+	}))
+	require.Nil(t, storage.Revoke("other-issuer-key"))
+
+	var buf bytes.Buffer
+	require.Nil(t, storage.Save(&buf))
+
+	saved := NewStorage()
+	_, err = saved.ReadFrom(&buf)
+	require.Nil(t, err)
+	assert.Equal(t, storage.identities, saved.identities)
+
+	_, ok, err := saved.Fetch("other-issuer-key")
+	require.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func Test_Storage_SecretReference(t *testing.T) {
+	os.Setenv("HOLA_TEST_SECRET", "this is super secret")
+	defer os.Unsetenv("HOLA_TEST_SECRET")
+
+	storage := NewStorage()
+	_, err := storage.ReadFrom(strings.NewReader("- key: some-issuer-key\n  secret: env:HOLA_TEST_SECRET\n  signing_method: HS256\n"))
+	require.Nil(t, err)
+
+	// the reference is written while the secret is unchanged
+	_, _, err = storage.Update("some-issuer-key", identity.SetScopes("resource.action"))
+	require.Nil(t, err)
+
+	var buf bytes.Buffer
+	require.Nil(t, storage.Save(&buf))
+	assert.Contains(t, buf.String(), "secret: env:HOLA_TEST_SECRET")
+
+	// and retired along with the secret
+	rotated, _, err := storage.Rotate("some-issuer-key", time.Hour)
+	require.Nil(t, err)
+
+	buf.Reset()
+	require.Nil(t, storage.Save(&buf))
+	assert.Contains(t, buf.String(), "secret: "+string(rotated.Secret))
+	assert.Contains(t, buf.String(), "retired_secret:\n    secret: env:HOLA_TEST_SECRET")
+
+	// but not once the secret is replaced by any update
+	_, _, err = storage.Update("some-issuer-key", func(id *identity.Identity) error {
+		id.Secret, id.Retired = []byte("this is a new secret"), nil
+		return nil
+	})
+	require.Nil(t, err)
+
+	buf.Reset()
+	require.Nil(t, storage.Save(&buf))
+	assert.NotContains(t, buf.String(), "env:HOLA_TEST_SECRET")
+	assert.Contains(t, buf.String(), "secret: this is a new secret")
+}
+
+func Test_Storage_Put_Encrypted(t *testing.T) {
+	master, err := secrets.NewMasterKey(bytes.Repeat([]byte{1}, 32))
+	require.Nil(t, err)
+
+	storage := NewStorage(WithKeyProvider(master))
+	require.Nil(t, storage.Put(identity.Identity{
+		Key:    "new-issuer-key",
+		Secret: []byte("this is a new secret"),
+		Method: crypto.SigningMethodHS256,
+	}))
+
+	var buf bytes.Buffer
+	require.Nil(t, storage.Save(&buf))
+	assert.NotContains(t, buf.String(), "this is a new secret")
+	assert.Contains(t, buf.String(), "secret: enc:")
+
+	saved := NewStorage(WithKeyProvider(master))
+	_, err = saved.ReadFrom(&buf)
+	require.Nil(t, err)
+
+	id, ok, err := saved.Fetch("new-issuer-key")
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.Equal(t, []byte("this is a new secret"), id.Secret)
+}
+
+func Test_Storage_Issue_List_Update(t *testing.T) {
+	storage := NewStorage()
+	_, err := storage.ReadFrom(strings.NewReader(identities))
+	require.Nil(t, err)
+
+	issued, err := storage.Issue(identity.IssueRequest{})
+	require.Nil(t, err)
+	assert.Len(t, issued.Key, 16)
+	assert.Len(t, issued.Secret, 43)
+	assert.Equal(t, "HS256", issued.Method.Alg())
+
+	page, err := storage.List(identity.ListOptions{})
+	require.Nil(t, err)
+	require.Len(t, page.Identities, 3)
+	for i := 1; i < len(page.Identities); i++ {
+		assert.True(t, page.Identities[i-1].Key < page.Identities[i].Key)
+	}
+
+	page, err = storage.List(identity.ListOptions{Method: "HS512"})
+	require.Nil(t, err)
+	require.Len(t, page.Identities, 1)
+	assert.Equal(t, "other-issuer-key", page.Identities[0].Key)
+
+	updated, ok, err := storage.Update(issued.Key, func(id *identity.Identity) error {
+		id.Scopes = []string{"resource.action"}
+		return nil
+	})
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.Equal(t, []string{"resource.action"}, updated.Scopes)
+
+	id, _, err := storage.Fetch(issued.Key)
+	require.Nil(t, err)
+	assert.Equal(t, updated, id)
+
+	_, ok, err = storage.Update("missing-key", func(*identity.Identity) error {
+		return fmt.Errorf("not called")
+	})
+	require.Nil(t, err)
+	assert.False(t, ok)
+
+	_, _, err = storage.Update(issued.Key, func(id *identity.Identity) error {
+		id.Key = "other-key"
+		return nil
+	})
+	assert.Equal(t, identity.ErrKeyChanged, errors.Cause(err))
+}
+
+func Test_Storage_Rotate_Encrypted(t *testing.T) {
+	master, err := secrets.NewMasterKey(bytes.Repeat([]byte{1}, 32))
+	require.Nil(t, err)
+
+	storage := NewStorage(WithKeyProvider(master))
+	require.Nil(t, storage.Put(identity.Identity{
+		Key:    "some-issuer-key",
+		Secret: []byte("this is the old secret"),
+		Method: crypto.SigningMethodHS256,
+	}))
+
+	rotated, ok, err := storage.Rotate("some-issuer-key", time.Hour)
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.Len(t, rotated.Secret, 43)
+	require.NotNil(t, rotated.Retired)
+	assert.Equal(t, []byte("this is the old secret"), rotated.Retired.Secret)
+
+	var buf bytes.Buffer
+	require.Nil(t, storage.Save(&buf))
+	assert.NotContains(t, buf.String(), "this is the old secret")
+	assert.NotContains(t, buf.String(), string(rotated.Secret))
+
+	saved := NewStorage(WithKeyProvider(master))
+	_, err = saved.ReadFrom(&buf)
+	require.Nil(t, err)
+
+	id, ok, err := saved.Fetch("some-issuer-key")
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.Equal(t, rotated.Secret, id.Secret)
+	assert.Equal(t, []byte("this is the old secret"), id.Retired.Secret)
+	assert.Equal(t, rotated.Retired.ExpiresAt, id.Retired.ExpiresAt)
+
+	_, ok, err = storage.Rotate("missing-key", 0)
+	require.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func Test_Storage_ZeroValue(t *testing.T) {
+	var storage Storage
+
+	_, ok, err := storage.Fetch("some-issuer-key")
+	require.Nil(t, err)
+	assert.False(t, ok)
+
+	id := identity.Identity{Key: "some-issuer-key", Secret: []byte("this is super secret"), Method: crypto.SigningMethodHS256}
+	require.Nil(t, storage.Put(id))
+
+	fetched, ok, err := storage.Fetch("some-issuer-key")
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.Equal(t, id, fetched)
+
+	var loaded Storage
+	require.Nil(t, loaded.Load(storage.Snapshot()))
+	assert.Equal(t, storage.Snapshot(), loaded.Snapshot())
+
+	require.Nil(t, loaded.Revoke("some-issuer-key"))
+	assert.Empty(t, loaded.Snapshot())
+}